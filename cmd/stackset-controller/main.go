@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/url"
@@ -17,12 +18,18 @@ import (
 	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
 	"github.com/zalando-incubator/stackset-controller/pkg/traffic"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/transport"
 )
 
 const (
 	defaultInterval               = "10s"
+	defaultReconcileWorkers       = "10"
+	defaultLeaderElectionName     = "stackset-controller"
+	defaultLeaseDuration          = "15s"
+	defaultRenewDeadline          = "10s"
+	defaultRetryPeriod            = "2s"
 	defaultIngressSourceSwitchTTL = "5m"
 	defaultMetricsAddress         = ":7979"
 	defaultClientGOTimeout        = 30 * time.Second
@@ -32,29 +39,55 @@ var (
 	config struct {
 		Debug                       bool
 		Interval                    time.Duration
+		ReconcileWorkers            int
 		APIServer                   *url.URL
 		MetricsAddress              string
 		ClusterDomains              []string
+		Namespaces                  []string
+		StackSetSelector            string
 		NoTrafficScaledownTTL       time.Duration
 		ControllerID                string
 		BackendWeightsAnnotationKey string
 		RouteGroupSupportEnabled    bool
+		HTTPRouteSupportEnabled     bool
 		IngressSourceSwitchTTL      time.Duration
+		TrafficAnalysisAddress      string
+		LeaderElection              bool
+		LeaderElectionNamespace     string
+		LeaseDuration               time.Duration
+		RenewDeadline               time.Duration
+		RetryPeriod                 time.Duration
+		DryRun                      bool
 	}
 )
 
 func main() {
 	kingpin.Flag("debug", "Enable debug logging.").BoolVar(&config.Debug)
-	kingpin.Flag("interval", "Interval between syncing stacksets.").
+	kingpin.Flag("interval", "Interval between syncing all stacksets, changed stacksets are synced right away.").
 		Default(defaultInterval).DurationVar(&config.Interval)
+	kingpin.Flag("reconcile-workers", "Number of stacksets reconciled in parallel.").
+		Default(defaultReconcileWorkers).IntVar(&config.ReconcileWorkers)
 	kingpin.Flag("apiserver", "API server url.").URLVar(&config.APIServer)
 	kingpin.Flag("metrics-address", "defines where to serve metrics").Default(defaultMetricsAddress).StringVar(&config.MetricsAddress)
+	kingpin.Flag("namespace", "Namespace the controller manages StackSets in, can be repeated. Defaults to all namespaces.").StringsVar(&config.Namespaces)
+	kingpin.Flag("stackset-selector", "Label selector restricting the StackSets managed by the controller.").StringVar(&config.StackSetSelector)
 	kingpin.Flag("controller-id", "ID of the controller used to determine ownership of StackSet resources").StringVar(&config.ControllerID)
 	kingpin.Flag("backend-weights-key", "Backend weights annotation key the controller will use to set current traffic values").Default(traffic.DefaultBackendWeightsAnnotationKey).StringVar(&config.BackendWeightsAnnotationKey)
 	kingpin.Flag("cluster-domain", "Main domains of the cluster, used for generating Stack Ingress hostnames").Envar("CLUSTER_DOMAIN").Required().StringsVar(&config.ClusterDomains)
 	kingpin.Flag("enable-routegroup-support", "Enable support for RouteGroups on StackSets.").Default("false").BoolVar(&config.RouteGroupSupportEnabled)
+	kingpin.Flag("enable-httproute-support", "Enable support for Gateway API HTTPRoutes on StackSets.").Default("false").BoolVar(&config.HTTPRouteSupportEnabled)
 	kingpin.Flag("ingress-source-switch-ttl", "The ttl before an ingress source is deleted when replaced with another one e.g. switching from RouteGroup to Ingress or vice versa.").
 		Default(defaultIngressSourceSwitchTTL).DurationVar(&config.IngressSourceSwitchTTL)
+	kingpin.Flag("traffic-analysis-prometheus-url", "URL of the Prometheus compatible API used for the traffic analysis of StackSets not specifying an address.").StringVar(&config.TrafficAnalysisAddress)
+	kingpin.Flag("enable-leader-election", "Enable leader election to run multiple replicas of the controller, only the leader reconciles the stacksets.").Default("false").BoolVar(&config.LeaderElection)
+	kingpin.Flag("leader-election-namespace", "Namespace of the Lease used for leader election.").Envar("POD_NAMESPACE").Default("kube-system").StringVar(&config.LeaderElectionNamespace)
+	kingpin.Flag("leader-election-lease-duration", "Time standbys wait before taking over the leadership of a leader which stopped renewing its Lease.").
+		Default(defaultLeaseDuration).DurationVar(&config.LeaseDuration)
+	kingpin.Flag("leader-election-renew-deadline", "Time the leader retries renewing its Lease before giving up the leadership.").
+		Default(defaultRenewDeadline).DurationVar(&config.RenewDeadline)
+	kingpin.Flag("leader-election-retry-period", "Time between attempts to acquire or renew the Lease.").
+		Default(defaultRetryPeriod).DurationVar(&config.RetryPeriod)
+	kingpin.Flag("dry-run", "Reconcile all the stacksets once without changing anything, print the changes which would be made as JSON and exit.").Default("false").BoolVar(&config.DryRun)
 	kingpin.Parse()
 
 	if config.Debug {
@@ -72,21 +105,74 @@ func main() {
 		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
 	}
 
+	stacksetSelector, err := labels.Parse(config.StackSetSelector)
+	if err != nil {
+		log.Fatalf("Failed to parse the StackSet selector: %v", err)
+	}
+
+	var leaderElection *controller.LeaderElectionConfig
+	if config.LeaderElection {
+		identity, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("Failed to get the leader election identity: %v", err)
+		}
+
+		// Controllers with different IDs manage different stacksets
+		name := defaultLeaderElectionName
+		if config.ControllerID != "" {
+			name += "-" + config.ControllerID
+		}
+
+		leaderElection = &controller.LeaderElectionConfig{
+			Namespace:     config.LeaderElectionNamespace,
+			Name:          name,
+			Identity:      identity,
+			LeaseDuration: config.LeaseDuration,
+			RenewDeadline: config.RenewDeadline,
+			RetryPeriod:   config.RetryPeriod,
+		}
+		if err := leaderElection.Validate(); err != nil {
+			log.Fatalf("Invalid leader election configuration: %v", err)
+		}
+	}
+
 	controller, err := controller.NewStackSetController(
 		client,
 		config.ControllerID,
 		config.BackendWeightsAnnotationKey,
 		config.ClusterDomains,
+		config.Namespaces,
+		stacksetSelector,
 		prometheus.DefaultRegisterer,
 		config.Interval,
+		config.ReconcileWorkers,
 		config.RouteGroupSupportEnabled,
+		config.HTTPRouteSupportEnabled,
 		config.IngressSourceSwitchTTL,
+		config.TrafficAnalysisAddress,
+		leaderElection,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create Stackset controller: %v", err)
 	}
 
 	go handleSigterm(cancel)
+
+	if config.DryRun {
+		plans, err := controller.DryRun(ctx)
+		if err != nil {
+			log.Fatalf("Failed to plan the changes: %v", err)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(plans)
+		if err != nil {
+			log.Fatalf("Failed to print the changes: %v", err)
+		}
+		return
+	}
+
 	go serveMetrics(config.MetricsAddress)
 	controller.Run(ctx)
 }
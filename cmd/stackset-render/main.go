@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	rgscheme "github.com/szuecs/routegroup-client/client/clientset/versioned/scheme"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	ssscheme "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/scheme"
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	"github.com/zalando-incubator/stackset-controller/pkg/traffic"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	defaultNamespace = "default"
+)
+
+var (
+	config struct {
+		StackSet                    string
+		Stacks                      []string
+		Traffic                     map[string]string
+		Namespace                   string
+		ClusterDomains              []string
+		BackendWeightsAnnotationKey string
+	}
+)
+
+func main() {
+	config.Traffic = make(map[string]string)
+
+	kingpin.CommandLine.Help = "Render the resources the stackset-controller generates for a StackSet without a cluster."
+	kingpin.Arg("stackset", "StackSet manifest, - to read it from stdin.").Required().StringVar(&config.StackSet)
+	kingpin.Flag("stack", "Manifest of existing Stacks of the StackSet, can be repeated.").StringsVar(&config.Stacks)
+	kingpin.Flag("traffic", "Traffic weight of a stack as <stack>=<weight>, can be repeated. Defaults to the traffic of the StackSet, or all the traffic to the current stack.").StringMapVar(&config.Traffic)
+	kingpin.Flag("namespace", "Namespace of the StackSet if the manifest doesn't specify one.").Default(defaultNamespace).StringVar(&config.Namespace)
+	kingpin.Flag("cluster-domain", "Main domains of the cluster, used for generating Stack Ingress hostnames").Envar("CLUSTER_DOMAIN").StringsVar(&config.ClusterDomains)
+	kingpin.Flag("backend-weights-key", "Backend weights annotation key the controller uses to set current traffic values").Default(traffic.DefaultBackendWeightsAnnotationKey).StringVar(&config.BackendWeightsAnnotationKey)
+	kingpin.Parse()
+
+	for _, addToScheme := range []func(*runtime.Scheme) error{ssscheme.AddToScheme, rgscheme.AddToScheme} {
+		err := addToScheme(scheme.Scheme)
+		if err != nil {
+			log.Fatalf("Failed to register the resources: %v", err)
+		}
+	}
+
+	container, err := readStackSet()
+	if err != nil {
+		log.Fatalf("Failed to read the StackSet: %v", err)
+	}
+
+	objects, err := container.Render()
+	if err != nil {
+		log.Fatalf("Failed to render the StackSet: %v", err)
+	}
+
+	err = printObjects(os.Stdout, objects)
+	if err != nil {
+		log.Fatalf("Failed to print the resources: %v", err)
+	}
+}
+
+// readStackSet reads the StackSet and its existing Stacks from the
+// manifests and applies the traffic weights.
+func readStackSet() (*core.StackSetContainer, error) {
+	var stacksets []zv1.StackSet
+	err := decodeFile(config.StackSet, func(decoder *yaml.YAMLOrJSONDecoder) error {
+		var stackset zv1.StackSet
+		err := decoder.Decode(&stackset)
+		if err == nil {
+			stacksets = append(stacksets, stackset)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stacksets) != 1 {
+		return nil, fmt.Errorf("expected a single StackSet in %s, found %d", config.StackSet, len(stacksets))
+	}
+
+	stackset := stacksets[0]
+	stackset.APIVersion = core.APIVersion
+	stackset.Kind = core.KindStackSet
+	if stackset.Namespace == "" {
+		stackset.Namespace = config.Namespace
+	}
+
+	if len(config.Traffic) > 0 {
+		stackset.Spec.Traffic = nil
+		for stackName, value := range config.Traffic {
+			weight, err := strconv.ParseFloat(value, 64)
+			if err != nil || weight < 0 || weight > 100 {
+				return nil, fmt.Errorf("traffic weight of stack %s must be between 0 and 100", stackName)
+			}
+			stackset.Spec.Traffic = append(stackset.Spec.Traffic, &zv1.DesiredTraffic{
+				StackName: stackName,
+				Weight:    weight,
+			})
+		}
+	}
+
+	container := core.NewContainer(&stackset, &core.SimpleTrafficReconciler{}, config.BackendWeightsAnnotationKey, config.ClusterDomains, clock.RealClock{})
+
+	for _, file := range config.Stacks {
+		err := decodeFile(file, func(decoder *yaml.YAMLOrJSONDecoder) error {
+			var stack zv1.Stack
+			err := decoder.Decode(&stack)
+			if err != nil {
+				return err
+			}
+			stack.APIVersion = core.APIVersion
+			stack.Kind = core.KindStack
+			if stack.Namespace == "" {
+				stack.Namespace = stackset.Namespace
+			}
+
+			// Stacks read from manifests usually don't have a UID
+			uid := stack.UID
+			if uid == "" {
+				uid = types.UID(stack.Name)
+			}
+			container.StackContainers[uid] = &core.StackContainer{Stack: &stack}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return container, nil
+}
+
+// decodeFile calls decode for every document of a YAML or JSON file, - is
+// read from stdin.
+func decodeFile(file string, decode func(decoder *yaml.YAMLOrJSONDecoder) error) error {
+	reader := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		err := decode(decoder)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %v", file, err)
+		}
+	}
+}
+
+// printObjects prints the objects as a multi document YAML stream.
+func printObjects(w io.Writer, objects []runtime.Object) error {
+	for _, object := range objects {
+		gvks, _, err := scheme.Scheme.ObjectKinds(object)
+		if err != nil {
+			return err
+		}
+		object.GetObjectKind().SetGroupVersionKind(gvks[0])
+
+		data, err := sigsyaml.Marshal(object)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "---\n%s", data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
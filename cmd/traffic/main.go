@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/alecthomas/kingpin"
 	log "github.com/sirupsen/logrus"
@@ -15,26 +16,31 @@ import (
 )
 
 const (
-	defaultNamespace = "default"
+	defaultNamespace       = "default"
+	defaultRollbackTimeout = "10m"
 )
 
 var (
 	config struct {
-		Stackset                    string
-		Stack                       string
-		Traffic                     float64
-		Namespace                   string
-		BackendWeightsAnnotationKey string
+		Stackset        string
+		Stack           string
+		Traffic         float64
+		Namespace       string
+		RollbackTimeout time.Duration
 	}
 )
 
 func main() {
-	kingpin.Arg("stackset", "help").Required().StringVar(&config.Stackset)
-	kingpin.Arg("stack", "help").StringVar(&config.Stack)
-	kingpin.Arg("traffic", "help").Default("-1").Float64Var(&config.Traffic)
+	switchCmd := kingpin.Command("switch", "Show or switch the traffic of a stackset.").Default()
+	switchCmd.Arg("stackset", "help").Required().StringVar(&config.Stackset)
+	switchCmd.Arg("stack", "help").StringVar(&config.Stack)
+	switchCmd.Arg("traffic", "help").Default("-1").Float64Var(&config.Traffic)
+	rollbackCmd := kingpin.Command("rollback", "Show the stack revisions of a stackset or switch all the traffic back to a stack, recreating it from its revision if it was deleted.")
+	rollbackCmd.Arg("stackset", "Name of the stackset.").Required().StringVar(&config.Stackset)
+	rollbackCmd.Arg("stack", "Name of the stack to roll back to.").StringVar(&config.Stack)
+	rollbackCmd.Flag("timeout", "Maximum time to wait for a recreated stack to become ready.").Default(defaultRollbackTimeout).DurationVar(&config.RollbackTimeout)
 	kingpin.Flag("namespace", "Namespace of the stackset resource.").Default(defaultNamespace).StringVar(&config.Namespace)
-	kingpin.Flag("backend-weights-key", "Backend weights annotation key the controller will use to set current traffic values").Default(traffic.DefaultBackendWeightsAnnotationKey).StringVar(&config.BackendWeightsAnnotationKey)
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	kubeconfig, err := newKubeConfig()
 	if err != nil {
@@ -46,10 +52,15 @@ func main() {
 		log.Fatalf("Failed to initialize Kubernetes client: %v.", err)
 	}
 
-	trafficSwitcher := traffic.NewSwitcher(client, config.BackendWeightsAnnotationKey)
+	trafficSwitcher := traffic.NewSwitcher(client)
 
 	ctx := context.Background()
 
+	if command == rollbackCmd.FullCommand() {
+		rollback(ctx, trafficSwitcher)
+		return
+	}
+
 	if config.Stack != "" && config.Traffic != -1 {
 		weight := config.Traffic
 		if weight < 0 || weight > 100 {
@@ -71,6 +82,44 @@ func main() {
 	printTrafficTable(stacks)
 }
 
+func rollback(ctx context.Context, trafficSwitcher *traffic.Switcher) {
+	if config.Stack == "" {
+		revisions, err := trafficSwitcher.Revisions(ctx, config.Stackset, config.Namespace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printRevisionTable(revisions)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.RollbackTimeout)
+	defer cancel()
+
+	stacks, err := trafficSwitcher.Rollback(ctx, config.Stackset, config.Stack, config.Namespace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printTrafficTable(stacks)
+}
+
+func printRevisionTable(revisions []traffic.StackRevision) {
+	w := tabwriter.NewWriter(os.Stdout, 8, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", "REVISION", "STACK", "VERSION", "CREATED", "EXISTS")
+
+	for _, revision := range revisions {
+		fmt.Fprintf(w,
+			"%d\t%s\t%s\t%s\t%t\n",
+			revision.Revision,
+			revision.Name,
+			revision.Version,
+			revision.Created.Format(time.RFC3339),
+			revision.Exists,
+		)
+	}
+
+	w.Flush()
+}
+
 func printTrafficTable(stacks []traffic.StackTrafficWeight) {
 	var w *tabwriter.Writer
 
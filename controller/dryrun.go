@@ -0,0 +1,324 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	rgfake "github.com/szuecs/routegroup-client/client/clientset/versioned/fake"
+	rgi "github.com/szuecs/routegroup-client/client/clientset/versioned/typed/zalando.org/v1"
+	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
+	gwi "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/gateway.networking.k8s.io/v1"
+	zi "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+const (
+	ChangeVerbCreate = "create"
+	ChangeVerbUpdate = "update"
+	ChangeVerbDelete = "delete"
+)
+
+// Change is a single write the controller would make to the API server.
+type Change struct {
+	// Verb is one of create, update or delete.
+	Verb string `json:"verb"`
+	// Resource is the plural resource name, e.g. deployments.
+	Resource string `json:"resource"`
+	// Subresource is set for writes to a subresource, e.g. status.
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	// Diff between the object before and after the write, empty for
+	// deletions.
+	Diff string `json:"diff,omitempty"`
+}
+
+// StackSetPlan lists the changes the controller would make when
+// reconciling a stackset.
+type StackSetPlan struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Changes   []Change `json:"changes"`
+	// Events are the events the controller would emit for the stackset
+	// and its stacks.
+	Events []string `json:"events,omitempty"`
+	// Error is set if the reconciliation failed.
+	Error string `json:"error,omitempty"`
+}
+
+// dryRunClient is a client backed by fake clientsets, the writes are
+// recorded instead of being sent to the API server.
+type dryRunClient struct {
+	*fake.Clientset
+	ssFake *ssfake.Clientset
+	rgFake *rgfake.Clientset
+	// objects are the objects the clientsets were seeded with, keyed by
+	// resource, namespace and name.
+	objects map[string]runtime.Object
+}
+
+// newDryRunClient creates a client seeded with the resources of the
+// stackset and the revisions of its stacks.
+func newDryRunClient(container *core.StackSetContainer, revisions []apps.ControllerRevision) *dryRunClient {
+	var kubeObjects, ssObjects, rgObjects []runtime.Object
+	objects := make(map[string]runtime.Object)
+
+	seed := func(into *[]runtime.Object, resource string, object metav1.Object) {
+		copied := object.(runtime.Object).DeepCopyObject()
+		*into = append(*into, copied)
+		objects[objectKey(resource, object.GetNamespace(), object.GetName())] = copied
+	}
+
+	seed(&ssObjects, "stacksets", container.StackSet)
+	if container.Ingress != nil {
+		seed(&kubeObjects, "ingresses", container.Ingress)
+	}
+	if container.RouteGroup != nil {
+		seed(&rgObjects, "routegroups", container.RouteGroup)
+	}
+	if container.HTTPRoute != nil {
+		seed(&ssObjects, "httproutes", container.HTTPRoute)
+	}
+
+	for _, sc := range container.StackContainers {
+		seed(&ssObjects, "stacks", sc.Stack)
+
+		resources := sc.Resources
+		if resources.Deployment != nil {
+			seed(&kubeObjects, "deployments", resources.Deployment)
+		}
+		if resources.HPA != nil {
+			seed(&kubeObjects, "horizontalpodautoscalers", resources.HPA)
+		}
+		if resources.Service != nil {
+			seed(&kubeObjects, "services", resources.Service)
+		}
+		if resources.Ingress != nil {
+			seed(&kubeObjects, "ingresses", resources.Ingress)
+		}
+		if resources.RouteGroup != nil {
+			seed(&rgObjects, "routegroups", resources.RouteGroup)
+		}
+		if resources.HTTPRoute != nil {
+			seed(&ssObjects, "httproutes", resources.HTTPRoute)
+		}
+		if resources.PreTrafficSwitchJob != nil {
+			seed(&kubeObjects, "jobs", resources.PreTrafficSwitchJob)
+		}
+		if resources.PostTrafficSwitchJob != nil {
+			seed(&kubeObjects, "jobs", resources.PostTrafficSwitchJob)
+		}
+	}
+
+	for i := range revisions {
+		seed(&kubeObjects, "controllerrevisions", &revisions[i])
+	}
+
+	return &dryRunClient{
+		Clientset: fake.NewSimpleClientset(kubeObjects...),
+		ssFake:    ssfake.NewSimpleClientset(ssObjects...),
+		rgFake:    rgfake.NewSimpleClientset(rgObjects...),
+		objects:   objects,
+	}
+}
+
+func (c *dryRunClient) ZalandoV1() zi.ZalandoV1Interface {
+	return c.ssFake.ZalandoV1()
+}
+
+func (c *dryRunClient) RouteGroupV1() rgi.ZalandoV1Interface {
+	return c.rgFake.ZalandoV1()
+}
+
+func (c *dryRunClient) GatewayV1() gwi.GatewayV1Interface {
+	return c.ssFake.GatewayV1()
+}
+
+func objectKey(resource, namespace, name string) string {
+	return resource + "/" + namespace + "/" + name
+}
+
+// actions returns the requests sent to the fake clientsets, grouped by
+// clientset.
+func (c *dryRunClient) actions() []kubetesting.Action {
+	var result []kubetesting.Action
+	result = append(result, c.Clientset.Actions()...)
+	result = append(result, c.ssFake.Actions()...)
+	return append(result, c.rgFake.Actions()...)
+}
+
+// eventLog is an event recorder keeping the events in memory.
+type eventLog struct {
+	events []string
+}
+
+func (l *eventLog) Event(object runtime.Object, eventtype, reason, message string) {
+	name := ""
+	if accessor, err := meta.Accessor(object); err == nil {
+		name = accessor.GetName()
+	}
+	l.events = append(l.events, fmt.Sprintf("%s %s %s: %s", eventtype, reason, name, message))
+}
+
+func (l *eventLog) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	l.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (l *eventLog) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	l.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+// PlanStackSet runs the reconciliation of a stackset against an in-memory
+// copy of its resources and returns the changes it would make. Nothing is
+// written to the API server, the events are returned as part of the plan.
+// The container is updated like during a regular reconciliation.
+func (c *StackSetController) PlanStackSet(ctx context.Context, container *core.StackSetContainer) *StackSetPlan {
+	plan := &StackSetPlan{
+		Namespace: container.StackSet.Namespace,
+		Name:      container.StackSet.Name,
+	}
+
+	// The revisions aren't cached by the informers, without them every
+	// plan would create the revisions from scratch
+	revisions, err := c.client.AppsV1().ControllerRevisions(container.StackSet.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{core.StacksetHeritageLabelKey: container.StackSet.Name}.String(),
+	})
+	if err != nil {
+		plan.Error = fmt.Sprintf("failed to list ControllerRevisions: %v", err)
+		return plan
+	}
+
+	client := newDryRunClient(container, revisions.Items)
+	events := &eventLog{}
+
+	dryRun := &StackSetController{
+		logger:                      c.logger.WithField("dry-run", true),
+		client:                      client,
+		controllerID:                c.controllerID,
+		backendWeightsAnnotationKey: c.backendWeightsAnnotationKey,
+		clusterDomains:              c.clusterDomains,
+		recorder:                    events,
+		routeGroupSupportEnabled:    c.routeGroupSupportEnabled,
+		httpRouteSupportEnabled:     c.httpRouteSupportEnabled,
+		ingressSourceSwitchTTL:      c.ingressSourceSwitchTTL,
+		trafficAnalysisAddress:      c.trafficAnalysisAddress,
+		trafficBackends:             c.trafficBackends,
+		newMetricsProvider:          c.newMetricsProvider,
+		clock:                       c.clock,
+	}
+
+	err = dryRun.ReconcileStackSet(ctx, container)
+	if err != nil {
+		plan.Error = err.Error()
+	}
+
+	for _, action := range client.actions() {
+		change := Change{
+			Resource:    action.GetResource().Resource,
+			Subresource: action.GetSubresource(),
+			Namespace:   action.GetNamespace(),
+		}
+
+		var object runtime.Object
+		switch action := action.(type) {
+		case kubetesting.CreateAction:
+			change.Verb = ChangeVerbCreate
+			object = action.GetObject()
+		case kubetesting.UpdateAction:
+			change.Verb = ChangeVerbUpdate
+			object = action.GetObject()
+		case kubetesting.DeleteAction:
+			change.Verb = ChangeVerbDelete
+			change.Name = action.GetName()
+		default:
+			// reads don't change anything
+			continue
+		}
+
+		if object != nil {
+			accessor, err := meta.Accessor(object)
+			if err != nil {
+				continue
+			}
+			change.Name = accessor.GetName()
+
+			key := objectKey(change.Resource, change.Namespace, change.Name)
+			before, ok := client.objects[key]
+			if !ok {
+				before = reflect.New(reflect.TypeOf(object).Elem()).Interface().(runtime.Object)
+			}
+			change.Diff = cmp.Diff(before, object, cmpopts.IgnoreUnexported(resource.Quantity{}))
+			// later writes are diffed against this one
+			client.objects[key] = object
+		}
+
+		plan.Changes = append(plan.Changes, change)
+	}
+	plan.Events = events.events
+
+	return plan
+}
+
+// DryRun reconciles all the stacksets managed by the controller without
+// writing to the API server, and returns the changes it would make per
+// stackset sorted by namespace and name.
+func (c *StackSetController) DryRun(ctx context.Context) ([]*StackSetPlan, error) {
+	err := c.informers.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := c.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{v1.NamespaceAll}
+	}
+
+	stacksets := make(map[types.UID]*core.StackSetContainer)
+	for _, namespace := range namespaces {
+		list, err := c.client.ZalandoV1().StackSets(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: c.stacksetSelector.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list StackSets: %v", err)
+		}
+
+		for _, stackset := range list.Items {
+			if !c.hasOwnership(&stackset) {
+				continue
+			}
+			fixupStackSetTypeMeta(&stackset)
+			stacksets[stackset.UID] = c.newStackSetContainer(stackset)
+		}
+	}
+
+	err = c.collectStackSetResources(stacksets)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]*StackSetPlan, 0, len(stacksets))
+	for _, container := range stacksets {
+		plans = append(plans, c.PlanStackSet(ctx, container))
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Namespace != plans[j].Namespace {
+			return plans[i].Namespace < plans[j].Namespace
+		}
+		return plans[i].Name < plans[j].Name
+	})
+	return plans, nil
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDryRun(t *testing.T) {
+	env := NewTestEnvironment()
+
+	stackset := testStackset("foo", "default", "123")
+	stackset.Spec.StackTemplate.Spec.Version = "v1"
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+	require.NoError(t, err)
+
+	// the revision of a stack which was already deleted
+	_, err = env.client.AppsV1().ControllerRevisions("default").Create(context.Background(), &apps.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo-v0",
+			Namespace: "default",
+			Labels:    map[string]string{core.StacksetHeritageLabelKey: "foo"},
+		},
+		Revision: 3,
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	plans, err := env.controller.DryRun(ctx)
+	require.NoError(t, err)
+	require.Len(t, plans, 1)
+
+	plan := plans[0]
+	require.Equal(t, "default", plan.Namespace)
+	require.Equal(t, "foo", plan.Name)
+	require.Empty(t, plan.Error)
+
+	var created []string
+	for _, change := range plan.Changes {
+		if change.Verb == ChangeVerbCreate {
+			created = append(created, change.Resource+"/"+change.Name)
+			require.NotEmpty(t, change.Diff)
+		}
+	}
+	require.Contains(t, created, "stacks/foo-v1")
+	require.Contains(t, created, "deployments/foo-v1")
+	require.Contains(t, created, "controllerrevisions/foo-v1")
+
+	// the revision follows the existing ones, which are kept
+	for _, change := range plan.Changes {
+		if change.Resource == "controllerrevisions" {
+			require.Equal(t, ChangeVerbCreate, change.Verb)
+			require.Contains(t, change.Diff, "Revision: 4")
+		}
+	}
+	require.Contains(t, plan.Events, "Normal CreatedStack foo: Created stack foo-v1")
+
+	// Nothing is written to the cluster
+	stacks, err := env.client.ZalandoV1().Stacks("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, stacks.Items)
+
+	updated, err := env.client.ZalandoV1().StackSets("default").Get(context.Background(), "foo", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, stackset.Status, updated.Status)
+}
@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	batch "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	ownerUIDIndex = "ownerUID"
+	uidIndex      = "uid"
+)
+
+// resourceInformers caches the resources owned by stacksets and stacks, so
+// the controller doesn't have to list them on every iteration. All the
+// caches are indexed by the UID of the objects and of their owner.
+type resourceInformers struct {
+	stacks      namespacedInformers
+	ingresses   namespacedInformers
+	routeGroups namespacedInformers
+	httpRoutes  namespacedInformers
+	deployments namespacedInformers
+	services    namespacedInformers
+	hpas        namespacedInformers
+	jobs        namespacedInformers
+}
+
+// namespacedInformers are the informers of a resource, one per namespace
+// watched by the controller.
+type namespacedInformers []cache.SharedIndexInformer
+
+// byIndex returns the objects matching the indexed value from the caches of
+// all the namespaces.
+func (n namespacedInformers) byIndex(indexName, indexedValue string) ([]interface{}, error) {
+	var result []interface{}
+	for _, informer := range n {
+		objects, err := informer.GetIndexer().ByIndex(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objects...)
+	}
+	return result, nil
+}
+
+// newResourceInformers creates the informers for the given namespaces, or
+// for all namespaces if none are given.
+func newResourceInformers(client clientset.Interface, namespaces []string, routeGroupSupportEnabled, httpRouteSupportEnabled bool) *resourceInformers {
+	if len(namespaces) == 0 {
+		namespaces = []string{v1.NamespaceAll}
+	}
+
+	informers := &resourceInformers{}
+	for _, namespace := range namespaces {
+		namespace := namespace
+
+		informers.stacks = append(informers.stacks, newOwnerIndexedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.ZalandoV1().Stacks(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.ZalandoV1().Stacks(namespace).Watch(context.TODO(), options)
+			},
+		}, &zv1.Stack{}))
+		informers.ingresses = append(informers.ingresses, newOwnerIndexedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.NetworkingV1().Ingresses(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.NetworkingV1().Ingresses(namespace).Watch(context.TODO(), options)
+			},
+		}, &networking.Ingress{}))
+		informers.deployments = append(informers.deployments, newOwnerIndexedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().Deployments(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.AppsV1().Deployments(namespace).Watch(context.TODO(), options)
+			},
+		}, &apps.Deployment{}))
+		informers.services = append(informers.services, newOwnerIndexedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.CoreV1().Services(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.CoreV1().Services(namespace).Watch(context.TODO(), options)
+			},
+		}, &v1.Service{}))
+		informers.hpas = append(informers.hpas, newOwnerIndexedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).Watch(context.TODO(), options)
+			},
+		}, &autoscaling.HorizontalPodAutoscaler{}))
+		informers.jobs = append(informers.jobs, newOwnerIndexedInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.BatchV1().Jobs(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.BatchV1().Jobs(namespace).Watch(context.TODO(), options)
+			},
+		}, &batch.Job{}))
+
+		// RouteGroups and HTTPRoutes are only watched if enabled, their CRDs
+		// might not be installed otherwise
+		if routeGroupSupportEnabled {
+			informers.routeGroups = append(informers.routeGroups, newOwnerIndexedInformer(&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return client.RouteGroupV1().RouteGroups(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return client.RouteGroupV1().RouteGroups(namespace).Watch(context.TODO(), options)
+				},
+			}, &rgv1.RouteGroup{}))
+		}
+		if httpRouteSupportEnabled {
+			informers.httpRoutes = append(informers.httpRoutes, newOwnerIndexedInformer(&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return client.GatewayV1().HTTPRoutes(namespace).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return client.GatewayV1().HTTPRoutes(namespace).Watch(context.TODO(), options)
+				},
+			}, &gatewayv1.HTTPRoute{}))
+		}
+	}
+	return informers
+}
+
+func newOwnerIndexedInformer(listWatch *cache.ListWatch, objType runtime.Object) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		listWatch,
+		objType,
+		0, // skip resync
+		cache.Indexers{ownerUIDIndex: ownerUIDIndexFunc, uidIndex: uidIndexFunc},
+	)
+}
+
+// ownerUIDIndexFunc indexes objects by the UID of their owner, objects with
+// more than one owner are ignored.
+func ownerUIDIndexFunc(obj interface{}) ([]string, error) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if uid, ok := getOwnerUID(metav1.ObjectMeta{OwnerReferences: object.GetOwnerReferences()}); ok {
+		return []string{string(uid)}, nil
+	}
+	return nil, nil
+}
+
+// uidIndexFunc indexes objects by their UID.
+func uidIndexFunc(obj interface{}) ([]string, error) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(object.GetUID())}, nil
+}
+
+// all returns the informers which are enabled.
+func (i *resourceInformers) all() []cache.SharedIndexInformer {
+	var result []cache.SharedIndexInformer
+	for _, informers := range []namespacedInformers{i.stacks, i.ingresses, i.routeGroups, i.httpRoutes, i.deployments, i.services, i.hpas, i.jobs} {
+		result = append(result, informers...)
+	}
+	return result
+}
+
+// addEventHandler adds the event handler to all the informers.
+func (i *resourceInformers) addEventHandler(handler cache.ResourceEventHandler) {
+	for _, informer := range i.all() {
+		informer.AddEventHandler(handler)
+	}
+}
+
+// run starts all the informers and waits until their caches are synced.
+func (i *resourceInformers) run(ctx context.Context) error {
+	var synced []cache.InformerSynced
+	for _, informer := range i.all() {
+		go informer.Run(ctx.Done())
+		synced = append(synced, informer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+	return nil
+}
+
+// ownedObject returns an object owned by the given UID from the caches of the
+// informers, or nil if there is none.
+func ownedObject(informers namespacedInformers, uid types.UID) (interface{}, error) {
+	objects, err := informers.byIndex(ownerUIDIndex, string(uid))
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	return objects[0], nil
+}
+
+// ownerByUID returns the stack or deployment with the given UID from the
+// caches, the only resources owning other resources of a stackset. It
+// returns nil if there is none.
+func (i *resourceInformers) ownerByUID(uid types.UID) (metav1.Object, error) {
+	for _, informers := range []namespacedInformers{i.stacks, i.deployments} {
+		objects, err := informers.byIndex(uidIndex, string(uid))
+		if err != nil {
+			return nil, err
+		}
+		if len(objects) > 0 {
+			return meta.Accessor(objects[0])
+		}
+	}
+	return nil, nil
+}
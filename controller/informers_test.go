@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOwnerUIDIndexFunc(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		owners   []metav1.OwnerReference
+		expected []string
+	}{
+		{
+			name: "objects without owner are not indexed",
+		},
+		{
+			name:     "objects are indexed by the owner UID",
+			owners:   []metav1.OwnerReference{{UID: "x"}},
+			expected: []string{"x"},
+		},
+		{
+			name:   "objects with multiple owners are not indexed",
+			owners: []metav1.OwnerReference{{UID: "x"}, {UID: "y"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					OwnerReferences: tc.owners,
+				},
+			}
+
+			keys, err := ownerUIDIndexFunc(service)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, keys)
+		})
+	}
+}
+
+func TestNamespacedInformers(t *testing.T) {
+	env := NewTestEnvironment()
+
+	stacksetA := testStackset("foo", "a", "123")
+	stacksetB := testStackset("foo", "b", "456")
+	stacksetC := testStackset("foo", "c", "789")
+	err := env.CreateStacks(context.Background(), []zv1.Stack{
+		testStack("foo-v1", stacksetA.Namespace, "abc1", stacksetA),
+		testStack("foo-v1", stacksetB.Namespace, "abc2", stacksetB),
+		testStack("foo-v1", stacksetC.Namespace, "abc3", stacksetC),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	informers := newResourceInformers(env.client, []string{"a", "b"}, false, false)
+	err = informers.run(ctx)
+	require.NoError(t, err)
+
+	for _, stackset := range []zv1.StackSet{stacksetA, stacksetB} {
+		stacks, err := informers.stacks.byIndex(ownerUIDIndex, string(stackset.UID))
+		require.NoError(t, err)
+		require.Len(t, stacks, 1)
+	}
+
+	stacks, err := informers.stacks.byIndex(ownerUIDIndex, string(stacksetC.UID))
+	require.NoError(t, err)
+	require.Empty(t, stacks)
+}
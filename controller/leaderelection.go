@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zalando-incubator/stackset-controller/pkg/core"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// leaderElectionHealthTimeout is the time a leader may fail to renew
+	// its lease beyond the lease duration before it's reported unhealthy.
+	leaderElectionHealthTimeout = 20 * time.Second
+)
+
+// LeaderElectionConfig configures the Lease based leader election between
+// multiple replicas of the controller.
+type LeaderElectionConfig struct {
+	// Namespace and Name of the Lease object.
+	Namespace string
+	Name      string
+	// Identity of this replica, e.g. the pod name.
+	Identity string
+	// LeaseDuration is the time standbys wait before taking over a lease
+	// which wasn't renewed.
+	LeaseDuration time.Duration
+	// RenewDeadline is the time the leader retries to renew its lease
+	// before giving up the leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is the time between attempts to acquire or renew the
+	// lease.
+	RetryPeriod time.Duration
+}
+
+// Validate checks the durations of the leader election, they are otherwise
+// only checked by client-go which panics on invalid ones.
+func (c *LeaderElectionConfig) Validate() error {
+	if c.RetryPeriod <= 0 {
+		return fmt.Errorf("retry period must be positive, got %s", c.RetryPeriod)
+	}
+	if minRenewDeadline := time.Duration(leaderelection.JitterFactor * float64(c.RetryPeriod)); c.RenewDeadline <= minRenewDeadline {
+		return fmt.Errorf("renew deadline (%s) must be greater than %g times the retry period (%s)", c.RenewDeadline, leaderelection.JitterFactor, c.RetryPeriod)
+	}
+	if c.LeaseDuration <= c.RenewDeadline {
+		return fmt.Errorf("lease duration (%s) must be greater than the renew deadline (%s)", c.LeaseDuration, c.RenewDeadline)
+	}
+	return nil
+}
+
+func (c *StackSetController) setLeader(leading bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.leading = leading
+
+	// The metrics are only reported by the leader
+	if !leading {
+		c.stacksetContainers = make(map[types.UID]*core.StackSetContainer)
+	}
+}
+
+// runLeaderElection campaigns for the leadership until the context is
+// cancelled. The workers reconciling the stacksets only run while the
+// controller is the leader, the caches are kept up to date by the standbys
+// so they can take over right away.
+func (c *StackSetController) runLeaderElection(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: c.leaderElection.Namespace,
+			Name:      c.leaderElection.Name,
+		},
+		Client: c.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: c.leaderElection.Identity,
+		},
+	}
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			Name:            c.leaderElection.Name,
+			LeaseDuration:   c.leaderElection.LeaseDuration,
+			RenewDeadline:   c.leaderElection.RenewDeadline,
+			RetryPeriod:     c.leaderElection.RetryPeriod,
+			ReleaseOnCancel: true,
+			WatchDog:        c.leaderElectionHealth,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					c.logger.Infof("Started leading as %s", c.leaderElection.Identity)
+					c.setLeader(true)
+					c.startWorkers(leaderCtx)
+				},
+				OnStoppedLeading: func() {
+					c.logger.Infof("Stopped leading as %s", c.leaderElection.Identity)
+					c.setLeader(false)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != c.leaderElection.Identity {
+						c.logger.Infof("New leader elected: %s", identity)
+					}
+				},
+			},
+		})
+	}
+}
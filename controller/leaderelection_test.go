@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// isLeader returns true if the controller is allowed to reconcile the
+// stacksets.
+func (c *StackSetController) isLeader() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.leading
+}
+
+func testLeaderElectionController(t *testing.T, client clientset.Interface, identity string) *StackSetController {
+	controller, err := NewStackSetController(client, "", "", nil, nil, labels.Everything(), prometheus.NewPedanticRegistry(), time.Minute, 1, true, true, time.Minute, "", &LeaderElectionConfig{
+		Namespace:     "kube-system",
+		Name:          "stackset-controller",
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	return controller
+}
+
+func TestLeaderElection(t *testing.T) {
+	env := NewTestEnvironment()
+
+	first := testLeaderElectionController(t, env.client, "first")
+	second := testLeaderElectionController(t, env.client, "second")
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	defer cancelFirst()
+	go first.runLeaderElection(firstCtx)
+
+	require.Eventually(t, first.isLeader, 5*time.Second, 10*time.Millisecond)
+
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	go second.runLeaderElection(secondCtx)
+
+	// The standby doesn't take over while the leader renews the lease
+	time.Sleep(2 * time.Second)
+	require.True(t, first.isLeader())
+	require.False(t, second.isLeader())
+
+	// The standby takes over once the leader releases the lease
+	cancelFirst()
+	require.Eventually(t, second.isLeader, 5*time.Second, 10*time.Millisecond)
+	require.False(t, first.isLeader())
+}
+
+func TestLeaderElectionConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		leaseDuration time.Duration
+		renewDeadline time.Duration
+		retryPeriod   time.Duration
+		expectError   bool
+	}{
+		{
+			name:          "valid durations",
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 10 * time.Second,
+			retryPeriod:   2 * time.Second,
+		},
+		{
+			name:          "lease duration not greater than the renew deadline",
+			leaseDuration: 10 * time.Second,
+			renewDeadline: 10 * time.Second,
+			retryPeriod:   2 * time.Second,
+			expectError:   true,
+		},
+		{
+			name:          "renew deadline not greater than the jittered retry period",
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 2 * time.Second,
+			retryPeriod:   2 * time.Second,
+			expectError:   true,
+		},
+		{
+			name:          "retry period not positive",
+			leaseDuration: 15 * time.Second,
+			renewDeadline: 10 * time.Second,
+			expectError:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &LeaderElectionConfig{
+				LeaseDuration: tc.leaseDuration,
+				RenewDeadline: tc.renewDeadline,
+				RetryPeriod:   tc.retryPeriod,
+			}
+			err := config.Validate()
+			if tc.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
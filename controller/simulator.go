@@ -0,0 +1,633 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	rgfake "github.com/szuecs/routegroup-client/client/clientset/versioned/fake"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	batch "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+const (
+	defaultSimulatorTickInterval = 10 * time.Second
+	simulatorLoadBalancer        = "lb.example.org"
+)
+
+// SimulatorConfig configures how the simulated cluster behaves.
+type SimulatorConfig struct {
+	// TickInterval is how far the clock advances on every tick, defaults
+	// to 10s.
+	TickInterval time.Duration
+	// ReadyAfterTicks is the number of ticks the pods of a deployment
+	// take to become ready after it was created, changed or scaled up.
+	ReadyAfterTicks int
+	// PodsReady decides if the pods of a deployment ever become ready,
+	// all pods become ready if it's not set. It can be used to simulate
+	// broken stacks.
+	PodsReady func(deployment *apps.Deployment) bool
+	// HPAReplicas returns the replicas an HPA scales its deployment to,
+	// the result is bounded by the min and max replicas of the HPA. By
+	// default the HPA keeps the replicas of the deployment.
+	HPAReplicas func(hpa *autoscaling.HorizontalPodAutoscaler) int32
+	// JobSucceeded decides if a Job succeeds or fails, all Jobs succeed
+	// if it's not set. Jobs finish on the tick they're created.
+	JobSucceeded func(job *batch.Job) bool
+	// ClusterDomains are the cluster domains of the controller.
+	ClusterDomains []string
+	// IngressSourceSwitchTTL is the ingress source switch TTL of the
+	// controller.
+	IngressSourceSwitchTTL time.Duration
+}
+
+// deploymentProgress is the rollout progress of a simulated deployment.
+type deploymentProgress struct {
+	template v1.PodTemplateSpec
+	replicas int32
+	since    int
+}
+
+// Simulator runs the controller against an in-memory cluster backed by
+// fake clientsets. Every tick the controller reconciles all the stacksets,
+// then the simulated cluster updates the resources the way the Kubernetes
+// controllers, the HPA controller and the ingress controllers would, and
+// the clock of the controller advances. This allows to run the end to end
+// scenarios in seconds without a cluster.
+type Simulator struct {
+	// Client is the client of the simulated cluster.
+	Client clientset.Interface
+	// Clock is the clock of the controller.
+	Clock *clock.FakeClock
+
+	config     SimulatorConfig
+	controller *StackSetController
+	events     *eventLog
+	tick       int
+	uids       int
+	progress   map[string]*deploymentProgress
+}
+
+// NewSimulator creates a simulator with an empty cluster.
+func NewSimulator(config SimulatorConfig) (*Simulator, error) {
+	if config.TickInterval == 0 {
+		config.TickInterval = defaultSimulatorTickInterval
+	}
+
+	kubeFake := fake.NewSimpleClientset()
+	ssFake := ssfake.NewSimpleClientset()
+	rgFake := rgfake.NewSimpleClientset()
+	client := &testClient{
+		Interface: kubeFake,
+		ssClient:  ssFake,
+		rgClient:  rgFake,
+	}
+
+	controller, err := NewStackSetController(client, "", "", config.ClusterDomains, nil, labels.Everything(), prometheus.NewPedanticRegistry(), config.TickInterval, 1, true, true, config.IngressSourceSwitchTTL, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		Client:     client,
+		Clock:      clock.NewFakeClock(time.Now().Truncate(time.Second)),
+		config:     config,
+		controller: controller,
+		events:     &eventLog{},
+		progress:   make(map[string]*deploymentProgress),
+	}
+	controller.clock = s.Clock
+	controller.recorder = s.events
+	controller.setLeader(true)
+
+	// The API server sets the UID and the creation timestamp, the fake
+	// clientsets don't
+	for _, f := range []*kubetesting.Fake{&kubeFake.Fake, &ssFake.Fake, &rgFake.Fake} {
+		f.PrependReactor("create", "*", s.initObjectMeta)
+	}
+	return s, nil
+}
+
+func (s *Simulator) initObjectMeta(action kubetesting.Action) (bool, runtime.Object, error) {
+	accessor, err := meta.Accessor(action.(kubetesting.CreateAction).GetObject())
+	if err != nil {
+		return false, nil, nil
+	}
+	if accessor.GetUID() == "" {
+		s.uids++
+		accessor.SetUID(types.UID(fmt.Sprintf("simulated-%d", s.uids)))
+	}
+	accessor.SetCreationTimestamp(metav1.NewTime(s.Clock.Now()))
+	return false, nil, nil
+}
+
+// Events returns the events the controller emitted so far.
+func (s *Simulator) Events() []string {
+	return s.events.events
+}
+
+// Tick runs a single iteration of the controller and of the simulated
+// cluster and advances the clock.
+func (s *Simulator) Tick(ctx context.Context) error {
+	err := s.syncCaches(ctx)
+	if err != nil {
+		return err
+	}
+
+	uids := make([]types.UID, 0, len(s.controller.stacksetStore))
+	for uid := range s.controller.stacksetStore {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		return uids[i] < uids[j]
+	})
+	for _, uid := range uids {
+		err := s.controller.reconcile(ctx, uid)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.collectGarbage(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.runAutoscalers(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.rolloutDeployments(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.runJobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.assignLoadBalancers(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.tick++
+	s.Clock.Step(s.config.TickInterval)
+	return nil
+}
+
+// RunUntil ticks until the condition is met, it fails if that doesn't
+// happen within maxTicks.
+func (s *Simulator) RunUntil(ctx context.Context, maxTicks int, condition func() (bool, error)) error {
+	for i := 0; i < maxTicks; i++ {
+		err := s.Tick(ctx)
+		if err != nil {
+			return err
+		}
+
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	return fmt.Errorf("condition not met after %d ticks", maxTicks)
+}
+
+// Run ticks the given number of times.
+func (s *Simulator) Run(ctx context.Context, ticks int) error {
+	for i := 0; i < ticks; i++ {
+		err := s.Tick(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncCaches replaces the stackset store and the informer caches of the
+// controller with the current state of the cluster, so every reconciliation
+// sees the writes of the previous tick.
+func (s *Simulator) syncCaches(ctx context.Context) error {
+	stacksets, err := s.Client.ZalandoV1().StackSets(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	store := make(map[types.UID]zv1.StackSet, len(stacksets.Items))
+	for _, stackset := range stacksets.Items {
+		if !s.controller.hasOwnership(&stackset) {
+			continue
+		}
+		fixupStackSetTypeMeta(&stackset)
+		store[stackset.UID] = stackset
+	}
+
+	s.controller.Lock()
+	s.controller.stacksetStore = store
+	for uid := range s.controller.stacksetContainers {
+		if _, ok := store[uid]; !ok {
+			delete(s.controller.stacksetContainers, uid)
+		}
+	}
+	s.controller.Unlock()
+
+	informers := s.controller.informers
+	for _, sync := range []struct {
+		informers namespacedInformers
+		list      func() (runtime.Object, error)
+	}{
+		{informers.stacks, func() (runtime.Object, error) {
+			return s.Client.ZalandoV1().Stacks(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.ingresses, func() (runtime.Object, error) {
+			return s.Client.NetworkingV1().Ingresses(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.routeGroups, func() (runtime.Object, error) {
+			return s.Client.RouteGroupV1().RouteGroups(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.httpRoutes, func() (runtime.Object, error) {
+			return s.Client.GatewayV1().HTTPRoutes(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.deployments, func() (runtime.Object, error) {
+			return s.Client.AppsV1().Deployments(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.services, func() (runtime.Object, error) {
+			return s.Client.CoreV1().Services(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.hpas, func() (runtime.Object, error) {
+			return s.Client.AutoscalingV2beta2().HorizontalPodAutoscalers(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+		{informers.jobs, func() (runtime.Object, error) {
+			return s.Client.BatchV1().Jobs(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		}},
+	} {
+		list, err := sync.list()
+		if err != nil {
+			return err
+		}
+		objects, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		items := make([]interface{}, 0, len(objects))
+		for _, object := range objects {
+			items = append(items, object)
+		}
+		for _, informer := range sync.informers {
+			err := informer.GetIndexer().Replace(items, "")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collectGarbage deletes the objects whose owners were deleted, like the
+// garbage collector of Kubernetes. Owners are deleted before the objects
+// they own.
+func (s *Simulator) collectGarbage(ctx context.Context) error {
+	type collectable struct {
+		list   func() (runtime.Object, error)
+		delete func(namespace, name string) error
+	}
+
+	stacks := collectable{
+		func() (runtime.Object, error) {
+			return s.Client.ZalandoV1().Stacks(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		},
+		func(namespace, name string) error {
+			return s.Client.ZalandoV1().Stacks(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+	}
+	deployments := collectable{
+		func() (runtime.Object, error) {
+			return s.Client.AppsV1().Deployments(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		},
+		func(namespace, name string) error {
+			return s.Client.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+	}
+	others := []collectable{
+		{
+			func() (runtime.Object, error) {
+				return s.Client.CoreV1().Services(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			},
+			func(namespace, name string) error {
+				return s.Client.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			func() (runtime.Object, error) {
+				return s.Client.AutoscalingV2beta2().HorizontalPodAutoscalers(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			},
+			func(namespace, name string) error {
+				return s.Client.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			func() (runtime.Object, error) {
+				return s.Client.NetworkingV1().Ingresses(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			},
+			func(namespace, name string) error {
+				return s.Client.NetworkingV1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			func() (runtime.Object, error) {
+				return s.Client.RouteGroupV1().RouteGroups(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			},
+			func(namespace, name string) error {
+				return s.Client.RouteGroupV1().RouteGroups(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			func() (runtime.Object, error) {
+				return s.Client.GatewayV1().HTTPRoutes(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			},
+			func(namespace, name string) error {
+				return s.Client.GatewayV1().HTTPRoutes(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+		{
+			func() (runtime.Object, error) {
+				return s.Client.BatchV1().Jobs(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			},
+			func(namespace, name string) error {
+				return s.Client.BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			},
+		},
+	}
+
+	stacksets, err := s.Client.ZalandoV1().StackSets(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	owners := make(map[types.UID]bool)
+	for _, stackset := range stacksets.Items {
+		owners[stackset.UID] = true
+	}
+
+	for _, level := range [][]collectable{{stacks}, {deployments}, others} {
+		var remaining []metav1.Object
+		for _, resource := range level {
+			list, err := resource.list()
+			if err != nil {
+				return err
+			}
+			objects, err := meta.ExtractList(list)
+			if err != nil {
+				return err
+			}
+
+			for _, object := range objects {
+				accessor, err := meta.Accessor(object)
+				if err != nil {
+					return err
+				}
+
+				orphaned := len(accessor.GetOwnerReferences()) > 0
+				for _, owner := range accessor.GetOwnerReferences() {
+					if owners[owner.UID] {
+						orphaned = false
+					}
+				}
+				if !orphaned {
+					remaining = append(remaining, accessor)
+					continue
+				}
+
+				err = resource.delete(accessor.GetNamespace(), accessor.GetName())
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// the remaining objects of this level own the next one
+		for _, object := range remaining {
+			owners[object.GetUID()] = true
+		}
+	}
+	return nil
+}
+
+// runAutoscalers scales the deployments targeted by an HPA.
+func (s *Simulator) runAutoscalers(ctx context.Context) error {
+	hpas, err := s.Client.AutoscalingV2beta2().HorizontalPodAutoscalers(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, hpa := range hpas.Items {
+		hpa := hpa
+		deployment, err := s.Client.AppsV1().Deployments(hpa.Namespace).Get(ctx, hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		// HPAs don't scale up deployments which were scaled to zero
+		current := effectiveReplicas(deployment.Spec.Replicas)
+		if current == 0 {
+			continue
+		}
+
+		desired := current
+		if s.config.HPAReplicas != nil {
+			desired = s.config.HPAReplicas(&hpa)
+		}
+		minReplicas := int32(1)
+		if hpa.Spec.MinReplicas != nil {
+			minReplicas = *hpa.Spec.MinReplicas
+		}
+		if desired < minReplicas {
+			desired = minReplicas
+		}
+		if desired > hpa.Spec.MaxReplicas {
+			desired = hpa.Spec.MaxReplicas
+		}
+
+		if desired != current {
+			deployment.Spec.Replicas = &desired
+			_, err = s.Client.AppsV1().Deployments(deployment.Namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+		}
+
+		if hpa.Status.CurrentReplicas != current || hpa.Status.DesiredReplicas != desired {
+			hpa.Status.CurrentReplicas = current
+			hpa.Status.DesiredReplicas = desired
+			_, err = s.Client.AutoscalingV2beta2().HorizontalPodAutoscalers(hpa.Namespace).UpdateStatus(ctx, &hpa, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rolloutDeployments updates the status of the deployments. The pods of a
+// deployment become ready ReadyAfterTicks after its template or its
+// replicas changed, scaling down is immediate.
+func (s *Simulator) rolloutDeployments(ctx context.Context) error {
+	deployments, err := s.Client.AppsV1().Deployments(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(deployments.Items))
+	for _, deployment := range deployments.Items {
+		deployment := deployment
+		key := deployment.Namespace + "/" + deployment.Name
+		seen[key] = true
+
+		replicas := effectiveReplicas(deployment.Spec.Replicas)
+		ready := deployment.Status.ReadyReplicas
+
+		progress, ok := s.progress[key]
+		switch {
+		case !ok || !reflect.DeepEqual(progress.template, deployment.Spec.Template):
+			// a new template replaces all the pods
+			progress = &deploymentProgress{template: deployment.Spec.Template, since: s.tick}
+			s.progress[key] = progress
+			ready = 0
+		case replicas > progress.replicas:
+			progress.since = s.tick
+		}
+		progress.replicas = replicas
+
+		if ready > replicas {
+			ready = replicas
+		}
+		if s.tick-progress.since >= s.config.ReadyAfterTicks && (s.config.PodsReady == nil || s.config.PodsReady(&deployment)) {
+			ready = replicas
+		}
+
+		status := apps.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			ReadyReplicas:      ready,
+			AvailableReplicas:  ready,
+		}
+		if reflect.DeepEqual(deployment.Status, status) {
+			continue
+		}
+		deployment.Status = status
+		_, err = s.Client.AppsV1().Deployments(deployment.Namespace).UpdateStatus(ctx, &deployment, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	for key := range s.progress {
+		if !seen[key] {
+			delete(s.progress, key)
+		}
+	}
+	return nil
+}
+
+// runJobs finishes the Jobs which are still running, they either succeed or
+// fail according to JobSucceeded.
+func (s *Simulator) runJobs(ctx context.Context) error {
+	jobs, err := s.Client.BatchV1().Jobs(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs.Items {
+		job := job
+		if len(job.Status.Conditions) > 0 {
+			continue
+		}
+
+		condition := batch.JobCondition{
+			Type:               batch.JobComplete,
+			Status:             v1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(s.Clock.Now()),
+		}
+		if s.config.JobSucceeded != nil && !s.config.JobSucceeded(&job) {
+			condition.Type = batch.JobFailed
+			job.Status.Failed = 1
+		} else {
+			job.Status.Succeeded = 1
+		}
+		job.Status.Conditions = []batch.JobCondition{condition}
+
+		_, err = s.Client.BatchV1().Jobs(job.Namespace).UpdateStatus(ctx, &job, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignLoadBalancers sets the load balancer in the status of the ingresses
+// and routegroups, like the ingress controllers do once they accepted them.
+func (s *Simulator) assignLoadBalancers(ctx context.Context) error {
+	ingresses, err := s.Client.NetworkingV1().Ingresses(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, ingress := range ingresses.Items {
+		ingress := ingress
+		if len(ingress.Status.LoadBalancer.Ingress) > 0 {
+			continue
+		}
+		ingress.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: simulatorLoadBalancer}}
+		_, err = s.Client.NetworkingV1().Ingresses(ingress.Namespace).UpdateStatus(ctx, &ingress, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	routeGroups, err := s.Client.RouteGroupV1().RouteGroups(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, rg := range routeGroups.Items {
+		rg := rg
+		if len(rg.Status.LoadBalancer.RouteGroup) > 0 {
+			continue
+		}
+		rg.Status.LoadBalancer.RouteGroup = []rgv1.RouteGroupLoadBalancer{{Hostname: simulatorLoadBalancer}}
+		_, err = s.Client.RouteGroupV1().RouteGroups(rg.Namespace).UpdateStatus(ctx, &rg, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effectiveReplicas returns the replicas of a deployment, which default to
+// one if they're not set.
+func effectiveReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
@@ -0,0 +1,422 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const simulatorNamespace = "default"
+
+func simulatorStackSet(name, version string, replicas int32) *zv1.StackSet {
+	return &zv1.StackSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: simulatorNamespace,
+		},
+		Spec: zv1.StackSetSpec{
+			Ingress: &zv1.StackSetIngressSpec{
+				Hosts:       []string{name + ".example.org"},
+				BackendPort: intstr.FromInt(80),
+			},
+			StackTemplate: zv1.StackTemplate{
+				Spec: zv1.StackSpecTemplate{
+					Version: version,
+					StackSpec: zv1.StackSpec{
+						Replicas: &replicas,
+						PodTemplate: zv1.PodTemplateSpec{
+							Spec: v1.PodSpec{
+								Containers: []v1.Container{
+									{
+										Name:  "skipper",
+										Image: "skipper:" + version,
+										Ports: []v1.ContainerPort{{ContainerPort: 80}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newTestSimulator(t *testing.T, config SimulatorConfig) *Simulator {
+	config.ClusterDomains = []string{"example.org"}
+	sim, err := NewSimulator(config)
+	require.NoError(t, err)
+	return sim
+}
+
+func createSimulatedStackSet(t *testing.T, sim *Simulator, stackset *zv1.StackSet) {
+	_, err := sim.Client.ZalandoV1().StackSets(stackset.Namespace).Create(context.Background(), stackset, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
+
+// updateSimulatedStackSet applies the update to the current version of the
+// stackset.
+func updateSimulatedStackSet(t *testing.T, sim *Simulator, name string, update func(stackset *zv1.StackSet)) {
+	stackset, err := sim.Client.ZalandoV1().StackSets(simulatorNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	update(stackset)
+	_, err = sim.Client.ZalandoV1().StackSets(simulatorNamespace).Update(context.Background(), stackset, metav1.UpdateOptions{})
+	require.NoError(t, err)
+}
+
+func setSimulatedTraffic(t *testing.T, sim *Simulator, name string, weights map[string]float64) {
+	updateSimulatedStackSet(t, sim, name, func(stackset *zv1.StackSet) {
+		stackset.Spec.Traffic = nil
+		for stack, weight := range weights {
+			stackset.Spec.Traffic = append(stackset.Spec.Traffic, &zv1.DesiredTraffic{StackName: stack, Weight: weight})
+		}
+	})
+}
+
+// stackSetTraffic returns the desired and the actual traffic of the
+// stackset, stacks without traffic are omitted.
+func stackSetTraffic(sim *Simulator, name string) (map[string]float64, map[string]float64, error) {
+	stackset, err := sim.Client.ZalandoV1().StackSets(simulatorNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	desired := make(map[string]float64)
+	for _, traffic := range stackset.Spec.Traffic {
+		if traffic.Weight > 0 {
+			desired[traffic.StackName] = traffic.Weight
+		}
+	}
+	actual := make(map[string]float64)
+	for _, traffic := range stackset.Status.Traffic {
+		if traffic.Weight > 0 {
+			actual[traffic.StackName] = traffic.Weight
+		}
+	}
+	return desired, actual, nil
+}
+
+// trafficSwitched returns a condition checking that both the desired and
+// the actual traffic of the stackset are the expected one.
+func trafficSwitched(sim *Simulator, name string, expected map[string]float64) func() (bool, error) {
+	return func() (bool, error) {
+		desired, actual, err := stackSetTraffic(sim, name)
+		if err != nil {
+			return false, err
+		}
+		return reflect.DeepEqual(desired, expected) && reflect.DeepEqual(actual, expected), nil
+	}
+}
+
+func stackReady(sim *Simulator, name string) func() (bool, error) {
+	return func() (bool, error) {
+		deployment, err := sim.Client.AppsV1().Deployments(simulatorNamespace).Get(context.Background(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		replicas := effectiveReplicas(deployment.Spec.Replicas)
+		return replicas > 0 && deployment.Status.ReadyReplicas == replicas, nil
+	}
+}
+
+func resourceExists(t *testing.T, err error) bool {
+	if errors.IsNotFound(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func TestSimulatorTrafficSwitch(t *testing.T) {
+	ctx := context.Background()
+	sim := newTestSimulator(t, SimulatorConfig{ReadyAfterTicks: 3})
+
+	createSimulatedStackSet(t, sim, simulatorStackSet("foo", "v1", 1))
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})))
+
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v2"
+	})
+	require.NoError(t, sim.RunUntil(ctx, 10, stackReady(sim, "foo-v2")))
+
+	// the new stack doesn't get traffic until it's switched
+	done, err := trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})()
+	require.NoError(t, err)
+	require.True(t, done)
+
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v1": 50, "foo-v2": 50})
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 50, "foo-v2": 50})))
+
+	ingress, err := sim.Client.NetworkingV1().Ingresses(simulatorNamespace).Get(ctx, "foo", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, ingress.Spec.Rules[0].HTTP.Paths, 2)
+	require.Equal(t, simulatorLoadBalancer, ingress.Status.LoadBalancer.Ingress[0].Hostname)
+
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v2": 100})
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v2": 100})))
+}
+
+func TestSimulatorBrokenStack(t *testing.T) {
+	ctx := context.Background()
+	sim := newTestSimulator(t, SimulatorConfig{
+		PodsReady: func(deployment *apps.Deployment) bool {
+			return deployment.Name != "foo-v2"
+		},
+	})
+
+	createSimulatedStackSet(t, sim, simulatorStackSet("foo", "v1", 1))
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})))
+
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v2"
+	})
+	require.NoError(t, sim.Run(ctx, 3))
+
+	// the traffic isn't switched to a stack which never becomes ready
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v2": 100})
+	require.NoError(t, sim.Run(ctx, 10))
+
+	_, actual, err := stackSetTraffic(sim, "foo")
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"foo-v1": 100}, actual)
+
+	// and the conditions tell why
+	stackset, err := sim.Client.ZalandoV1().StackSets(simulatorNamespace).Get(ctx, "foo", metav1.GetOptions{})
+	require.NoError(t, err)
+	reconciled := meta.FindStatusCondition(stackset.Status.Conditions, zv1.StackSetConditionTrafficReconciled)
+	require.NotNil(t, reconciled)
+	require.Equal(t, metav1.ConditionFalse, reconciled.Status)
+	require.Equal(t, "Failed to switch traffic: stacks not ready: foo-v2", reconciled.Message)
+
+	stack, err := sim.Client.ZalandoV1().Stacks(simulatorNamespace).Get(ctx, "foo-v2", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.True(t, meta.IsStatusConditionFalse(stack.Status.Conditions, zv1.StackConditionReady))
+	require.Equal(t, "WaitingForReadiness", meta.FindStatusCondition(stack.Status.Conditions, zv1.StackConditionTrafficSwitching).Reason)
+
+	// the blocked switch is recorded once in the history
+	var blocked []zv1.TrafficSwitch
+	for _, entry := range stackset.Status.TrafficHistory {
+		if entry.Result == zv1.TrafficSwitchBlocked {
+			blocked = append(blocked, entry)
+		}
+	}
+	require.Len(t, blocked, 1)
+	require.Equal(t, "stacks not ready: foo-v2", blocked[0].Message)
+
+	// switching the traffic back to the working stack isn't blocked
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v1": 100})
+	require.NoError(t, sim.RunUntil(ctx, 2, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})))
+}
+
+func TestSimulatorStackGC(t *testing.T) {
+	ctx := context.Background()
+	sim := newTestSimulator(t, SimulatorConfig{})
+
+	limit := int32(3)
+	ttl := int64(15)
+	stackset := simulatorStackSet("foo", "v0", 1)
+	stackset.Spec.Ingress = nil
+	stackset.Spec.StackLifecycle = zv1.StackLifecycle{Limit: &limit, ScaledownTTLSeconds: &ttl}
+	createSimulatedStackSet(t, sim, stackset)
+	require.NoError(t, sim.Run(ctx, 2))
+
+	for i := 1; i < 5; i++ {
+		updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+			stackset.Spec.StackTemplate.Spec.Version = fmt.Sprintf("v%d", i)
+		})
+		require.NoError(t, sim.Run(ctx, 2))
+	}
+
+	// the oldest stacks are deleted together with their resources
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("foo-v%d", i)
+
+		_, err := sim.Client.ZalandoV1().Stacks(simulatorNamespace).Get(ctx, name, metav1.GetOptions{})
+		require.Equal(t, i >= 2, resourceExists(t, err), name)
+
+		_, err = sim.Client.AppsV1().Deployments(simulatorNamespace).Get(ctx, name, metav1.GetOptions{})
+		require.Equal(t, i >= 2, resourceExists(t, err), name)
+	}
+}
+
+func TestSimulatorPrescaling(t *testing.T) {
+	ctx := context.Background()
+	sim := newTestSimulator(t, SimulatorConfig{ReadyAfterTicks: 1})
+
+	stackset := simulatorStackSet("foo", "v1", 3)
+	stackset.Annotations = map[string]string{
+		PrescaleStacksAnnotationKey:           "",
+		ResetHPAMinReplicasDelayAnnotationKey: "1m",
+	}
+	createSimulatedStackSet(t, sim, stackset)
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})))
+
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v2"
+	})
+	require.NoError(t, sim.RunUntil(ctx, 10, stackReady(sim, "foo-v2")))
+
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v1": 50, "foo-v2": 50})
+	require.NoError(t, sim.RunUntil(ctx, 20, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 50, "foo-v2": 50})))
+
+	// the third stack only has a single replica
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		replicas := int32(1)
+		stackset.Spec.StackTemplate.Spec.Version = "v3"
+		stackset.Spec.StackTemplate.Spec.Replicas = &replicas
+	})
+	require.NoError(t, sim.RunUntil(ctx, 10, stackReady(sim, "foo-v3")))
+
+	deployment, err := sim.Client.AppsV1().Deployments(simulatorNamespace).Get(ctx, "foo-v3", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, *deployment.Spec.Replicas)
+
+	// it's prescaled to the replicas of the stacks it gets the traffic
+	// from before the traffic is switched
+	desired := map[string]float64{"foo-v1": 25, "foo-v2": 25, "foo-v3": 50}
+	setSimulatedTraffic(t, sim, "foo", desired)
+	require.NoError(t, sim.RunUntil(ctx, 20, trafficSwitched(sim, "foo", desired)))
+
+	deployment, err = sim.Client.AppsV1().Deployments(simulatorNamespace).Get(ctx, "foo-v3", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.EqualValues(t, 3, *deployment.Spec.Replicas)
+
+	// and scaled down once the prescaling timed out
+	require.NoError(t, sim.RunUntil(ctx, 10, func() (bool, error) {
+		deployment, err := sim.Client.AppsV1().Deployments(simulatorNamespace).Get(ctx, "foo-v3", metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return *deployment.Spec.Replicas == 1, nil
+	}))
+}
+
+func TestSimulatorIngressSourceSwitch(t *testing.T) {
+	ctx := context.Background()
+	sim := newTestSimulator(t, SimulatorConfig{IngressSourceSwitchTTL: time.Minute})
+
+	createSimulatedStackSet(t, sim, simulatorStackSet("foo", "v1", 1))
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})))
+
+	// add a routegroup next to the ingress
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v2"
+		stackset.Spec.RouteGroup = &zv1.RouteGroupSpec{
+			Hosts:       []string{"foo.example.org"},
+			BackendPort: 80,
+		}
+	})
+	require.NoError(t, sim.RunUntil(ctx, 10, func() (bool, error) {
+		rg, err := sim.Client.RouteGroupV1().RouteGroups(simulatorNamespace).Get(ctx, "foo", metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil && len(rg.Status.LoadBalancer.RouteGroup) > 0, err
+	}))
+
+	// remove the ingress, it's kept until the routegroup exists for
+	// longer than the TTL
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v3"
+		stackset.Spec.RouteGroup.AdditionalBackends = []rgv1.RouteGroupBackend{{Name: "shunt", Type: rgv1.ShuntRouteGroupBackend}}
+		stackset.Spec.Ingress = nil
+	})
+	require.NoError(t, sim.Run(ctx, 1))
+
+	_, err := sim.Client.NetworkingV1().Ingresses(simulatorNamespace).Get(ctx, "foo", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, sim.RunUntil(ctx, 2*int(time.Minute/defaultSimulatorTickInterval), func() (bool, error) {
+		_, err := sim.Client.NetworkingV1().Ingresses(simulatorNamespace).Get(ctx, "foo", metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}))
+}
+
+func TestSimulatorTrafficHooks(t *testing.T) {
+	ctx := context.Background()
+	sim := newTestSimulator(t, SimulatorConfig{
+		JobSucceeded: func(job *batch.Job) bool {
+			return job.Name != "foo-v3-pre-traffic-switch"
+		},
+	})
+
+	hook := &zv1.TrafficHookJobSpec{
+		PodTemplate: zv1.TrafficHookPodTemplate{PodTemplateSpec: zv1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "smoke-test", Image: "smoke-test"}},
+			},
+		}},
+	}
+	stackset := simulatorStackSet("foo", "v1", 1)
+	stackset.Spec.TrafficHooks = &zv1.TrafficHooks{
+		PreTrafficSwitch:  hook,
+		PostTrafficSwitch: hook,
+	}
+	createSimulatedStackSet(t, sim, stackset)
+	require.NoError(t, sim.RunUntil(ctx, 10, trafficSwitched(sim, "foo", map[string]float64{"foo-v1": 100})))
+
+	// the first stack gets the traffic right away
+	_, err := sim.Client.BatchV1().Jobs(simulatorNamespace).Get(ctx, "foo-v1-pre-traffic-switch", metav1.GetOptions{})
+	require.False(t, resourceExists(t, err))
+
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v2"
+	})
+	require.NoError(t, sim.RunUntil(ctx, 10, stackReady(sim, "foo-v2")))
+
+	// the traffic is switched once the smoke tests succeeded
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v2": 100})
+	require.NoError(t, sim.RunUntil(ctx, 5, trafficSwitched(sim, "foo", map[string]float64{"foo-v2": 100})))
+
+	job, err := sim.Client.BatchV1().Jobs(simulatorNamespace).Get(ctx, "foo-v2-pre-traffic-switch", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "foo-v2", job.OwnerReferences[0].Name)
+	require.Contains(t, job.Spec.Template.Spec.Containers[0].Env, v1.EnvVar{Name: "STACK_HOSTNAMES", Value: "foo-v2.example.org"})
+
+	require.NoError(t, sim.RunUntil(ctx, 2, func() (bool, error) {
+		_, err := sim.Client.BatchV1().Jobs(simulatorNamespace).Get(ctx, "foo-v2-post-traffic-switch", metav1.GetOptions{})
+		return resourceExists(t, err), nil
+	}))
+
+	// a failing smoke test blocks the traffic switch
+	updateSimulatedStackSet(t, sim, "foo", func(stackset *zv1.StackSet) {
+		stackset.Spec.StackTemplate.Spec.Version = "v3"
+	})
+	require.NoError(t, sim.RunUntil(ctx, 10, stackReady(sim, "foo-v3")))
+	setSimulatedTraffic(t, sim, "foo", map[string]float64{"foo-v3": 100})
+	require.NoError(t, sim.Run(ctx, 5))
+
+	_, actual, err := stackSetTraffic(sim, "foo")
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"foo-v2": 100}, actual)
+	require.Contains(t, sim.Events(), "Warning TrafficNotSwitched foo: Failed to switch traffic: pre traffic switch hook failed: foo-v3")
+
+	stack, err := sim.Client.ZalandoV1().Stacks(simulatorNamespace).Get(ctx, "foo-v3", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "PreTrafficSwitchHookFailed", meta.FindStatusCondition(stack.Status.Conditions, zv1.StackConditionTrafficSwitching).Reason)
+
+	// the jobs are deleted with their stacks
+	require.NoError(t, sim.Client.ZalandoV1().Stacks(simulatorNamespace).Delete(ctx, "foo-v3", metav1.DeleteOptions{}))
+	require.NoError(t, sim.Run(ctx, 1))
+	_, err = sim.Client.BatchV1().Jobs(simulatorNamespace).Get(ctx, "foo-v3-pre-traffic-switch", metav1.GetOptions{})
+	require.False(t, resourceExists(t, err))
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	"github.com/zalando-incubator/stackset-controller/pkg/core"
 	apps "k8s.io/api/apps/v1"
 	"k8s.io/api/autoscaling/v2beta2"
+	batch "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -293,3 +295,89 @@ func (c *StackSetController) ReconcileStackRouteGroup(ctx context.Context, stack
 		routegroup.Name)
 	return nil
 }
+
+func (c *StackSetController) ReconcileStackHTTPRoute(ctx context.Context, stack *zv1.Stack, existing *gatewayv1.HTTPRoute, generateUpdated func() (*gatewayv1.HTTPRoute, error)) error {
+	httproute, err := generateUpdated()
+	if err != nil {
+		return err
+	}
+
+	// HTTPRoute removed
+	if httproute == nil {
+		if existing != nil {
+			err := c.client.GatewayV1().HTTPRoutes(existing.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{})
+			if err != nil {
+				return err
+			}
+			c.recorder.Eventf(
+				stack,
+				apiv1.EventTypeNormal,
+				"DeletedHTTPRoute",
+				"Deleted HTTPRoute %s",
+				existing.Name)
+		}
+		return nil
+	}
+
+	// Create new HTTPRoute
+	if existing == nil {
+		_, err := c.client.GatewayV1().HTTPRoutes(httproute.Namespace).Create(ctx, httproute, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		c.recorder.Eventf(
+			stack,
+			apiv1.EventTypeNormal,
+			"CreatedHTTPRoute",
+			"Created HTTPRoute %s",
+			httproute.Name)
+		return nil
+	}
+
+	// Check if we need to update the HTTPRoute
+	if core.IsResourceUpToDate(stack, existing.ObjectMeta) {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	syncObjectMeta(updated, httproute)
+	updated.Spec = httproute.Spec
+
+	_, err = c.client.GatewayV1().HTTPRoutes(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"UpdatedHTTPRoute",
+		"Updated HTTPRoute %s",
+		httproute.Name)
+	return nil
+}
+
+// ReconcileStackJob creates the Job of a traffic hook once it's generated.
+// Jobs are run once per stack, they're neither updated nor deleted, the
+// garbage collection deletes them with the stack.
+func (c *StackSetController) ReconcileStackJob(ctx context.Context, stack *zv1.Stack, existing *batch.Job, generateUpdated func() *batch.Job) error {
+	if existing != nil {
+		return nil
+	}
+
+	job := generateUpdated()
+	if job == nil {
+		return nil
+	}
+
+	_, err := c.client.BatchV1().Jobs(job.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	c.recorder.Eventf(
+		stack,
+		apiv1.EventTypeNormal,
+		"CreatedJob",
+		"Created Job %s",
+		job.Name)
+	return nil
+}
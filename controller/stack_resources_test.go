@@ -6,9 +6,11 @@ import (
 
 	"github.com/stretchr/testify/require"
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	apps "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	batch "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -887,3 +889,206 @@ func TestReconcileStackRouteGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileStackHTTPRoute(t *testing.T) {
+	port := int32(80)
+	weight := int32(100)
+	exampleSpec := gatewayv1.HTTPRouteSpec{
+		ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+		Hostnames:  []string{"example.org"},
+		Rules: []gatewayv1.HTTPRouteRule{
+			{
+				BackendRefs: []gatewayv1.HTTPBackendRef{
+					{
+						BackendRef: gatewayv1.BackendRef{
+							BackendObjectReference: gatewayv1.BackendObjectReference{
+								Name: "foo",
+								Port: &port,
+							},
+							Weight: &weight,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	exampleUpdatedSpec := *exampleSpec.DeepCopy()
+	exampleUpdatedSpec.Hostnames = []string{"example.com"}
+
+	for _, tc := range []struct {
+		name     string
+		stack    zv1.Stack
+		existing *gatewayv1.HTTPRoute
+		updated  *gatewayv1.HTTPRoute
+		expected *gatewayv1.HTTPRoute
+	}{
+		{
+			name:  "httproute is created if it doesn't exist",
+			stack: baseTestStack,
+			updated: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleSpec,
+			},
+			expected: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleSpec,
+			},
+		},
+		{
+			name:  "httproute is removed if it is no longer needed",
+			stack: baseTestStack,
+			existing: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleSpec,
+			},
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name:  "httproute is updated if the stack changes",
+			stack: updatedTestStack,
+			existing: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleSpec,
+			},
+			updated: &gatewayv1.HTTPRoute{
+				ObjectMeta: updatedTestStackOwned,
+				Spec:       exampleUpdatedSpec,
+			},
+			expected: &gatewayv1.HTTPRoute{
+				ObjectMeta: updatedTestStackOwned,
+				Spec:       exampleUpdatedSpec,
+			},
+		},
+		{
+			name:  "httproute is not updated if the stack version remains the same",
+			stack: baseTestStack,
+			existing: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleSpec,
+			},
+			updated: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleUpdatedSpec,
+			},
+			expected: &gatewayv1.HTTPRoute{
+				ObjectMeta: baseTestStackOwned,
+				Spec:       exampleSpec,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{testStackSet})
+			require.NoError(t, err)
+
+			err = env.CreateStacks(context.Background(), []zv1.Stack{tc.stack})
+			require.NoError(t, err)
+
+			if tc.existing != nil {
+				err = env.CreateHTTPRoutes(context.Background(), []gatewayv1.HTTPRoute{*tc.existing})
+				require.NoError(t, err)
+			}
+
+			err = env.controller.ReconcileStackHTTPRoute(context.Background(), &tc.stack, tc.existing, func() (*gatewayv1.HTTPRoute, error) {
+				return tc.updated, nil
+			})
+			require.NoError(t, err)
+
+			updated, err := env.client.GatewayV1().HTTPRoutes(tc.stack.Namespace).Get(context.Background(), tc.stack.Name, metav1.GetOptions{})
+			if tc.expected != nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, updated)
+			} else {
+				require.True(t, errors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func TestReconcileStackJob(t *testing.T) {
+	jobMeta := *baseTestStackOwned.DeepCopy()
+	jobMeta.Name = "foo-v1-pre-traffic-switch"
+
+	exampleSpec := batch.JobSpec{
+		Template: v1.PodTemplateSpec{
+			Spec: v1.PodSpec{
+				RestartPolicy: v1.RestartPolicyNever,
+				Containers:    []v1.Container{{Name: "smoke-test", Image: "smoke-test:v1"}},
+			},
+		},
+	}
+
+	exampleUpdatedSpec := *exampleSpec.DeepCopy()
+	exampleUpdatedSpec.Template.Spec.Containers[0].Image = "smoke-test:v2"
+
+	for _, tc := range []struct {
+		name     string
+		stack    zv1.Stack
+		existing *batch.Job
+		updated  *batch.Job
+		expected *batch.Job
+	}{
+		{
+			name:  "job is created if it doesn't exist",
+			stack: baseTestStack,
+			updated: &batch.Job{
+				ObjectMeta: jobMeta,
+				Spec:       exampleSpec,
+			},
+			expected: &batch.Job{
+				ObjectMeta: jobMeta,
+				Spec:       exampleSpec,
+			},
+		},
+		{
+			name:     "job is not created if it's not needed yet",
+			stack:    baseTestStack,
+			updated:  nil,
+			expected: nil,
+		},
+		{
+			name:  "job is neither updated nor deleted once it exists",
+			stack: updatedTestStack,
+			existing: &batch.Job{
+				ObjectMeta: jobMeta,
+				Spec:       exampleSpec,
+			},
+			updated: nil,
+			expected: &batch.Job{
+				ObjectMeta: jobMeta,
+				Spec:       exampleSpec,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{testStackSet})
+			require.NoError(t, err)
+
+			err = env.CreateStacks(context.Background(), []zv1.Stack{tc.stack})
+			require.NoError(t, err)
+
+			if tc.existing != nil {
+				_, err = env.client.BatchV1().Jobs(tc.existing.Namespace).Create(context.Background(), tc.existing, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			err = env.controller.ReconcileStackJob(context.Background(), &tc.stack, tc.existing, func() *batch.Job {
+				return tc.updated
+			})
+			require.NoError(t, err)
+
+			updated, err := env.client.BatchV1().Jobs(tc.stack.Namespace).Get(context.Background(), jobMeta.Name, metav1.GetOptions{})
+			if tc.expected != nil {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, updated)
+			} else {
+				require.True(t, errors.IsNotFound(err))
+			}
+		})
+	}
+}
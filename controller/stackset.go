@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,23 +15,32 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/analysis"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
 	"github.com/zalando-incubator/stackset-controller/pkg/core"
 	"github.com/zalando-incubator/stackset-controller/pkg/recorder"
-	"golang.org/x/sync/errgroup"
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	batch "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
 	kube_record "k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const (
@@ -44,35 +54,43 @@ const (
 
 	reasonFailedManageStackSet = "FailedManageStackSet"
 
-	defaultResetMinReplicasDelay = 10 * time.Minute
+	defaultResetMinReplicasDelay   = 10 * time.Minute
+	defaultProgressiveStepDuration = time.Minute
 )
 
 // StackSetController is the main controller. It watches for changes to
-// stackset resources and starts and maintains other controllers per
-// stackset resource.
+// stackset resources and the resources they own, and reconciles every
+// changed stackset independently from a work queue.
 type StackSetController struct {
 	logger                      *log.Entry
 	client                      clientset.Interface
 	controllerID                string
 	backendWeightsAnnotationKey string
 	clusterDomains              []string
+	namespaces                  []string
+	stacksetSelector            labels.Selector
 	interval                    time.Duration
-	stacksetEvents              chan stacksetEvent
+	reconcileWorkers            int
+	queue                       workqueue.RateLimitingInterface
 	stacksetStore               map[types.UID]zv1.StackSet
+	stacksetContainers          map[types.UID]*core.StackSetContainer
+	informers                   *resourceInformers
+	leaderElection              *LeaderElectionConfig
+	leaderElectionHealth        *leaderelection.HealthzAdaptor
+	leading                     bool
 	recorder                    kube_record.EventRecorder
 	metricsReporter             *core.MetricsReporter
 	HealthReporter              healthcheck.Handler
 	routeGroupSupportEnabled    bool
+	httpRouteSupportEnabled     bool
 	ingressSourceSwitchTTL      time.Duration
-	now                         func() string
+	trafficAnalysisAddress      string
+	trafficBackends             []core.TrafficBackend
+	newMetricsProvider          func(address string) (core.MetricsProvider, error)
+	clock                       clock.Clock
 	sync.Mutex
 }
 
-type stacksetEvent struct {
-	Deleted  bool
-	StackSet *zv1.StackSet
-}
-
 // eventedError wraps an error that was already exposed as an event to the user
 type eventedError struct {
 	err error
@@ -82,33 +100,72 @@ func (ee *eventedError) Error() string {
 	return ee.err.Error()
 }
 
-func now() string {
-	return time.Now().Format(time.RFC3339)
+// now returns the current time of the controller's clock in the format used
+// for the timestamp annotations.
+func (c *StackSetController) now() string {
+	return c.clock.Now().Format(time.RFC3339)
 }
 
 // NewStackSetController initializes a new StackSetController.
-func NewStackSetController(client clientset.Interface, controllerID, backendWeightsAnnotationKey string, clusterDomains []string, registry prometheus.Registerer, interval time.Duration, routeGroupSupportEnabled bool, ingressSourceSwitchTTL time.Duration) (*StackSetController, error) {
+func NewStackSetController(client clientset.Interface, controllerID, backendWeightsAnnotationKey string, clusterDomains, namespaces []string, stacksetSelector labels.Selector, registry prometheus.Registerer, interval time.Duration, reconcileWorkers int, routeGroupSupportEnabled, httpRouteSupportEnabled bool, ingressSourceSwitchTTL time.Duration, trafficAnalysisAddress string, leaderElection *LeaderElectionConfig) (*StackSetController, error) {
 	metricsReporter, err := core.NewMetricsReporter(registry)
 	if err != nil {
 		return nil, err
 	}
 
-	return &StackSetController{
+	if stacksetSelector == nil {
+		stacksetSelector = labels.Everything()
+	}
+
+	trafficBackends := []core.TrafficBackend{core.IngressTrafficBackend{}}
+	if routeGroupSupportEnabled {
+		trafficBackends = append(trafficBackends, core.RouteGroupTrafficBackend{})
+	}
+	if httpRouteSupportEnabled {
+		trafficBackends = append(trafficBackends, core.HTTPRouteTrafficBackend{})
+	}
+
+	c := &StackSetController{
 		logger:                      log.WithFields(log.Fields{"controller": "stackset"}),
 		client:                      client,
 		controllerID:                controllerID,
 		backendWeightsAnnotationKey: backendWeightsAnnotationKey,
 		clusterDomains:              clusterDomains,
+		namespaces:                  namespaces,
+		stacksetSelector:            stacksetSelector,
 		interval:                    interval,
-		stacksetEvents:              make(chan stacksetEvent, 1),
+		reconcileWorkers:            reconcileWorkers,
+		queue:                       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "stacksets"),
 		stacksetStore:               make(map[types.UID]zv1.StackSet),
+		stacksetContainers:          make(map[types.UID]*core.StackSetContainer),
+		informers:                   newResourceInformers(client, namespaces, routeGroupSupportEnabled, httpRouteSupportEnabled),
+		leaderElection:              leaderElection,
+		leaderElectionHealth:        leaderelection.NewLeaderHealthzAdaptor(leaderElectionHealthTimeout),
 		recorder:                    recorder.CreateEventRecorder(client),
 		metricsReporter:             metricsReporter,
 		HealthReporter:              healthcheck.NewHandler(),
 		routeGroupSupportEnabled:    routeGroupSupportEnabled,
+		httpRouteSupportEnabled:     httpRouteSupportEnabled,
 		ingressSourceSwitchTTL:      ingressSourceSwitchTTL,
-		now:                         now,
-	}, nil
+		trafficAnalysisAddress:      trafficAnalysisAddress,
+		trafficBackends:             trafficBackends,
+		newMetricsProvider:          newPrometheusProvider,
+		clock:                       clock.RealClock{},
+	}
+
+	// Changes to the resources owned by a stackset make it reconciled
+	c.informers.addEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueOwner,
+		UpdateFunc: func(_, newObj interface{}) {
+			c.enqueueOwner(newObj)
+		},
+		DeleteFunc: c.enqueueOwner,
+	})
+	return c, nil
+}
+
+func newPrometheusProvider(address string) (core.MetricsProvider, error) {
+	return analysis.NewPrometheusProvider(address)
 }
 
 func (c *StackSetController) stacksetLogger(ssc *core.StackSetContainer) *log.Entry {
@@ -127,84 +184,72 @@ func (c *StackSetController) stackLogger(ssc *core.StackSetContainer, sc *core.S
 }
 
 // Run runs the main loop of the StackSetController. Before the loops it
-// sets up a watcher to watch StackSet resources. The watch will send
-// changes over a channel which is polled from the main loop.
+// starts the informers caching the resources owned by the stacksets and
+// sets up a watcher to watch StackSet resources. Changed stacksets are
+// queued and reconciled by the workers, which only run on the leader if
+// leader election is enabled. The main loop requeues all the stacksets and
+// reports the metrics periodically.
 func (c *StackSetController) Run(ctx context.Context) {
 	var nextCheck time.Time
 
+	defer c.queue.ShutDown()
+
 	// We're not alive if nextCheck is too far in the past
 	c.HealthReporter.AddLivenessCheck("nextCheck", func() error {
-		if time.Since(nextCheck) > 5*c.interval {
+		if c.clock.Since(nextCheck) > 5*c.interval {
 			return fmt.Errorf("nextCheck too old")
 		}
 		return nil
 	})
 
+	err := c.informers.run(ctx)
+	if err != nil {
+		c.logger.Errorf("Failed to start informers: %v", err)
+		return
+	}
+	c.logger.Info("Synced resource informers")
+
 	c.startWatch(ctx)
 
+	if c.leaderElection != nil {
+		// We're not alive if we're leading but failed to renew the lease
+		c.HealthReporter.AddLivenessCheck("leaderElection", func() error {
+			return c.leaderElectionHealth.Check(nil)
+		})
+		go c.runLeaderElection(ctx)
+	} else {
+		c.setLeader(true)
+		c.startWorkers(ctx)
+	}
+
 	http.HandleFunc("/healthz", c.HealthReporter.LiveEndpoint)
 
-	nextCheck = time.Now().Add(-c.interval)
+	nextCheck = c.clock.Now().Add(-c.interval)
 
 	for {
 		select {
-		case <-time.After(time.Until(nextCheck)):
+		case <-c.clock.After(nextCheck.Sub(c.clock.Now())):
 
-			nextCheck = time.Now().Add(c.interval)
+			nextCheck = c.clock.Now().Add(c.interval)
 
-			stackContainers, err := c.collectResources(ctx)
-			if err != nil {
-				c.logger.Errorf("Failed to collect resources: %v", err)
-				continue
+			// Requeue all the stacksets so time based changes, e.g.
+			// scaling down stacks without traffic, don't need an event
+			c.Lock()
+			if c.leading {
+				for uid := range c.stacksetStore {
+					c.queue.Add(uid)
+				}
 			}
-
-			var reconcileGroup errgroup.Group
-			for stackset, container := range stackContainers {
-				container := container
-
-				reconcileGroup.Go(func() error {
-					if _, ok := c.stacksetStore[stackset]; ok {
-						err := c.ReconcileStackSet(ctx, container)
-						if err != nil {
-							c.stacksetLogger(container).Errorf("unable to reconcile a stackset: %v", err)
-							return c.errorEventf(container.StackSet, reasonFailedManageStackSet, err)
-						}
-					}
-					return nil
-				})
+			stackContainers := make(map[types.UID]*core.StackSetContainer, len(c.stacksetContainers))
+			for uid, container := range c.stacksetContainers {
+				stackContainers[uid] = container
 			}
+			c.Unlock()
 
-			err = reconcileGroup.Wait()
-			if err != nil {
-				c.logger.Errorf("Failed waiting for reconcilers: %v", err)
-			}
-			err = c.metricsReporter.Report(stackContainers)
+			err := c.metricsReporter.Report(stackContainers)
 			if err != nil {
 				c.logger.Errorf("Failed reporting metrics: %v", err)
 			}
-		case e := <-c.stacksetEvents:
-			stackset := *e.StackSet
-			fixupStackSetTypeMeta(&stackset)
-
-			// update/delete existing entry
-			if _, ok := c.stacksetStore[stackset.UID]; ok {
-				if e.Deleted || !c.hasOwnership(&stackset) {
-					delete(c.stacksetStore, stackset.UID)
-					continue
-				}
-
-				// update stackset entry
-				c.stacksetStore[stackset.UID] = stackset
-				continue
-			}
-
-			// check if stackset should be managed by the controller
-			if !c.hasOwnership(&stackset) {
-				continue
-			}
-
-			c.logger.Infof("Adding entry for StackSet %s/%s", stackset.Namespace, stackset.Name)
-			c.stacksetStore[stackset.UID] = stackset
 		case <-ctx.Done():
 			c.logger.Info("Terminating main controller loop.")
 			return
@@ -212,214 +257,327 @@ func (c *StackSetController) Run(ctx context.Context) {
 	}
 }
 
-// collectResources collects resources for all stacksets at once and stores them per StackSet/Stack so that we don't
-// overload the API requests with unnecessary requests
-func (c *StackSetController) collectResources(ctx context.Context) (map[types.UID]*core.StackSetContainer, error) {
+// startWorkers starts the workers reconciling the stacksets from the queue
+// until the context is cancelled.
+func (c *StackSetController) startWorkers(ctx context.Context) {
+	for i := 0; i < c.reconcileWorkers; i++ {
+		go wait.Until(func() {
+			c.runWorker(ctx)
+		}, time.Second, ctx.Done())
+	}
+}
+
+// runWorker reconciles the stacksets from the queue until it's shut down or
+// the context is cancelled.
+func (c *StackSetController) runWorker(ctx context.Context) {
+	for c.processNextStackSet(ctx) {
+	}
+}
+
+// processNextStackSet reconciles the next stackset from the queue. If the
+// reconciliation fails, the stackset is requeued with an exponential
+// backoff.
+func (c *StackSetController) processNextStackSet(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	// Leave the stackset to the next leader
+	if ctx.Err() != nil {
+		c.queue.Add(key)
+		return false
+	}
+
+	err := c.reconcile(ctx, key.(types.UID))
+	if err != nil {
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// reconcile collects the resources of a single stackset from the informer
+// caches and reconciles it.
+func (c *StackSetController) reconcile(ctx context.Context, uid types.UID) error {
+	c.Lock()
+	stackset, ok := c.stacksetStore[uid]
+	c.Unlock()
+	if !ok {
+		return nil
+	}
+
+	container := c.newStackSetContainer(stackset)
+	err := c.collectStackSetResources(map[types.UID]*core.StackSetContainer{uid: container})
+	if err != nil {
+		c.stacksetLogger(container).Errorf("Failed to collect resources: %v", err)
+		return err
+	}
+
+	err = c.ReconcileStackSet(ctx, container)
+	if err != nil {
+		c.stacksetLogger(container).Errorf("unable to reconcile a stackset: %v", err)
+		err = c.errorEventf(container.StackSet, reasonFailedManageStackSet, err)
+	}
+
+	// Keep the reconciled state for the metrics, unless the stackset was
+	// removed or the leadership was lost in the meantime
+	c.Lock()
+	if _, ok := c.stacksetStore[uid]; ok && c.leading {
+		c.stacksetContainers[uid] = container
+	}
+	c.Unlock()
+	return err
+}
+
+// collectResources collects resources for all stacksets from the informer caches and stores them per StackSet/Stack so
+// that we don't overload the API server with unnecessary requests
+func (c *StackSetController) collectResources() (map[types.UID]*core.StackSetContainer, error) {
+	c.Lock()
 	stacksets := make(map[types.UID]*core.StackSetContainer, len(c.stacksetStore))
 	for uid, stackset := range c.stacksetStore {
-		stackset := stackset
+		stacksets[uid] = c.newStackSetContainer(stackset)
+	}
+	c.Unlock()
+
+	err := c.collectStackSetResources(stacksets)
+	if err != nil {
+		return nil, err
+	}
+	return stacksets, nil
+}
 
-		reconciler := core.TrafficReconciler(&core.SimpleTrafficReconciler{})
+// newStackSetContainer creates the container of a stackset with the traffic
+// reconciler it's configured for.
+func (c *StackSetController) newStackSetContainer(stackset zv1.StackSet) *core.StackSetContainer {
+	reconciler := core.TrafficReconciler(&core.SimpleTrafficReconciler{})
 
-		// use prescaling logic if enabled with an annotation
-		if _, ok := stackset.Annotations[PrescaleStacksAnnotationKey]; ok {
-			resetDelay := defaultResetMinReplicasDelay
-			if resetDelayValue, ok := getResetMinReplicasDelay(stackset.Annotations); ok {
-				resetDelay = resetDelayValue
-			}
-			reconciler = &core.PrescalingTrafficReconciler{
-				ResetHPAMinReplicasTimeout: resetDelay,
-			}
+	// use prescaling logic if enabled with an annotation
+	if _, ok := stackset.Annotations[PrescaleStacksAnnotationKey]; ok {
+		resetDelay := defaultResetMinReplicasDelay
+		if resetDelayValue, ok := getResetMinReplicasDelay(stackset.Annotations); ok {
+			resetDelay = resetDelayValue
 		}
+		reconciler = &core.PrescalingTrafficReconciler{
+			ResetHPAMinReplicasTimeout: resetDelay,
+		}
+	}
 
-		stacksetContainer := core.NewContainer(&stackset, reconciler, c.backendWeightsAnnotationKey, c.clusterDomains)
-		stacksets[uid] = stacksetContainer
+	// use the progressive traffic logic if a step schedule is defined, it
+	// replaces the prescaling logic as documented on the field
+	if stackset.Spec.ProgressiveTraffic != nil {
+		reconciler = newProgressiveTrafficReconciler(stackset.Spec.ProgressiveTraffic)
 	}
 
-	err := c.collectStacks(ctx, stacksets)
+	return core.NewContainer(&stackset, reconciler, c.backendWeightsAnnotationKey, c.clusterDomains, c.clock)
+}
+
+// collectStackSetResources collects the resources of the stacksets from the
+// informer caches.
+func (c *StackSetController) collectStackSetResources(stacksets map[types.UID]*core.StackSetContainer) error {
+	err := c.collectStacks(stacksets)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = c.collectIngresses(ctx, stacksets)
+	err = c.collectIngresses(stacksets)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if c.routeGroupSupportEnabled {
-		err = c.collectRouteGroups(ctx, stacksets)
+		err = c.collectRouteGroups(stacksets)
 		if err != nil {
-			return nil, err
+			return err
+		}
+	}
+
+	if c.httpRouteSupportEnabled {
+		err = c.collectHTTPRoutes(stacksets)
+		if err != nil {
+			return err
 		}
 	}
 
-	err = c.collectDeployments(ctx, stacksets)
+	err = c.collectDeployments(stacksets)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = c.collectServices(ctx, stacksets)
+	err = c.collectServices(stacksets)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = c.collectHPAs(ctx, stacksets)
+	err = c.collectHPAs(stacksets)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return stacksets, nil
+	return c.collectJobs(stacksets)
 }
 
-func (c *StackSetController) collectIngresses(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
-	ingresses, err := c.client.NetworkingV1().Ingresses(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list Ingresses: %v", err)
-	}
+func (c *StackSetController) collectIngresses(stacksets map[types.UID]*core.StackSetContainer) error {
+	for uid, stackset := range stacksets {
+		// stackset ingress
+		obj, err := ownedObject(c.informers.ingresses, uid)
+		if err != nil {
+			return fmt.Errorf("failed to get Ingresses: %v", err)
+		}
+		if ingress, ok := obj.(*networking.Ingress); ok {
+			stackset.Ingress = ingress.DeepCopy()
+		}
 
-Items:
-	for _, i := range ingresses.Items {
-		ingress := i
-		if uid, ok := getOwnerUID(ingress.ObjectMeta); ok {
-			// stackset ingress
-			if s, ok := stacksets[uid]; ok {
-				s.Ingress = &ingress
-				continue
+		// stack ingresses
+		for stackUID, s := range stackset.StackContainers {
+			obj, err := ownedObject(c.informers.ingresses, stackUID)
+			if err != nil {
+				return fmt.Errorf("failed to get Ingresses: %v", err)
 			}
-
-			// stack ingress
-			for _, stackset := range stacksets {
-				if s, ok := stackset.StackContainers[uid]; ok {
-					s.Resources.Ingress = &ingress
-					continue Items
-				}
+			if ingress, ok := obj.(*networking.Ingress); ok {
+				s.Resources.Ingress = ingress.DeepCopy()
 			}
 		}
 	}
 	return nil
 }
 
-func (c *StackSetController) collectRouteGroups(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
-	routegroups, err := c.client.RouteGroupV1().RouteGroups(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list RouteGroups: %v", err)
-	}
+func (c *StackSetController) collectRouteGroups(stacksets map[types.UID]*core.StackSetContainer) error {
+	for uid, stackset := range stacksets {
+		// stackset routegroup
+		obj, err := ownedObject(c.informers.routeGroups, uid)
+		if err != nil {
+			return fmt.Errorf("failed to get RouteGroups: %v", err)
+		}
+		if routegroup, ok := obj.(*rgv1.RouteGroup); ok {
+			stackset.RouteGroup = routegroup.DeepCopy()
+		}
 
-Items:
-	for _, rg := range routegroups.Items {
-		routegroup := rg
-		if uid, ok := getOwnerUID(routegroup.ObjectMeta); ok {
-			// stackset routegroups
-			if s, ok := stacksets[uid]; ok {
-				s.RouteGroup = &routegroup
-				continue
+		// stack routegroups
+		for stackUID, s := range stackset.StackContainers {
+			obj, err := ownedObject(c.informers.routeGroups, stackUID)
+			if err != nil {
+				return fmt.Errorf("failed to get RouteGroups: %v", err)
 			}
-
-			// stack routegroups
-			for _, stackset := range stacksets {
-				if s, ok := stackset.StackContainers[uid]; ok {
-					s.Resources.RouteGroup = &routegroup
-					continue Items
-				}
+			if routegroup, ok := obj.(*rgv1.RouteGroup); ok {
+				s.Resources.RouteGroup = routegroup.DeepCopy()
 			}
 		}
 	}
 	return nil
 }
 
-func (c *StackSetController) collectStacks(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
-	stacks, err := c.client.ZalandoV1().Stacks(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list Stacks: %v", err)
-	}
+func (c *StackSetController) collectStacks(stacksets map[types.UID]*core.StackSetContainer) error {
+	for uid, stackset := range stacksets {
+		objs, err := c.informers.stacks.byIndex(ownerUIDIndex, string(uid))
+		if err != nil {
+			return fmt.Errorf("failed to get Stacks: %v", err)
+		}
 
-	for _, stack := range stacks.Items {
-		if uid, ok := getOwnerUID(stack.ObjectMeta); ok {
-			if s, ok := stacksets[uid]; ok {
-				stack := stack
-				fixupStackTypeMeta(&stack)
+		for _, obj := range objs {
+			if s, ok := obj.(*zv1.Stack); ok {
+				stack := s.DeepCopy()
+				fixupStackTypeMeta(stack)
 
-				s.StackContainers[stack.UID] = &core.StackContainer{
-					Stack: &stack,
+				stackset.StackContainers[stack.UID] = &core.StackContainer{
+					Stack: stack,
 				}
-				continue
 			}
 		}
 	}
 	return nil
 }
 
-func (c *StackSetController) collectDeployments(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
-	deployments, err := c.client.AppsV1().Deployments(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list Deployments: %v", err)
-	}
+func (c *StackSetController) collectHTTPRoutes(stacksets map[types.UID]*core.StackSetContainer) error {
+	for uid, stackset := range stacksets {
+		// stackset httproute
+		obj, err := ownedObject(c.informers.httpRoutes, uid)
+		if err != nil {
+			return fmt.Errorf("failed to get HTTPRoutes: %v", err)
+		}
+		if httproute, ok := obj.(*gatewayv1.HTTPRoute); ok {
+			stackset.HTTPRoute = httproute.DeepCopy()
+		}
 
-	for _, d := range deployments.Items {
-		deployment := d
-		if uid, ok := getOwnerUID(deployment.ObjectMeta); ok {
-			for _, stackset := range stacksets {
-				if s, ok := stackset.StackContainers[uid]; ok {
-					s.Resources.Deployment = &deployment
-					break
-				}
+		// stack httproutes
+		for stackUID, s := range stackset.StackContainers {
+			obj, err := ownedObject(c.informers.httpRoutes, stackUID)
+			if err != nil {
+				return fmt.Errorf("failed to get HTTPRoutes: %v", err)
+			}
+			if httproute, ok := obj.(*gatewayv1.HTTPRoute); ok {
+				s.Resources.HTTPRoute = httproute.DeepCopy()
 			}
 		}
 	}
 	return nil
 }
 
-func (c *StackSetController) collectServices(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
-	services, err := c.client.CoreV1().Services(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list Services: %v", err)
+func (c *StackSetController) collectDeployments(stacksets map[types.UID]*core.StackSetContainer) error {
+	for _, stackset := range stacksets {
+		for stackUID, s := range stackset.StackContainers {
+			obj, err := ownedObject(c.informers.deployments, stackUID)
+			if err != nil {
+				return fmt.Errorf("failed to get Deployments: %v", err)
+			}
+			if deployment, ok := obj.(*apps.Deployment); ok {
+				s.Resources.Deployment = deployment.DeepCopy()
+			}
+		}
 	}
+	return nil
+}
 
-Items:
-	for _, s := range services.Items {
-		service := s
-		if uid, ok := getOwnerUID(service.ObjectMeta); ok {
-			for _, stackset := range stacksets {
-				if s, ok := stackset.StackContainers[uid]; ok {
-					s.Resources.Service = &service
-					continue Items
-				}
-
-				// service/HPA used to be owned by the deployment for some reason
-				for _, stack := range stackset.StackContainers {
-					if stack.Resources.Deployment != nil && stack.Resources.Deployment.UID == uid {
-						stack.Resources.Service = &service
-						continue Items
-					}
-				}
+func (c *StackSetController) collectServices(stacksets map[types.UID]*core.StackSetContainer) error {
+	for _, stackset := range stacksets {
+		for stackUID, s := range stackset.StackContainers {
+			obj, err := ownedStackObject(c.informers.services, stackUID, s)
+			if err != nil {
+				return fmt.Errorf("failed to get Services: %v", err)
+			}
+			if service, ok := obj.(*v1.Service); ok {
+				s.Resources.Service = service.DeepCopy()
 			}
 		}
 	}
 	return nil
 }
 
-func (c *StackSetController) collectHPAs(ctx context.Context, stacksets map[types.UID]*core.StackSetContainer) error {
-	hpas, err := c.client.AutoscalingV2beta2().HorizontalPodAutoscalers(v1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list HPAs: %v", err)
+func (c *StackSetController) collectHPAs(stacksets map[types.UID]*core.StackSetContainer) error {
+	for _, stackset := range stacksets {
+		for stackUID, s := range stackset.StackContainers {
+			obj, err := ownedStackObject(c.informers.hpas, stackUID, s)
+			if err != nil {
+				return fmt.Errorf("failed to get HPAs: %v", err)
+			}
+			if hpa, ok := obj.(*autoscaling.HorizontalPodAutoscaler); ok {
+				s.Resources.HPA = hpa.DeepCopy()
+			}
+		}
 	}
+	return nil
+}
 
-Items:
-	for _, h := range hpas.Items {
-		hpa := h
-		if uid, ok := getOwnerUID(hpa.ObjectMeta); ok {
-			for _, stackset := range stacksets {
-				if s, ok := stackset.StackContainers[uid]; ok {
-					s.Resources.HPA = &hpa
-					continue Items
-				}
+func (c *StackSetController) collectJobs(stacksets map[types.UID]*core.StackSetContainer) error {
+	for _, stackset := range stacksets {
+		for stackUID, s := range stackset.StackContainers {
+			objs, err := c.informers.jobs.byIndex(ownerUIDIndex, string(stackUID))
+			if err != nil {
+				return fmt.Errorf("failed to get Jobs: %v", err)
+			}
 
-				// service/HPA used to be owned by the deployment for some reason
-				for _, stack := range stackset.StackContainers {
-					if stack.Resources.Deployment != nil && stack.Resources.Deployment.UID == uid {
-						stack.Resources.HPA = &hpa
-						continue Items
-					}
+			for _, obj := range objs {
+				job, ok := obj.(*batch.Job)
+				if !ok {
+					continue
+				}
+				switch job.Labels[core.TrafficHookLabelKey] {
+				case core.PreTrafficSwitchHook:
+					s.Resources.PreTrafficSwitchJob = job.DeepCopy()
+				case core.PostTrafficSwitchHook:
+					s.Resources.PostTrafficSwitchJob = job.DeepCopy()
 				}
 			}
 		}
@@ -427,6 +585,18 @@ Items:
 	return nil
 }
 
+// ownedStackObject returns an object owned by the stack from the caches of
+// the informers. The service/HPA used to be owned by the deployment for some
+// reason, so objects owned by the deployment of the stack are returned as
+// well.
+func ownedStackObject(informers namespacedInformers, stackUID types.UID, sc *core.StackContainer) (interface{}, error) {
+	obj, err := ownedObject(informers, stackUID)
+	if err != nil || obj != nil || sc.Resources.Deployment == nil {
+		return obj, err
+	}
+	return ownedObject(informers, sc.Resources.Deployment.UID)
+}
+
 func getOwnerUID(objectMeta metav1.ObjectMeta) (types.UID, bool) {
 	if len(objectMeta.OwnerReferences) == 1 {
 		return objectMeta.OwnerReferences[0].UID, true
@@ -464,20 +634,31 @@ func (c *StackSetController) hasOwnership(stackset *zv1.StackSet) bool {
 }
 
 func (c *StackSetController) startWatch(ctx context.Context) {
-	informer := cache.NewSharedIndexInformer(
-		cache.NewListWatchFromClient(c.client.ZalandoV1().RESTClient(), "stacksets", v1.NamespaceAll, fields.Everything()),
-		&zv1.StackSet{},
-		0, // skip resync
-		cache.Indexers{},
-	)
-
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    c.add,
-		UpdateFunc: c.update,
-		DeleteFunc: c.del,
-	})
-	go informer.Run(ctx.Done())
-	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+	namespaces := c.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{v1.NamespaceAll}
+	}
+
+	var synced []cache.InformerSynced
+	for _, namespace := range namespaces {
+		informer := cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(c.client.ZalandoV1().RESTClient(), "stacksets", namespace, func(options *metav1.ListOptions) {
+				options.LabelSelector = c.stacksetSelector.String()
+			}),
+			&zv1.StackSet{},
+			0, // skip resync
+			cache.Indexers{},
+		)
+
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.add,
+			UpdateFunc: c.update,
+			DeleteFunc: c.del,
+		})
+		go informer.Run(ctx.Done())
+		synced = append(synced, informer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
 		c.logger.Errorf("Timed out waiting for caches to sync")
 		return
 	}
@@ -491,9 +672,7 @@ func (c *StackSetController) add(obj interface{}) {
 	}
 
 	c.logger.Infof("New StackSet added %s/%s", stackset.Namespace, stackset.Name)
-	c.stacksetEvents <- stacksetEvent{
-		StackSet: stackset.DeepCopy(),
-	}
+	c.storeStackSet(stackset.DeepCopy(), false)
 }
 
 func (c *StackSetController) update(oldObj, newObj interface{}) {
@@ -514,9 +693,7 @@ func (c *StackSetController) update(oldObj, newObj interface{}) {
 	)
 
 	c.logger.Infof("StackSet updated %s/%s", newStackset.Namespace, newStackset.Name)
-	c.stacksetEvents <- stacksetEvent{
-		StackSet: newStackset.DeepCopy(),
-	}
+	c.storeStackSet(newStackset.DeepCopy(), false)
 }
 
 func (c *StackSetController) del(obj interface{}) {
@@ -526,9 +703,75 @@ func (c *StackSetController) del(obj interface{}) {
 	}
 
 	c.logger.Infof("StackSet deleted %s/%s", stackset.Namespace, stackset.Name)
-	c.stacksetEvents <- stacksetEvent{
-		StackSet: stackset.DeepCopy(),
-		Deleted:  true,
+	c.storeStackSet(stackset.DeepCopy(), true)
+}
+
+// storeStackSet updates the stackset store and queues the stackset for
+// reconciliation if it's managed by the controller.
+func (c *StackSetController) storeStackSet(stackset *zv1.StackSet, deleted bool) {
+	fixupStackSetTypeMeta(stackset)
+
+	c.Lock()
+	defer c.Unlock()
+
+	// update/delete existing entry
+	if _, ok := c.stacksetStore[stackset.UID]; ok {
+		if deleted || !c.hasOwnership(stackset) {
+			delete(c.stacksetStore, stackset.UID)
+			delete(c.stacksetContainers, stackset.UID)
+			return
+		}
+
+		// update stackset entry
+		c.stacksetStore[stackset.UID] = *stackset
+		c.queue.Add(stackset.UID)
+		return
+	}
+
+	// check if stackset should be managed by the controller
+	if deleted || !c.hasOwnership(stackset) {
+		return
+	}
+
+	c.logger.Infof("Adding entry for StackSet %s/%s", stackset.Namespace, stackset.Name)
+	c.stacksetStore[stackset.UID] = *stackset
+	c.queue.Add(stackset.UID)
+}
+
+// enqueueOwner queues the stackset owning an object for reconciliation. The
+// object can be owned by the stackset directly or through its stack, or
+// through the deployment of its stack.
+func (c *StackSetController) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	// Services and HPAs used to be owned by the deployment, so there are up
+	// to three levels of owners
+	for depth := 0; object != nil && depth < 3; depth++ {
+		uid, ok := getOwnerUID(metav1.ObjectMeta{OwnerReferences: object.GetOwnerReferences()})
+		if !ok {
+			return
+		}
+
+		c.Lock()
+		_, ok = c.stacksetStore[uid]
+		c.Unlock()
+		if ok {
+			c.queue.Add(uid)
+			return
+		}
+
+		object, err = c.informers.ownerByUID(uid)
+		if err != nil {
+			c.logger.Errorf("Failed to get owner %s: %v", uid, err)
+			return
+		}
 	}
 }
 
@@ -568,6 +811,10 @@ func (c *StackSetController) ReconcileStatuses(ctx context.Context, ssc *core.St
 			return nil
 		})
 		if err != nil {
+			// Stacks pending removal were usually deleted already
+			if sc.PendingRemoval && errors.IsNotFound(err) {
+				continue
+			}
 			return c.errorEventf(sc.Stack, "FailedUpdateStackStatus", err)
 		}
 	}
@@ -616,6 +863,14 @@ func (c *StackSetController) CreateCurrentStack(ctx context.Context, ssc *core.S
 		"Created stack %s",
 		newStack.Name())
 
+	// The stack is already created, a missing revision only prevents
+	// rolling back to it once it's deleted. Proceed on errors.
+	err = c.createStackRevision(ctx, ssc, created)
+	if err != nil {
+		err = c.errorEventf(ssc.StackSet, "FailedCreateStackRevision", err)
+		c.stacksetLogger(ssc).Errorf("Unable to store the revision of stack %s: %v", created.Name, err)
+	}
+
 	// Persist ObservedStackVersion in the status
 	updated := ssc.StackSet.DeepCopy()
 	updated.Status.ObservedStackVersion = newStackVersion
@@ -635,266 +890,272 @@ func (c *StackSetController) CreateCurrentStack(ctx context.Context, ssc *core.S
 	return nil
 }
 
-// CleanupOldStacks deletes stacks that are no longer needed.
-func (c *StackSetController) CleanupOldStacks(ctx context.Context, ssc *core.StackSetContainer) error {
-	for _, sc := range ssc.StackContainers {
-		if !sc.PendingRemoval {
-			continue
+// ReconcileTemplateDrift handles changes of the stack template which weren't
+// accompanied by a new version. Depending on the template drift policy of
+// the stackset the drift is either only reported or the stack of the current
+// version is updated in place.
+func (c *StackSetController) ReconcileTemplateDrift(ctx context.Context, ssc *core.StackSetContainer) error {
+	sc := ssc.TemplateDrift()
+	if sc == nil {
+		return nil
+	}
+
+	if ssc.StackSet.Spec.TemplateDriftPolicy != zv1.TemplateDriftPolicyInPlaceUpdate {
+		// Only report the drift once, the condition keeps track of it.
+		if !meta.IsStatusConditionTrue(ssc.StackSet.Status.Conditions, zv1.StackSetConditionTemplateDrift) {
+			c.recorder.Eventf(
+				ssc.StackSet,
+				apiv1.EventTypeWarning,
+				"TemplateDrift",
+				"The stack template changed without a new version, stack %s doesn't match it",
+				sc.Name())
 		}
+		return nil
+	}
 
-		stack := sc.Stack
-		err := c.client.ZalandoV1().Stacks(stack.Namespace).Delete(ctx, stack.Name, metav1.DeleteOptions{})
-		if err != nil {
-			return c.errorEventf(ssc.StackSet, "FailedDeleteStack", err)
+	stack := sc.Stack
+	var updated *zv1.Stack
+	err := retryUpdate(func(retry bool) error {
+		if retry {
+			latest, err := c.client.ZalandoV1().Stacks(sc.Namespace()).Get(ctx, stack.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			stack = latest
 		}
-		c.recorder.Eventf(
-			ssc.StackSet,
-			apiv1.EventTypeNormal,
-			"DeletedExcessStack",
-			"Deleted excess stack %s",
-			stack.Name)
+		var err error
+		updated, err = c.client.ZalandoV1().Stacks(sc.Namespace()).Update(ctx, ssc.StackFromTemplate(stack), metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return err
 	}
+	fixupStackTypeMeta(updated)
+	sc.Stack = updated
+
+	c.recorder.Eventf(
+		ssc.StackSet,
+		apiv1.EventTypeNormal,
+		"UpdatedStackTemplate",
+		"Updated stack %s in place to match the stack template",
+		updated.Name)
 
+	// Replace the stored revision so a rollback restores the updated
+	// stack. Proceed on errors.
+	err = c.createStackRevision(ctx, ssc, updated)
+	if err != nil {
+		err = c.errorEventf(ssc.StackSet, "FailedCreateStackRevision", err)
+		c.stacksetLogger(ssc).Errorf("Unable to store the revision of stack %s: %v", updated.Name, err)
+	}
 	return nil
 }
 
-// AddUpdateStackSetIngress reconciles the Ingress but never deletes it, it returns the existing/new Ingress
-func (c *StackSetController) AddUpdateStackSetIngress(ctx context.Context, stackset *zv1.StackSet, existing *networking.Ingress, routegroup *rgv1.RouteGroup, ingress *networking.Ingress) (*networking.Ingress, error) {
-
-	// Ingress removed, handled outside
-	if ingress == nil {
-		return existing, nil
+// createStackRevision stores the template of a created stack in a
+// ControllerRevision owned by the stackset and deletes the revisions
+// exceeding the revision history limit.
+func (c *StackSetController) createStackRevision(ctx context.Context, ssc *core.StackSetContainer, stack *zv1.Stack) error {
+	opts := metav1.ListOptions{
+		LabelSelector: labels.Set{core.StacksetHeritageLabelKey: ssc.StackSet.Name}.String(),
+	}
+	existing, err := c.client.AppsV1().ControllerRevisions(stack.Namespace).List(ctx, opts)
+	if err != nil {
+		return err
 	}
 
-	// Create new Ingress
-	if existing == nil {
-		if ingress.Annotations == nil {
-			ingress.Annotations = make(map[string]string)
+	revisions := make([]*apps.ControllerRevision, 0, len(existing.Items)+1)
+	var lastRevision int64
+	for i := range existing.Items {
+		revision := &existing.Items[i]
+		if revision.Name == stack.Name {
+			// The data of a revision is immutable, replace the revision
+			// of a stack which was recreated with the same version.
+			err := c.client.AppsV1().ControllerRevisions(revision.Namespace).Delete(ctx, revision.Name, metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			continue
 		}
-		ingress.Annotations[ControllerLastUpdatedAnnotationKey] = c.now()
-
-		createdIng, err := c.client.NetworkingV1().Ingresses(ingress.Namespace).Create(ctx, ingress, metav1.CreateOptions{})
-		if err != nil {
-			return nil, err
+		revisions = append(revisions, revision)
+		if revision.Revision > lastRevision {
+			lastRevision = revision.Revision
 		}
-		c.recorder.Eventf(
-			stackset,
-			apiv1.EventTypeNormal,
-			"CreatedIngress",
-			"Created Ingress %s",
-			ingress.Name)
-		return createdIng, nil
 	}
 
-	_, existingHaveUpdateTimeStamp := existing.Annotations[ControllerLastUpdatedAnnotationKey]
-	if existingHaveUpdateTimeStamp {
-		delete(existing.Annotations, ControllerLastUpdatedAnnotationKey)
-	}
-
-	// Check if we need to update the Ingress
-	if existingHaveUpdateTimeStamp && equality.Semantic.DeepDerivative(ingress.Spec, existing.Spec) &&
-		equality.Semantic.DeepEqual(ingress.Annotations, existing.Annotations) {
-		return existing, nil
+	revision, err := ssc.GenerateStackRevision(stack, lastRevision+1)
+	if err != nil {
+		return err
 	}
-
-	updated := existing.DeepCopy()
-	updated.Spec = ingress.Spec
-	if ingress.Annotations != nil {
-		updated.Annotations = ingress.Annotations
-	} else {
-		updated.Annotations = make(map[string]string)
+	created, err := c.client.AppsV1().ControllerRevisions(revision.Namespace).Create(ctx, revision, metav1.CreateOptions{})
+	if err != nil {
+		return err
 	}
-	updated.Annotations[ControllerLastUpdatedAnnotationKey] = c.now()
+	revisions = append(revisions, created)
 
-	createdIngress, err := c.client.NetworkingV1().Ingresses(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
-	if err != nil {
-		return nil, err
+	for _, expired := range ssc.ExpiredStackRevisions(revisions) {
+		err := c.client.AppsV1().ControllerRevisions(expired.Namespace).Delete(ctx, expired.Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
 	}
-	c.recorder.Eventf(
-		stackset,
-		apiv1.EventTypeNormal,
-		"UpdatedIngress",
-		"Updated Ingress %s",
-		ingress.Name)
-	return createdIngress, nil
+	return nil
 }
 
-func (c *StackSetController) deleteIngress(ctx context.Context, stackset *zv1.StackSet, existing *networking.Ingress, routegroup *rgv1.RouteGroup) error {
-	// Check if a routegroup exists and if so only delete if it has existed for more than ingressSourceWithTTL time.
-	if stackset.Spec.RouteGroup != nil && c.routeGroupSupportEnabled {
-		if routegroup == nil {
-			c.logger.Infof("Not deleting Ingress %s yet, RouteGroup missing", existing.Name)
-			return nil
-		}
-		timestamp, ok := routegroup.Annotations[ControllerLastUpdatedAnnotationKey]
-		// The only scenario version we could think of for this is
-		//  if the RouteGroup was created by an older version of StackSet Controller
-		//  in that case, just wait until the RouteGroup has the annotation
-		if !ok {
-			c.logger.Infof("Not deleting Ingress %s yet, RouteGroup %s does not have the %s annotation yet", existing.Name, routegroup.Name, ControllerLastUpdatedAnnotationKey)
-			return nil
+// CleanupOldStacks deletes stacks that are no longer needed.
+func (c *StackSetController) CleanupOldStacks(ctx context.Context, ssc *core.StackSetContainer) error {
+	for _, sc := range ssc.StackContainers {
+		if !sc.PendingRemoval {
+			continue
 		}
 
-		if ready, err := resourceReady(timestamp, c.ingressSourceSwitchTTL); err != nil {
-			c.logger.Infof("Not deleting Ingress %s yet, RouteGroup %s does not have a valid %s annotation yet", existing.Name, routegroup.Name, ControllerLastUpdatedAnnotationKey)
-			return nil
-		} else if !ready {
-			c.logger.Infof("Not deleting Ingress %s yet, RouteGroup %s updated less than %s ago", existing.Name, routegroup.Name, c.ingressSourceSwitchTTL)
-			return nil
+		stack := sc.Stack
+		err := c.client.ZalandoV1().Stacks(stack.Namespace).Delete(ctx, stack.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return c.errorEventf(ssc.StackSet, "FailedDeleteStack", err)
 		}
+		c.recorder.Eventf(
+			ssc.StackSet,
+			apiv1.EventTypeNormal,
+			"DeletedExcessStack",
+			"Deleted excess stack %s",
+			stack.Name)
 	}
-	err := c.client.NetworkingV1().Ingresses(existing.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{})
-	if err != nil {
-		return err
-	}
-	c.recorder.Eventf(
-		stackset,
-		apiv1.EventTypeNormal,
-		"DeletedIngress",
-		"Deleted Ingress %s",
-		existing.Namespace)
+
 	return nil
 }
 
-// AddUpdateStackSetRouteGroup reconciles the RouteGroup but never deletes it, it returns the existing/new RouteGroup
-func (c *StackSetController) AddUpdateStackSetRouteGroup(ctx context.Context, stackset *zv1.StackSet, existing *rgv1.RouteGroup, ingress *networking.Ingress, rg *rgv1.RouteGroup) (*rgv1.RouteGroup, error) {
-	// RouteGroup removed, handled outside
-	if rg == nil {
+// addUpdateTrafficBackend reconciles the routing object of a traffic backend
+// but never deletes it, it returns the existing/new routing object.
+func (c *StackSetController) addUpdateTrafficBackend(ctx context.Context, stackset *zv1.StackSet, backend core.TrafficBackend, existing, generated core.TrafficBackendObject) (core.TrafficBackendObject, error) {
+	// Routing object removed, handled outside
+	if generated == nil {
 		return existing, nil
 	}
 
-	// Create new RouteGroup
+	// Create new routing object
 	if existing == nil {
-		if rg.Annotations == nil {
-			rg.Annotations = make(map[string]string)
+		annotations := generated.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
 		}
-		rg.Annotations[ControllerLastUpdatedAnnotationKey] = c.now()
+		annotations[ControllerLastUpdatedAnnotationKey] = c.now()
+		generated.SetAnnotations(annotations)
 
-		createdRg, err := c.client.RouteGroupV1().RouteGroups(rg.Namespace).Create(ctx, rg, metav1.CreateOptions{})
+		created, err := backend.Create(ctx, c.client, generated)
 		if err != nil {
 			return nil, err
 		}
 		c.recorder.Eventf(
 			stackset,
 			apiv1.EventTypeNormal,
-			"CreatedRouteGroup",
-			"Created RouteGroup %s",
-			rg.Name)
-		return createdRg, nil
-	}
-
-	// Check if we need to update the RouteGroup
-	if _, exists := existing.Annotations[ControllerLastUpdatedAnnotationKey]; exists &&
-		equality.Semantic.DeepDerivative(rg.Spec, existing.Spec) {
+			"Created"+backend.Kind(),
+			"Created %s %s",
+			backend.Kind(),
+			generated.GetName())
+		return created, nil
+	}
+
+	// Check if we need to update the routing object, ignoring the
+	// timestamp of the last update
+	_, existingHaveUpdateTimeStamp := existing.GetAnnotations()[ControllerLastUpdatedAnnotationKey]
+	compared := existing.DeepCopyObject().(core.TrafficBackendObject)
+	delete(compared.GetAnnotations(), ControllerLastUpdatedAnnotationKey)
+	if existingHaveUpdateTimeStamp && !backend.NeedsUpdate(compared, generated) {
 		return existing, nil
 	}
 
-	updated := existing.DeepCopy()
-	updated.Spec = rg.Spec
-	if updated.Annotations == nil {
-		updated.Annotations = make(map[string]string)
-	}
-	updated.Annotations[ControllerLastUpdatedAnnotationKey] = c.now()
+	updated := backend.Updated(existing, generated)
+	annotations := updated.GetAnnotations()
+	annotations[ControllerLastUpdatedAnnotationKey] = c.now()
+	updated.SetAnnotations(annotations)
 
-	createdRg, err := c.client.RouteGroupV1().RouteGroups(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	result, err := backend.Update(ctx, c.client, updated)
 	if err != nil {
 		return nil, err
 	}
 	c.recorder.Eventf(
 		stackset,
 		apiv1.EventTypeNormal,
-		"UpdatedRouteGroup",
-		"Updated RouteGroup %s",
-		rg.Name)
-	return createdRg, nil
+		"Updated"+backend.Kind(),
+		"Updated %s %s",
+		backend.Kind(),
+		generated.GetName())
+	return result, nil
 }
 
-func (c *StackSetController) deleteRouteGroup(ctx context.Context, stackset *zv1.StackSet, rg *rgv1.RouteGroup, ingress *networking.Ingress) error {
-	// Check if an ingress exists and if so only delete if it has existed for more than ingressSourceWithTTL time.
-	if stackset.Spec.Ingress != nil {
-		if ingress == nil {
-			c.logger.Infof("Not deleting RouteGroup %s yet, Ingress missing", rg.Name)
+// deleteTrafficBackend deletes the routing object of a traffic backend which
+// is no longer configured. If the StackSet switched to other traffic
+// backends, the routing object is only deleted once all of them have existed
+// for more than ingressSourceSwitchTTL.
+func (c *StackSetController) deleteTrafficBackend(ctx context.Context, ssc *core.StackSetContainer, backend core.TrafficBackend, existing core.TrafficBackendObject, applied map[core.TrafficBackend]core.TrafficBackendObject) error {
+	for _, replacementBackend := range c.trafficBackends {
+		if replacementBackend == backend || !replacementBackend.Enabled(ssc) {
+			continue
+		}
+		replacement := applied[replacementBackend]
+		if replacement == nil {
+			c.logger.Infof("Not deleting %s %s yet, %s missing", backend.Kind(), existing.GetName(), replacementBackend.Kind())
 			return nil
 		}
-		timestamp, ok := ingress.Annotations[ControllerLastUpdatedAnnotationKey]
+		timestamp, ok := replacement.GetAnnotations()[ControllerLastUpdatedAnnotationKey]
 		// The only scenario version we could think of for this is
-		//  if the RouteGroup was created by an older version of StackSet Controller
-		//  in that case, just wait until the RouteGroup has the annotation
+		//  if the routing object was created by an older version of StackSet Controller
+		//  in that case, just wait until it has the annotation
 		if !ok {
-			c.logger.Infof("Not deleting RouteGroup %s yet, Ingress %s does not have the %s annotation yet", rg.Name, ingress.Name, ControllerLastUpdatedAnnotationKey)
+			c.logger.Infof("Not deleting %s %s yet, %s %s does not have the %s annotation yet", backend.Kind(), existing.GetName(), replacementBackend.Kind(), replacement.GetName(), ControllerLastUpdatedAnnotationKey)
 			return nil
 		}
 
-		if ready, err := resourceReady(timestamp, c.ingressSourceSwitchTTL); err != nil {
-			c.logger.Infof("Not deleting RouteGroup %s yet, Ingress %s does not have a valid %s annotation yet", rg.Name, ingress.Name, ControllerLastUpdatedAnnotationKey)
+		if ready, err := resourceReady(timestamp, c.ingressSourceSwitchTTL, c.clock.Now()); err != nil {
+			c.logger.Infof("Not deleting %s %s yet, %s %s does not have a valid %s annotation yet", backend.Kind(), existing.GetName(), replacementBackend.Kind(), replacement.GetName(), ControllerLastUpdatedAnnotationKey)
 			return nil
 		} else if !ready {
-			c.logger.Infof("Not deleting RouteGroup %s yet, Ingress %s updated less than %s ago", rg.Name, ingress.Name, c.ingressSourceSwitchTTL)
+			c.logger.Infof("Not deleting %s %s yet, %s %s updated less than %s ago", backend.Kind(), existing.GetName(), replacementBackend.Kind(), replacement.GetName(), c.ingressSourceSwitchTTL)
 			return nil
 		}
 	}
-	err := c.client.RouteGroupV1().RouteGroups(rg.Namespace).Delete(ctx, rg.Name, metav1.DeleteOptions{})
+
+	err := backend.Delete(ctx, c.client, existing)
 	if err != nil {
 		return err
 	}
 	c.recorder.Eventf(
-		stackset,
+		ssc.StackSet,
 		apiv1.EventTypeNormal,
-		"DeletedRouteGroup",
-		"Deleted RouteGroup %s",
-		rg.Namespace)
+		"Deleted"+backend.Kind(),
+		"Deleted %s %s",
+		backend.Kind(),
+		existing.GetName())
 	return nil
 }
 
-func (c *StackSetController) ReconcileStackSetIngressSources(
-	ctx context.Context,
-	stackset *zv1.StackSet,
-	existingIng *networking.Ingress,
-	existingRg *rgv1.RouteGroup,
-	generateIng func() (*networking.Ingress, error),
-	generateRg func() (*rgv1.RouteGroup, error),
-) error {
-	ingress, err := generateIng()
-	if err != nil {
-		return c.errorEventf(stackset, "FailedManageIngress", err)
-	}
-
-	// opt-out existingIng creation in case we have an external entity creating existingIng
-	appliedIng, err := c.AddUpdateStackSetIngress(ctx, stackset, existingIng, existingRg, ingress)
-	if err != nil {
-		return c.errorEventf(stackset, "FailedManageIngress", err)
-	}
+// ReconcileStackSetTrafficBackends creates, updates and deletes the routing
+// objects of all the traffic backends supported by the controller.
+func (c *StackSetController) ReconcileStackSetTrafficBackends(ctx context.Context, ssc *core.StackSetContainer) error {
+	generated := make(map[core.TrafficBackend]core.TrafficBackendObject, len(c.trafficBackends))
+	applied := make(map[core.TrafficBackend]core.TrafficBackendObject, len(c.trafficBackends))
 
-	rg, err := generateRg()
-	if err != nil {
-		return c.errorEventf(stackset, "FailedManageRouteGroup", err)
-	}
+	for _, backend := range c.trafficBackends {
+		obj, err := backend.Generate(ssc)
+		if err != nil {
+			return c.errorEventf(ssc.StackSet, "FailedManage"+backend.Kind(), err)
+		}
+		generated[backend] = obj
 
-	var appliedRg *rgv1.RouteGroup
-	if c.routeGroupSupportEnabled {
-		appliedRg, err = c.AddUpdateStackSetRouteGroup(ctx, stackset, existingRg, appliedIng, rg)
+		applied[backend], err = c.addUpdateTrafficBackend(ctx, ssc.StackSet, backend, backend.Existing(ssc), obj)
 		if err != nil {
-			return c.errorEventf(stackset, "FailedManageRouteGroup", err)
+			return c.errorEventf(ssc.StackSet, "FailedManage"+backend.Kind(), err)
 		}
 	}
 
-	// Ingress removed
-	if ingress == nil {
-		if existingIng != nil {
-			err := c.deleteIngress(ctx, stackset, existingIng, appliedRg)
-			if err != nil {
-				return c.errorEventf(stackset, "FailedManageIngress", err)
-			}
+	for _, backend := range c.trafficBackends {
+		existing := backend.Existing(ssc)
+		if generated[backend] != nil || existing == nil {
+			continue
 		}
-	}
 
-	// RouteGroup removed
-	if rg == nil {
-		if existingRg != nil {
-			err := c.deleteRouteGroup(ctx, stackset, existingRg, appliedIng)
-			if err != nil {
-				return c.errorEventf(stackset, "FailedManageRouteGroup", err)
-			}
+		err := c.deleteTrafficBackend(ctx, ssc, backend, existing, applied)
+		if err != nil {
+			return c.errorEventf(ssc.StackSet, "FailedManage"+backend.Kind(), err)
 		}
 	}
 
@@ -902,7 +1163,7 @@ func (c *StackSetController) ReconcileStackSetIngressSources(
 }
 
 func (c *StackSetController) ReconcileStackSetResources(ctx context.Context, ssc *core.StackSetContainer) error {
-	err := c.ReconcileStackSetIngressSources(ctx, ssc.StackSet, ssc.Ingress, ssc.RouteGroup, ssc.GenerateIngress, ssc.GenerateRouteGroup)
+	err := c.ReconcileStackSetTrafficBackends(ctx, ssc)
 	if err != nil {
 		return err
 	}
@@ -948,6 +1209,44 @@ func (c *StackSetController) ReconcileStackSetDesiredTraffic(ctx context.Context
 	return nil
 }
 
+// ReconcileTrafficAnalysis evaluates the traffic analysis queries of the
+// stackset and rolls back the traffic to the last known good weights if one
+// of them breaches its threshold.
+func (c *StackSetController) ReconcileTrafficAnalysis(ctx context.Context, ssc *core.StackSetContainer) error {
+	var provider core.MetricsProvider
+	if trafficAnalysis := ssc.StackSet.Spec.TrafficAnalysis; trafficAnalysis != nil {
+		address := trafficAnalysis.Address
+		if address == "" {
+			address = c.trafficAnalysisAddress
+		}
+		if address == "" {
+			return fmt.Errorf("no address configured for the traffic analysis")
+		}
+
+		var err error
+		provider, err = c.newMetricsProvider(address)
+		if err != nil {
+			return err
+		}
+	}
+
+	rollback, err := ssc.AnalyzeTraffic(ctx, provider, c.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	if rollback != nil {
+		c.stacksetLogger(ssc).Warnf("Traffic rolled back: %s", rollback)
+		c.recorder.Eventf(
+			ssc.StackSet,
+			apiv1.EventTypeWarning,
+			"TrafficRolledBack",
+			"Rolled back traffic: %s",
+			rollback)
+	}
+	return nil
+}
+
 func (c *StackSetController) ReconcileStackResources(ctx context.Context, ssc *core.StackSetContainer, sc *core.StackContainer) error {
 	err := c.ReconcileStackDeployment(ctx, sc.Stack, sc.Resources.Deployment, sc.GenerateDeployment)
 	if err != nil {
@@ -976,6 +1275,23 @@ func (c *StackSetController) ReconcileStackResources(ctx context.Context, ssc *c
 		}
 	}
 
+	if c.httpRouteSupportEnabled {
+		err = c.ReconcileStackHTTPRoute(ctx, sc.Stack, sc.Resources.HTTPRoute, sc.GenerateHTTPRoute)
+		if err != nil {
+			return c.errorEventf(sc.Stack, "FailedManageHTTPRoute", err)
+		}
+	}
+
+	err = c.ReconcileStackJob(ctx, sc.Stack, sc.Resources.PreTrafficSwitchJob, sc.GeneratePreTrafficSwitchJob)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageJob", err)
+	}
+
+	err = c.ReconcileStackJob(ctx, sc.Stack, sc.Resources.PostTrafficSwitchJob, sc.GeneratePostTrafficSwitchJob)
+	if err != nil {
+		return c.errorEventf(sc.Stack, "FailedManageJob", err)
+	}
+
 	return nil
 }
 
@@ -988,14 +1304,32 @@ func (c *StackSetController) ReconcileStackSet(ctx context.Context, container *c
 		c.stacksetLogger(container).Errorf("Unable to create stack: %v", err)
 	}
 
+	// Update the current stack if the template changed without a new version. Proceed on errors.
+	err = c.ReconcileTemplateDrift(ctx, container)
+	if err != nil {
+		err = c.errorEventf(container.StackSet, "FailedUpdateStackTemplate", err)
+		c.stacksetLogger(container).Errorf("Unable to update stack to match the template: %v", err)
+	}
+
 	// Update statuses from external resources (ingresses, deployments, etc). Abort on errors.
 	err = container.UpdateFromResources()
 	if err != nil {
 		return err
 	}
 
+	// Switch the desired traffic to the current stack once it's ready.
+	if promotion := container.AutoPromote(c.clock.Now()); promotion != nil {
+		c.stacksetLogger(container).Infof("Auto promoting stack: %s", promotion)
+		c.recorder.Eventf(
+			container.StackSet,
+			v1.EventTypeNormal,
+			"AutoPromotedStack",
+			"Auto promoting stack %s",
+			promotion)
+	}
+
 	// Update the stacks with the currently selected traffic reconciler. Proceed on errors.
-	err = container.ManageTraffic(time.Now())
+	err = container.ManageTraffic(c.clock.Now())
 	if err != nil {
 		c.stacksetLogger(container).Errorf("Traffic reconciliation failed: %v", err)
 		c.recorder.Eventf(
@@ -1005,6 +1339,13 @@ func (c *StackSetController) ReconcileStackSet(ctx context.Context, container *c
 			"Failed to switch traffic: "+err.Error())
 	}
 
+	// Roll back the traffic if the traffic analysis fails. Proceed on errors.
+	err = c.ReconcileTrafficAnalysis(ctx, container)
+	if err != nil {
+		err = c.errorEventf(container.StackSet, "FailedTrafficAnalysis", err)
+		c.stacksetLogger(container).Errorf("Unable to analyze traffic: %v", err)
+	}
+
 	// Mark stacks that should be removed
 	container.MarkExpiredStacks()
 
@@ -1061,6 +1402,26 @@ func getResetMinReplicasDelay(annotations map[string]string) (time.Duration, boo
 	return resetDelay, true
 }
 
+// newProgressiveTrafficReconciler creates a progressive traffic reconciler
+// from the step schedule defined on a stackset.
+func newProgressiveTrafficReconciler(spec *zv1.ProgressiveTrafficSpec) *core.ProgressiveTrafficReconciler {
+	steps := make([]float64, 0, len(spec.Steps))
+	for _, step := range spec.Steps {
+		steps = append(steps, float64(step))
+	}
+	sort.Float64s(steps)
+
+	stepDuration := defaultProgressiveStepDuration
+	if spec.StepDurationSeconds != nil {
+		stepDuration = time.Duration(*spec.StepDurationSeconds) * time.Second
+	}
+
+	return &core.ProgressiveTrafficReconciler{
+		Steps:        steps,
+		StepDuration: stepDuration,
+	}
+}
+
 func fixupStackSetTypeMeta(stackset *zv1.StackSet) {
 	// set TypeMeta manually because of this bug:
 	// https://github.com/kubernetes/client-go/issues/308
@@ -1075,14 +1436,14 @@ func fixupStackTypeMeta(stack *zv1.Stack) {
 	stack.Kind = core.KindStack
 }
 
-func resourceReady(timestamp string, ttl time.Duration) (bool, error) {
+func resourceReady(timestamp string, ttl time.Duration, now time.Time) (bool, error) {
 	resourceLastUpdated, err := time.Parse(time.RFC3339, timestamp)
 	if err != nil {
 		// wait until there's a valid timestamp on the annotation
 		return false, err
 	}
 
-	if !resourceLastUpdated.IsZero() && time.Since(resourceLastUpdated) > ttl {
+	if !resourceLastUpdated.IsZero() && now.Sub(resourceLastUpdated) > ttl {
 		return true, nil
 	}
 
@@ -2,6 +2,10 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -9,14 +13,20 @@ import (
 	"github.com/stretchr/testify/require"
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
 	"github.com/zalando-incubator/stackset-controller/pkg/core"
 	apps "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2beta2"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 )
 
 func TestGetOwnerUID(t *testing.T) {
@@ -56,6 +66,11 @@ func TestCollectResources(t *testing.T) {
 	testPrescalingCustomStackset := testStackset("foobaz", "namespace", "789")
 	testPrescalingCustomStackset.Annotations = map[string]string{PrescaleStacksAnnotationKey: "", ResetHPAMinReplicasDelayAnnotationKey: "30s"}
 
+	testProgressiveStackset := testStackset("qux", "namespace", "321")
+	testProgressiveStackset.Spec.ProgressiveTraffic = &zv1.ProgressiveTrafficSpec{
+		Steps: []int32{50, 10},
+	}
+
 	for _, tc := range []struct {
 		name        string
 		stacksets   []zv1.StackSet
@@ -73,6 +88,7 @@ func TestCollectResources(t *testing.T) {
 				testStacksetA,
 				testPrescalingStackset,
 				testPrescalingCustomStackset,
+				testProgressiveStackset,
 			},
 			expected: map[types.UID]*core.StackSetContainer{
 				testStacksetA.UID: {
@@ -94,6 +110,14 @@ func TestCollectResources(t *testing.T) {
 						ResetHPAMinReplicasTimeout: 30 * time.Second,
 					},
 				},
+				testProgressiveStackset.UID: {
+					StackSet:        &testProgressiveStackset,
+					StackContainers: map[types.UID]*core.StackContainer{},
+					TrafficReconciler: &core.ProgressiveTrafficReconciler{
+						Steps:        []float64{10, 50},
+						StepDuration: defaultProgressiveStepDuration,
+					},
+				},
 			},
 		},
 		{
@@ -251,13 +275,119 @@ func TestCollectResources(t *testing.T) {
 			err = env.CreateHPAs(context.Background(), tc.hpas)
 			require.NoError(t, err)
 
-			resources, err := env.controller.collectResources(context.Background())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			err = env.controller.informers.run(ctx)
+			require.NoError(t, err)
+
+			// The containers use the clock of the controller
+			for _, container := range tc.expected {
+				container.Clock = env.controller.clock
+			}
+
+			resources, err := env.controller.collectResources()
 			require.NoError(t, err)
 			require.Equal(t, tc.expected, resources)
 		})
 	}
 }
 
+func TestStoreStackSet(t *testing.T) {
+	env := NewTestEnvironment()
+	env.controller.controllerID = "foo"
+
+	owned := testStackset("foo", "default", "123")
+	owned.Annotations = map[string]string{StacksetControllerControllerAnnotationKey: "foo"}
+	other := testStackset("bar", "default", "456")
+
+	env.controller.storeStackSet(owned.DeepCopy(), false)
+	env.controller.storeStackSet(other.DeepCopy(), false)
+	require.Contains(t, env.controller.stacksetStore, owned.UID)
+	require.NotContains(t, env.controller.stacksetStore, other.UID)
+	require.Equal(t, 1, env.controller.queue.Len())
+
+	key, _ := env.controller.queue.Get()
+	require.Equal(t, owned.UID, key)
+	env.controller.queue.Done(key)
+
+	env.controller.stacksetContainers[owned.UID] = &core.StackSetContainer{}
+	env.controller.storeStackSet(owned.DeepCopy(), true)
+	require.NotContains(t, env.controller.stacksetStore, owned.UID)
+	require.NotContains(t, env.controller.stacksetContainers, owned.UID)
+	require.Equal(t, 0, env.controller.queue.Len())
+}
+
+func TestEnqueueOwner(t *testing.T) {
+	stackset := testStackset("foo", "default", "123")
+	stack := testStack("foo-v1", stackset.Namespace, "abc1", stackset)
+	deployment := apps.Deployment{ObjectMeta: stackOwned(stack)}
+	deployment.UID = "def1"
+
+	for _, tc := range []struct {
+		name     string
+		object   interface{}
+		expected []types.UID
+	}{
+		{
+			name:     "stackset owned objects queue the stackset",
+			object:   &networking.Ingress{ObjectMeta: stacksetOwned(stackset)},
+			expected: []types.UID{stackset.UID},
+		},
+		{
+			name:     "stacks queue their stackset",
+			object:   &stack,
+			expected: []types.UID{stackset.UID},
+		},
+		{
+			name:     "stack owned objects queue the stackset of the stack",
+			object:   &v1.Service{ObjectMeta: stackOwned(stack)},
+			expected: []types.UID{stackset.UID},
+		},
+		{
+			name:     "deployment owned objects queue the stackset of the stack",
+			object:   &autoscaling.HorizontalPodAutoscaler{ObjectMeta: deploymentOwned(deployment)},
+			expected: []types.UID{stackset.UID},
+		},
+		{
+			name:     "deleted objects queue the stackset",
+			object:   cache.DeletedFinalStateUnknown{Obj: &v1.Service{ObjectMeta: stackOwned(stack)}},
+			expected: []types.UID{stackset.UID},
+		},
+		{
+			name:   "orphaned objects are ignored",
+			object: &v1.Service{ObjectMeta: stackOwned(testStack("nonexistent", "default", "xxx", zv1.StackSet{}))},
+		},
+		{
+			name:   "unowned objects are ignored",
+			object: &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+			require.NoError(t, err)
+
+			err = env.controller.informers.stacks[0].GetIndexer().Add(&stack)
+			require.NoError(t, err)
+
+			err = env.controller.informers.deployments[0].GetIndexer().Add(&deployment)
+			require.NoError(t, err)
+
+			env.controller.enqueueOwner(tc.object)
+
+			var queued []types.UID
+			for env.controller.queue.Len() > 0 {
+				key, _ := env.controller.queue.Get()
+				queued = append(queued, key.(types.UID))
+				env.controller.queue.Done(key)
+			}
+			require.Equal(t, tc.expected, queued)
+		})
+	}
+}
+
 func TestCreateCurrentStack(t *testing.T) {
 	env := NewTestEnvironment()
 
@@ -322,6 +452,189 @@ func TestCreateCurrentStack(t *testing.T) {
 	require.True(t, errors.IsNotFound(err))
 }
 
+func TestCreateStackRevisions(t *testing.T) {
+	env := NewTestEnvironment()
+	events := &eventLog{}
+	env.controller.recorder = events
+
+	revisionHistoryLimit := int32(2)
+	stackset := testStackset("foo", "default", "123")
+	stackset.Spec.StackLifecycle.RevisionHistoryLimit = &revisionHistoryLimit
+	stackset.Spec.StackTemplate.Annotations = map[string]string{"example.org/team": "foo"}
+
+	err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+	require.NoError(t, err)
+
+	container := &core.StackSetContainer{
+		StackSet:          &stackset,
+		StackContainers:   map[types.UID]*core.StackContainer{},
+		TrafficReconciler: &core.SimpleTrafficReconciler{},
+	}
+
+	for _, version := range []string{"v1", "v2", "v3"} {
+		container.StackSet.Spec.StackTemplate.Spec.Version = version
+		err = env.controller.CreateCurrentStack(context.Background(), container)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []string{
+		"Normal CreatedStack foo: Created stack foo-v1",
+		"Normal CreatedStack foo: Created stack foo-v2",
+		"Normal CreatedStack foo: Created stack foo-v3",
+	}, events.events)
+
+	revisions, err := env.client.AppsV1().ControllerRevisions(stackset.Namespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	stored := make(map[string]int64)
+	for _, revision := range revisions.Items {
+		stored[revision.Name] = revision.Revision
+		require.Equal(t, "foo", revision.Labels[core.StacksetHeritageLabelKey])
+		require.Equal(t, stackset.UID, revision.OwnerReferences[0].UID)
+	}
+	require.Equal(t, map[string]int64{"foo-v2": 2, "foo-v3": 3}, stored)
+
+	revision, err := env.client.AppsV1().ControllerRevisions(stackset.Namespace).Get(context.Background(), "foo-v3", metav1.GetOptions{})
+	require.NoError(t, err)
+	stack, err := env.client.ZalandoV1().Stacks(stackset.Namespace).Get(context.Background(), "foo-v3", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	var template zv1.Stack
+	require.NoError(t, json.Unmarshal(revision.Data.Raw, &template))
+	require.Equal(t, stack.Name, template.Name)
+	require.Equal(t, stack.Labels, template.Labels)
+	require.Equal(t, stack.Annotations, template.Annotations)
+	require.Equal(t, stack.Spec, template.Spec)
+}
+
+func TestReconcileTemplateDrift(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		policy           zv1.TemplateDriftPolicy
+		driftReported    bool
+		conflict         bool
+		scaled           bool
+		expectedImage    string
+		expectedReplicas int32
+		expectedEvents   []string
+	}{
+		{
+			name:             "drift is reported",
+			expectedImage:    "foo:1",
+			expectedReplicas: 3,
+			expectedEvents: []string{
+				"Warning TemplateDrift foo: The stack template changed without a new version, stack foo-v1 doesn't match it",
+			},
+		},
+		{
+			name:             "drift is only reported once",
+			driftReported:    true,
+			expectedImage:    "foo:1",
+			expectedReplicas: 3,
+		},
+		{
+			name:             "stack is updated in place",
+			policy:           zv1.TemplateDriftPolicyInPlaceUpdate,
+			expectedImage:    "foo:2",
+			expectedReplicas: 3,
+			expectedEvents: []string{
+				"Normal UpdatedStackTemplate foo: Updated stack foo-v1 in place to match the stack template",
+			},
+		},
+		{
+			name:             "in place update is retried on conflicts",
+			policy:           zv1.TemplateDriftPolicyInPlaceUpdate,
+			conflict:         true,
+			expectedImage:    "foo:2",
+			expectedReplicas: 3,
+			expectedEvents: []string{
+				"Normal UpdatedStackTemplate foo: Updated stack foo-v1 in place to match the stack template",
+			},
+		},
+		{
+			name:             "scaled stack isn't updated",
+			policy:           zv1.TemplateDriftPolicyInPlaceUpdate,
+			scaled:           true,
+			expectedImage:    "foo:1",
+			expectedReplicas: 5,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+			events := &eventLog{}
+			env.controller.recorder = events
+
+			replicas := int32(3)
+			stackset := testStackset("foo", "default", "123")
+			stackset.Spec.TemplateDriftPolicy = tc.policy
+			stackset.Spec.StackTemplate.Spec.Version = "v1"
+			stackset.Spec.StackTemplate.Spec.Replicas = &replicas
+			stackset.Spec.StackTemplate.Spec.PodTemplate.Spec.Containers = []v1.Container{{Name: "foo", Image: "foo:1"}}
+			if tc.driftReported {
+				stackset.Status.Conditions = []metav1.Condition{
+					{Type: zv1.StackSetConditionTemplateDrift, Status: metav1.ConditionTrue},
+				}
+			}
+
+			err := env.CreateStacksets(context.Background(), []zv1.StackSet{stackset})
+			require.NoError(t, err)
+
+			container := &core.StackSetContainer{
+				StackSet:          &stackset,
+				StackContainers:   map[types.UID]*core.StackContainer{},
+				TrafficReconciler: &core.SimpleTrafficReconciler{},
+			}
+			err = env.controller.CreateCurrentStack(context.Background(), container)
+			require.NoError(t, err)
+
+			if tc.scaled {
+				// scale the stack through the API
+				for _, sc := range container.StackContainers {
+					scaledReplicas := int32(5)
+					sc.Stack.Spec.Replicas = &scaledReplicas
+					_, err = env.client.ZalandoV1().Stacks(stackset.Namespace).Update(context.Background(), sc.Stack, metav1.UpdateOptions{})
+					require.NoError(t, err)
+				}
+			} else {
+				// change the template without changing the version
+				container.StackSet.Spec.StackTemplate.Spec.PodTemplate.Spec.Containers[0].Image = "foo:2"
+			}
+			events.events = nil
+
+			if tc.conflict {
+				// the stack is updated by another system in the meantime
+				stack, err := env.client.ZalandoV1().Stacks(stackset.Namespace).Get(context.Background(), "foo-v1", metav1.GetOptions{})
+				require.NoError(t, err)
+				stack.Annotations = map[string]string{"example.org/deployed-by": "ci"}
+				_, err = env.client.ZalandoV1().Stacks(stackset.Namespace).Update(context.Background(), stack, metav1.UpdateOptions{})
+				require.NoError(t, err)
+
+				conflicts := 1
+				ssClient := env.client.(*testClient).ssClient.(*ssfake.Clientset)
+				ssClient.PrependReactor("update", "stacks", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if conflicts == 0 {
+						return false, nil, nil
+					}
+					conflicts--
+					return true, nil, errors.NewConflict(zv1.Resource("stacks"), "foo-v1", fmt.Errorf("the object has been modified"))
+				})
+			}
+
+			err = env.controller.ReconcileTemplateDrift(context.Background(), container)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedEvents, events.events)
+
+			stack, err := env.client.ZalandoV1().Stacks(stackset.Namespace).Get(context.Background(), "foo-v1", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedImage, stack.Spec.PodTemplate.Spec.Containers[0].Image)
+			require.Equal(t, tc.expectedReplicas, *stack.Spec.Replicas)
+			if tc.conflict {
+				require.Equal(t, "ci", stack.Annotations["example.org/deployed-by"])
+			}
+		})
+	}
+}
+
 func TestCleanupOldStacks(t *testing.T) {
 	env := NewTestEnvironment()
 
@@ -448,7 +761,18 @@ func TestReconcileStackSetDesiredTraffic(t *testing.T) {
 	}
 }
 
-func TestReconcileStackSetIngressSources(t *testing.T) {
+// generatedTrafficBackend is a traffic backend generating a fixed routing
+// object.
+type generatedTrafficBackend struct {
+	core.TrafficBackend
+	generated core.TrafficBackendObject
+}
+
+func (b generatedTrafficBackend) Generate(*core.StackSetContainer) (core.TrafficBackendObject, error) {
+	return b.generated, nil
+}
+
+func TestReconcileStackSetTrafficBackends(t *testing.T) {
 	exampleIngRules := []networking.IngressRule{
 		{
 			Host: "example.org",
@@ -1294,18 +1618,27 @@ func TestReconcileStackSetIngressSources(t *testing.T) {
 				require.NoError(t, err)
 			}
 
-			if tc.disableRgSupport {
-				env.controller.routeGroupSupportEnabled = false
+			var generatedIng, generatedRg core.TrafficBackendObject
+			if tc.generatedIng != nil {
+				generatedIng = tc.generatedIng
 			}
+			if tc.generatedRg != nil {
+				generatedRg = tc.generatedRg
+			}
+
+			env.controller.trafficBackends = []core.TrafficBackend{
+				generatedTrafficBackend{TrafficBackend: core.IngressTrafficBackend{}, generated: generatedIng},
+			}
+			if !tc.disableRgSupport {
+				env.controller.trafficBackends = append(env.controller.trafficBackends,
+					generatedTrafficBackend{TrafficBackend: core.RouteGroupTrafficBackend{}, generated: generatedRg})
+			}
+
+			container := core.NewContainer(&stackset, &core.SimpleTrafficReconciler{}, "", nil, clock.RealClock{})
+			container.Ingress = tc.existingIng
+			container.RouteGroup = tc.existingRg
 
-			err = env.controller.ReconcileStackSetIngressSources(
-				context.Background(),
-				&stackset,
-				tc.existingIng,
-				tc.existingRg,
-				func() (*networking.Ingress, error) { return tc.generatedIng, nil },
-				func() (*rgv1.RouteGroup, error) { return tc.generatedRg, nil },
-			)
+			err = env.controller.ReconcileStackSetTrafficBackends(context.Background(), container)
 			require.NoError(t, err)
 
 			updatedIng, err := env.client.NetworkingV1().Ingresses(stackset.Namespace).Get(context.Background(), stackset.Name, metav1.GetOptions{})
@@ -1337,3 +1670,98 @@ func withAnnotations(meta metav1.ObjectMeta, annotations map[string]string) meta
 	}
 	return *updated
 }
+
+func TestReconcileTrafficAnalysis(t *testing.T) {
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		value := "0"
+		if r.Form.Get("query") == `errors{stack="foo-v2"}` {
+			value = "1"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1610000000,"%s"]}]}}`, value)
+	}))
+	defer prometheus.Close()
+
+	for _, tc := range []struct {
+		name            string
+		address         string
+		expectError     bool
+		expectedTraffic []*zv1.DesiredTraffic
+	}{
+		{
+			name:    "traffic is rolled back if a query breaches its threshold",
+			address: prometheus.URL,
+			expectedTraffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+		},
+		{
+			name:        "analysis fails without an address",
+			expectError: true,
+			expectedTraffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v2", Weight: 100},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := NewTestEnvironment()
+
+			stackset := &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: zv1.StackSetSpec{
+					Ingress: &zv1.StackSetIngressSpec{},
+					TrafficAnalysis: &zv1.TrafficAnalysisSpec{
+						Address: tc.address,
+						Queries: []zv1.TrafficAnalysisQuery{
+							{
+								Name:      "errors",
+								Query:     `errors{stack="{{ .Stack }}"}`,
+								Threshold: resource.MustParse("0.5"),
+							},
+						},
+					},
+					Traffic: []*zv1.DesiredTraffic{
+						{StackName: "foo-v2", Weight: 100},
+					},
+				},
+				Status: zv1.StackSetStatus{
+					Traffic: []*zv1.ActualTraffic{
+						{StackName: "foo-v1", ServiceName: "foo-v1", Weight: 80},
+						{StackName: "foo-v2", ServiceName: "foo-v2", Weight: 20},
+					},
+					TrafficAnalysis: &zv1.TrafficAnalysisStatus{
+						LastKnownGoodTraffic: []*zv1.DesiredTraffic{
+							{StackName: "foo-v1", Weight: 100},
+						},
+						LastTrafficIncrease: &metav1.Time{Time: time.Now().Add(-time.Minute)},
+					},
+				},
+			}
+
+			container := core.NewContainer(stackset, &core.SimpleTrafficReconciler{}, "", nil, clock.RealClock{})
+			for _, name := range []string{"foo-v1", "foo-v2"} {
+				container.StackContainers[types.UID(name)] = &core.StackContainer{
+					Stack: &zv1.Stack{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      name,
+							Namespace: "default",
+						},
+					},
+				}
+			}
+			require.NoError(t, container.UpdateFromResources())
+
+			err := env.controller.ReconcileTrafficAnalysis(context.Background(), container)
+			if tc.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expectedTraffic, container.GenerateStackSetTraffic())
+		})
+	}
+}
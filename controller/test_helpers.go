@@ -9,9 +9,11 @@ import (
 	rginterface "github.com/szuecs/routegroup-client/client/clientset/versioned"
 	rgfake "github.com/szuecs/routegroup-client/client/clientset/versioned/fake"
 	rgi "github.com/szuecs/routegroup-client/client/clientset/versioned/typed/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	ssinterface "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned"
 	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
+	gwi "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/gateway.networking.k8s.io/v1"
 	zi "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1"
 	ssunified "github.com/zalando-incubator/stackset-controller/pkg/clientset"
 	apps "k8s.io/api/apps/v1"
@@ -19,16 +21,20 @@ import (
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
 var (
-	timeNow = time.Now().Format(time.RFC3339)
+	// testTime is the current time of the clock of the test environment
+	testTime = time.Now().Truncate(time.Second)
+	timeNow  = testTime.Format(time.RFC3339)
 	// ttl for the test environment is time.Minute, here
 	// timeOldEnough is set to twice this value.
-	timeOldEnough = time.Now().Add(-2 * time.Minute).Format(time.RFC3339)
+	timeOldEnough = testTime.Add(-2 * time.Minute).Format(time.RFC3339)
 )
 
 type testClient struct {
@@ -45,6 +51,10 @@ func (c *testClient) RouteGroupV1() rgi.ZalandoV1Interface {
 	return c.rgClient.ZalandoV1()
 }
 
+func (c *testClient) GatewayV1() gwi.GatewayV1Interface {
+	return c.ssClient.GatewayV1()
+}
+
 type testEnvironment struct {
 	client     ssunified.Interface
 	controller *StackSetController
@@ -57,14 +67,12 @@ func NewTestEnvironment() *testEnvironment {
 		rgClient:  rgfake.NewSimpleClientset(),
 	}
 
-	controller, err := NewStackSetController(client, "", "", nil, prometheus.NewPedanticRegistry(), time.Minute, true, time.Minute)
+	controller, err := NewStackSetController(client, "", "", nil, nil, labels.Everything(), prometheus.NewPedanticRegistry(), time.Minute, 1, true, true, time.Minute, "", nil)
 	if err != nil {
 		panic(err)
 	}
 
-	controller.now = func() string {
-		return timeNow
-	}
+	controller.clock = clock.NewFakeClock(testTime)
 
 	return &testEnvironment{
 		client:     client,
@@ -115,6 +123,16 @@ func (f *testEnvironment) CreateIngresses(ctx context.Context, ingresses []netwo
 	return nil
 }
 
+func (f *testEnvironment) CreateHTTPRoutes(ctx context.Context, httproutes []gatewayv1.HTTPRoute) error {
+	for _, httproute := range httproutes {
+		_, err := f.client.GatewayV1().HTTPRoutes(httproute.Namespace).Create(ctx, &httproute, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *testEnvironment) CreateRouteGroups(ctx context.Context, routegroups []rgv1.RouteGroup) error {
 	for _, routegroup := range routegroups {
 		_, err := f.client.RouteGroupV1().RouteGroups(routegroup.Namespace).Create(ctx, &routegroup, metav1.CreateOptions{})
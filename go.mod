@@ -12,6 +12,7 @@ require (
 	github.com/imdario/mergo v0.3.6 // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/prometheus/client_golang v1.9.0
+	github.com/prometheus/common v0.15.0
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.7.0
 	github.com/szuecs/routegroup-client v0.17.8-0.20200915193527-b33447c7d964
@@ -23,4 +24,5 @@ require (
 	k8s.io/client-go v0.19.6
 	k8s.io/code-generator v0.19.6
 	sigs.k8s.io/controller-tools v0.4.1-0.20200911221209-6c9ddb17dfd0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -22,6 +22,8 @@ SRC="github.com"
 GOPKG="$SRC/zalando-incubator/stackset-controller"
 CUSTOM_RESOURCE_NAME="zalando.org"
 CUSTOM_RESOURCE_VERSION="v1"
+GATEWAY_RESOURCE_NAME="gateway.networking.k8s.io"
+GATEWAY_RESOURCE_VERSION="v1"
 
 SCRIPT_ROOT="$(dirname "${BASH_SOURCE[0]}")/.."
 OUTPUT_BASE="$(dirname "${BASH_SOURCE[0]}")/"
@@ -33,11 +35,12 @@ OUTPUT_BASE="$(dirname "${BASH_SOURCE[0]}")/"
 
 OUTPUT_PKG="${GOPKG}/pkg/client"
 APIS_PKG="${GOPKG}/pkg/apis"
-GROUPS_WITH_VERSIONS="${CUSTOM_RESOURCE_NAME}:${CUSTOM_RESOURCE_VERSION}"
+GROUPS_WITH_VERSIONS="${CUSTOM_RESOURCE_NAME}:${CUSTOM_RESOURCE_VERSION},${GATEWAY_RESOURCE_NAME}:${GATEWAY_RESOURCE_VERSION}"
+INPUT_DIRS="${APIS_PKG}/${CUSTOM_RESOURCE_NAME}/${CUSTOM_RESOURCE_VERSION},${APIS_PKG}/${GATEWAY_RESOURCE_NAME}/${GATEWAY_RESOURCE_VERSION}"
 
 echo "Generating deepcopy funcs"
 go run k8s.io/code-generator/cmd/deepcopy-gen \
-  --input-dirs "${APIS_PKG}/${CUSTOM_RESOURCE_NAME}/${CUSTOM_RESOURCE_VERSION}" \
+  --input-dirs "${INPUT_DIRS}" \
   -O zz_generated.deepcopy \
   --bounding-dirs "${APIS_PKG}" \
   --go-header-file "${SCRIPT_ROOT}/hack/boilerplate.go.txt" \
@@ -47,21 +50,21 @@ echo "Generating clientset for ${GROUPS_WITH_VERSIONS} at ${OUTPUT_PKG}/${CLIENT
 go run k8s.io/code-generator/cmd/client-gen \
   --clientset-name versioned \
   --input-base "" \
-  --input "${APIS_PKG}/${CUSTOM_RESOURCE_NAME}/${CUSTOM_RESOURCE_VERSION}" \
+  --input "${INPUT_DIRS}" \
   --output-package "${OUTPUT_PKG}/clientset" \
   --go-header-file "${SCRIPT_ROOT}/hack/boilerplate.go.txt" \
   --output-base "$OUTPUT_BASE"
 
 echo "Generating listers for ${GROUPS_WITH_VERSIONS} at ${OUTPUT_PKG}/listers"
 go run k8s.io/code-generator/cmd/lister-gen \
-  --input-dirs "${APIS_PKG}/${CUSTOM_RESOURCE_NAME}/${CUSTOM_RESOURCE_VERSION}" \
+  --input-dirs "${INPUT_DIRS}" \
   --output-package "${OUTPUT_PKG}/listers" \
   --go-header-file "${SCRIPT_ROOT}/hack/boilerplate.go.txt" \
   --output-base "$OUTPUT_BASE"
 
 echo "Generating informers for ${GROUPS_WITH_VERSIONS} at ${OUTPUT_PKG}/informers"
 go run k8s.io/code-generator/cmd/informer-gen \
-  --input-dirs "${APIS_PKG}/${CUSTOM_RESOURCE_NAME}/${CUSTOM_RESOURCE_VERSION}" \
+  --input-dirs "${INPUT_DIRS}" \
   --versioned-clientset-package "${OUTPUT_PKG}/${CLIENTSET_PKG_NAME:-clientset}/${CLIENTSET_NAME_VERSIONED:-versioned}" \
   --listers-package "${OUTPUT_PKG}/listers" \
   --output-package "${OUTPUT_PKG}/informers" \
@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// PrometheusProvider evaluates traffic analysis queries against a
+// Prometheus compatible HTTP API.
+type PrometheusProvider struct {
+	api promv1.API
+}
+
+// NewPrometheusProvider creates a PrometheusProvider for the API at the
+// given address.
+func NewPrometheusProvider(address string) (*PrometheusProvider, error) {
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, err
+	}
+	return &PrometheusProvider{api: promv1.NewAPI(client)}, nil
+}
+
+// Query evaluates an instant query. The query must return a scalar or a
+// vector with at most one element. An empty vector or a NaN value is
+// reported as no value.
+func (p *PrometheusProvider) Query(ctx context.Context, query string) (float64, bool, error) {
+	result, _, err := p.api.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, false, err
+	}
+
+	var value float64
+	switch v := result.(type) {
+	case *model.Scalar:
+		value = float64(v.Value)
+	case model.Vector:
+		if len(v) == 0 {
+			return 0, false, nil
+		}
+		if len(v) > 1 {
+			return 0, false, fmt.Errorf("query returned %d series, expected one", len(v))
+		}
+		value = float64(v[0].Value)
+	default:
+		return 0, false, fmt.Errorf("unsupported query result type %s", result.Type())
+	}
+
+	if math.IsNaN(value) {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
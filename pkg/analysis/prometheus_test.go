@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fakePrometheus(t *testing.T, results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/query", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+
+		result, ok := results[r.Form.Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"unknown query"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, result)
+	}))
+}
+
+func TestPrometheusProviderQuery(t *testing.T) {
+	server := fakePrometheus(t, map[string]string{
+		"scalar":   `{"resultType":"scalar","result":[1610000000,"0.5"]}`,
+		"vector":   `{"resultType":"vector","result":[{"metric":{"stack":"foo"},"value":[1610000000,"12"]}]}`,
+		"empty":    `{"resultType":"vector","result":[]}`,
+		"nan":      `{"resultType":"vector","result":[{"metric":{},"value":[1610000000,"NaN"]}]}`,
+		"multiple": `{"resultType":"vector","result":[{"metric":{"stack":"foo"},"value":[1610000000,"1"]},{"metric":{"stack":"bar"},"value":[1610000000,"2"]}]}`,
+		"matrix":   `{"resultType":"matrix","result":[{"metric":{},"values":[[1610000000,"1"]]}]}`,
+	})
+	defer server.Close()
+
+	provider, err := NewPrometheusProvider(server.URL)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		query         string
+		expectedValue float64
+		expectedOk    bool
+		expectError   bool
+	}{
+		{query: "scalar", expectedValue: 0.5, expectedOk: true},
+		{query: "vector", expectedValue: 12, expectedOk: true},
+		{query: "empty"},
+		{query: "nan"},
+		{query: "multiple", expectError: true},
+		{query: "matrix", expectError: true},
+		{query: "unknown", expectError: true},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			value, ok, err := provider.Query(context.Background(), tc.query)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedOk, ok)
+			require.Equal(t, tc.expectedValue, value)
+		})
+	}
+}
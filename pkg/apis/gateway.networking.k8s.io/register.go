@@ -0,0 +1,6 @@
+package gateway
+
+const (
+	// GroupName is the group name used in this package.
+	GroupName = "gateway.networking.k8s.io"
+)
@@ -0,0 +1,340 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The types in this package are a copy of the subset of the Gateway API
+// (sigs.k8s.io/gateway-api/apis/v1) the StackSet controller needs for
+// managing HTTPRoutes. The JSON representation is compatible with the
+// upstream types, fields which aren't needed are omitted.
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// HTTPRoute provides a way to route HTTP requests. This includes the
+// capability to match requests by hostname, path, header, or query param.
+// Filters can be used to specify additional processing steps. Backends
+// specify where matching requests should be routed.
+// +k8s:deepcopy-gen=true
+type HTTPRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HTTPRouteSpec `json:"spec"`
+	// +optional
+	Status HTTPRouteStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// HTTPRouteList contains a list of HTTPRoute.
+// +k8s:deepcopy-gen=true
+type HTTPRouteList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HTTPRoute `json:"items"`
+}
+
+// HTTPRouteSpec defines the desired state of HTTPRoute.
+// +k8s:deepcopy-gen=true
+type HTTPRouteSpec struct {
+	// ParentRefs references the resources (usually Gateways) that a Route
+	// wants to be attached to.
+	// +optional
+	ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+	// Hostnames defines a set of hostnames that should match against the
+	// HTTP Host header to select a HTTPRoute used to process the request.
+	// +optional
+	Hostnames []string `json:"hostnames,omitempty"`
+	// Rules are a list of HTTP matchers, filters and actions.
+	// +optional
+	Rules []HTTPRouteRule `json:"rules,omitempty"`
+}
+
+// ParentReference identifies an API object (usually a Gateway) that can be
+// considered a parent of this resource.
+// +k8s:deepcopy-gen=true
+type ParentReference struct {
+	// Group is the group of the referent. Defaults to
+	// gateway.networking.k8s.io.
+	// +optional
+	Group *string `json:"group,omitempty"`
+	// Kind is the kind of the referent. Defaults to Gateway.
+	// +optional
+	Kind *string `json:"kind,omitempty"`
+	// Namespace is the namespace of the referent. Defaults to the
+	// namespace of the Route.
+	// +optional
+	Namespace *string `json:"namespace,omitempty"`
+	// Name is the name of the referent.
+	Name string `json:"name"`
+	// SectionName is the name of a section within the target resource,
+	// e.g. a Gateway listener name.
+	// +optional
+	SectionName *string `json:"sectionName,omitempty"`
+	// Port is the network port this Route targets.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// HTTPRouteRule defines semantics for matching an HTTP request based on
+// conditions (matches), processing it (filters), and forwarding the request
+// to an API object (backendRefs).
+// +k8s:deepcopy-gen=true
+type HTTPRouteRule struct {
+	// Matches define conditions used for matching the rule against
+	// incoming HTTP requests.
+	// +optional
+	Matches []HTTPRouteMatch `json:"matches,omitempty"`
+	// Filters define the filters that are applied to requests that match
+	// this rule.
+	// +optional
+	Filters []HTTPRouteFilter `json:"filters,omitempty"`
+	// BackendRefs defines the backend(s) where matching requests should be
+	// sent.
+	// +optional
+	BackendRefs []HTTPBackendRef `json:"backendRefs,omitempty"`
+}
+
+// HTTPRouteMatch defines the predicate used to match requests to a given
+// action. Multiple match types are ANDed together.
+// +k8s:deepcopy-gen=true
+type HTTPRouteMatch struct {
+	// Path specifies a HTTP request path matcher.
+	// +optional
+	Path *HTTPPathMatch `json:"path,omitempty"`
+	// Headers specifies HTTP request header matchers.
+	// +optional
+	Headers []HTTPHeaderMatch `json:"headers,omitempty"`
+	// QueryParams specifies HTTP query parameter matchers.
+	// +optional
+	QueryParams []HTTPQueryParamMatch `json:"queryParams,omitempty"`
+	// Method specifies HTTP method matcher.
+	// +optional
+	Method *string `json:"method,omitempty"`
+}
+
+// HTTPPathMatch describes how to select a HTTP route by matching the HTTP
+// request path.
+// +k8s:deepcopy-gen=true
+type HTTPPathMatch struct {
+	// Type specifies how to match against the path Value, one of Exact,
+	// PathPrefix or RegularExpression.
+	// +optional
+	Type *string `json:"type,omitempty"`
+	// Value of the HTTP path to match against.
+	// +optional
+	Value *string `json:"value,omitempty"`
+}
+
+// HTTPHeaderMatch describes how to select a HTTP route by matching HTTP
+// request headers.
+// +k8s:deepcopy-gen=true
+type HTTPHeaderMatch struct {
+	// Type specifies how to match against the value of the header, one of
+	// Exact or RegularExpression.
+	// +optional
+	Type *string `json:"type,omitempty"`
+	// Name is the name of the HTTP Header to be matched.
+	Name string `json:"name"`
+	// Value is the value of HTTP Header to be matched.
+	Value string `json:"value"`
+}
+
+// HTTPQueryParamMatch describes how to select a HTTP route by matching HTTP
+// query parameters.
+// +k8s:deepcopy-gen=true
+type HTTPQueryParamMatch struct {
+	// Type specifies how to match against the value of the query parameter,
+	// one of Exact or RegularExpression.
+	// +optional
+	Type *string `json:"type,omitempty"`
+	// Name is the name of the HTTP query param to be matched.
+	Name string `json:"name"`
+	// Value is the value of HTTP query param to be matched.
+	Value string `json:"value"`
+}
+
+// HTTPRouteFilter defines processing steps that must be completed during
+// the request or response lifecycle.
+// +k8s:deepcopy-gen=true
+type HTTPRouteFilter struct {
+	// Type identifies the type of filter to apply, one of
+	// RequestHeaderModifier, ResponseHeaderModifier, RequestMirror,
+	// RequestRedirect or URLRewrite.
+	Type string `json:"type"`
+	// RequestHeaderModifier defines a schema for a filter that modifies
+	// request headers.
+	// +optional
+	RequestHeaderModifier *HTTPHeaderFilter `json:"requestHeaderModifier,omitempty"`
+	// ResponseHeaderModifier defines a schema for a filter that modifies
+	// response headers.
+	// +optional
+	ResponseHeaderModifier *HTTPHeaderFilter `json:"responseHeaderModifier,omitempty"`
+	// RequestMirror defines a schema for a filter that mirrors requests.
+	// +optional
+	RequestMirror *HTTPRequestMirrorFilter `json:"requestMirror,omitempty"`
+	// RequestRedirect defines a schema for a filter that responds to the
+	// request with an HTTP redirection.
+	// +optional
+	RequestRedirect *HTTPRequestRedirectFilter `json:"requestRedirect,omitempty"`
+	// URLRewrite defines a schema for a filter that modifies a request
+	// during forwarding.
+	// +optional
+	URLRewrite *HTTPURLRewriteFilter `json:"urlRewrite,omitempty"`
+}
+
+// HTTPHeader represents an HTTP Header name and value.
+// +k8s:deepcopy-gen=true
+type HTTPHeader struct {
+	// Name is the name of the HTTP Header.
+	Name string `json:"name"`
+	// Value is the value of HTTP Header.
+	Value string `json:"value"`
+}
+
+// HTTPHeaderFilter defines a filter that modifies the headers of an HTTP
+// request or response.
+// +k8s:deepcopy-gen=true
+type HTTPHeaderFilter struct {
+	// Set overwrites the request with the given header (name, value).
+	// +optional
+	Set []HTTPHeader `json:"set,omitempty"`
+	// Add adds the given header(s) (name, value) to the request.
+	// +optional
+	Add []HTTPHeader `json:"add,omitempty"`
+	// Remove the given header(s) from the HTTP request.
+	// +optional
+	Remove []string `json:"remove,omitempty"`
+}
+
+// HTTPRequestMirrorFilter defines configuration for the RequestMirror
+// filter.
+// +k8s:deepcopy-gen=true
+type HTTPRequestMirrorFilter struct {
+	// BackendRef references a resource where mirrored requests are sent.
+	BackendRef BackendObjectReference `json:"backendRef"`
+}
+
+// HTTPRequestRedirectFilter defines a filter that redirects a request.
+// +k8s:deepcopy-gen=true
+type HTTPRequestRedirectFilter struct {
+	// Scheme is the scheme to be used in the value of the Location header
+	// in the response.
+	// +optional
+	Scheme *string `json:"scheme,omitempty"`
+	// Hostname is the hostname to be used in the value of the Location
+	// header in the response.
+	// +optional
+	Hostname *string `json:"hostname,omitempty"`
+	// Path defines parameters used to modify the path of the incoming
+	// request.
+	// +optional
+	Path *HTTPPathModifier `json:"path,omitempty"`
+	// Port is the port to be used in the value of the Location header in
+	// the response.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+	// StatusCode is the HTTP status code to be used in response.
+	// +optional
+	StatusCode *int `json:"statusCode,omitempty"`
+}
+
+// HTTPURLRewriteFilter defines a filter that modifies a request during
+// forwarding.
+// +k8s:deepcopy-gen=true
+type HTTPURLRewriteFilter struct {
+	// Hostname is the value to be used to replace the Host header value
+	// during forwarding.
+	// +optional
+	Hostname *string `json:"hostname,omitempty"`
+	// Path defines a path rewrite.
+	// +optional
+	Path *HTTPPathModifier `json:"path,omitempty"`
+}
+
+// HTTPPathModifier defines configuration for path modifiers.
+// +k8s:deepcopy-gen=true
+type HTTPPathModifier struct {
+	// Type defines the type of path modifier, one of ReplaceFullPath or
+	// ReplacePrefixMatch.
+	Type string `json:"type"`
+	// ReplaceFullPath specifies the value with which to replace the full
+	// path of a request during a rewrite or redirect.
+	// +optional
+	ReplaceFullPath *string `json:"replaceFullPath,omitempty"`
+	// ReplacePrefixMatch specifies the value with which to replace the
+	// prefix match of a request during a rewrite or redirect.
+	// +optional
+	ReplacePrefixMatch *string `json:"replacePrefixMatch,omitempty"`
+}
+
+// HTTPBackendRef defines how a HTTPRoute forwards a HTTP request.
+// +k8s:deepcopy-gen=true
+type HTTPBackendRef struct {
+	BackendRef `json:",inline"`
+	// Filters defined at this level should be executed if and only if the
+	// request is being forwarded to the backend defined here.
+	// +optional
+	Filters []HTTPRouteFilter `json:"filters,omitempty"`
+}
+
+// BackendRef defines how a Route should forward a request to a Kubernetes
+// resource.
+// +k8s:deepcopy-gen=true
+type BackendRef struct {
+	BackendObjectReference `json:",inline"`
+	// Weight specifies the proportion of requests forwarded to the
+	// referenced backend. Defaults to 1.
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+// BackendObjectReference defines how an ObjectReference that is specific
+// to BackendRef.
+// +k8s:deepcopy-gen=true
+type BackendObjectReference struct {
+	// Group is the group of the referent. Defaults to the core API group.
+	// +optional
+	Group *string `json:"group,omitempty"`
+	// Kind is the Kubernetes resource kind of the referent. Defaults to
+	// Service.
+	// +optional
+	Kind *string `json:"kind,omitempty"`
+	// Name is the name of the referent.
+	Name string `json:"name"`
+	// Namespace is the namespace of the backend. Defaults to the namespace
+	// of the Route.
+	// +optional
+	Namespace *string `json:"namespace,omitempty"`
+	// Port specifies the destination port number to use for this resource.
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// HTTPRouteStatus defines the observed state of HTTPRoute.
+// +k8s:deepcopy-gen=true
+type HTTPRouteStatus struct {
+	// Parents is a list of parent resources (usually Gateways) that are
+	// associated with the route, and the status of the route with respect
+	// to each parent.
+	// +optional
+	Parents []RouteParentStatus `json:"parents,omitempty"`
+}
+
+// RouteParentStatus describes the status of a route with respect to an
+// associated Parent.
+// +k8s:deepcopy-gen=true
+type RouteParentStatus struct {
+	// ParentRef corresponds with a ParentRef in the spec that this
+	// RouteParentStatus struct describes the status of.
+	ParentRef ParentReference `json:"parentRef"`
+	// ControllerName is a domain/path string that indicates the name of
+	// the controller that wrote this status.
+	ControllerName string `json:"controllerName"`
+	// Conditions describes the status of the route with respect to the
+	// Gateway, e.g. Accepted and ResolvedRefs.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
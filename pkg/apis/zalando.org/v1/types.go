@@ -1,7 +1,10 @@
 package v1
 
 import (
+	"encoding/json"
+
 	rg "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2beta1"
 	v1 "k8s.io/api/core/v1"
@@ -50,6 +53,11 @@ type StackSetSpec struct {
 	// predicates.
 	// +optional
 	RouteGroup *RouteGroupSpec `json:"routegroup,omitempty"`
+	// HTTPRoute is an alternative to ingress generating a Gateway API
+	// HTTPRoute which switches traffic to stacks via the weights of its
+	// backendRefs.
+	// +optional
+	HTTPRoute *HTTPRouteSpec `json:"httpRoute,omitempty"`
 	// StackLifecycle defines the cleanup rules for old stacks.
 	StackLifecycle StackLifecycle `json:"stackLifecycle"`
 	// StackTemplate container for resources to be created that
@@ -59,6 +67,175 @@ type StackSetSpec struct {
 	// weights. It defines the desired traffic. Clients that
 	// orchestrate traffic switching should write this part.
 	Traffic []*DesiredTraffic `json:"traffic,omitempty"`
+	// ProgressiveTraffic defines a schedule of traffic steps used when
+	// a stack gains traffic. Instead of switching straight to the desired
+	// traffic weight, the actual traffic weight of the stack is increased
+	// step by step. It takes precedence over the prescaling annotation,
+	// stacks aren't prescaled if a schedule is defined.
+	// +optional
+	ProgressiveTraffic *ProgressiveTrafficSpec `json:"progressiveTraffic,omitempty"`
+	// TrafficAnalysis defines queries evaluated while a stack is gaining
+	// traffic. If one of the queries breaches its threshold the traffic
+	// is rolled back to the last known good traffic weights.
+	// +optional
+	TrafficAnalysis *TrafficAnalysisSpec `json:"trafficAnalysis,omitempty"`
+	// AutoPromote makes the controller switch the desired traffic to the
+	// stack of the current version once it becomes ready.
+	// +optional
+	AutoPromote *AutoPromoteSpec `json:"autoPromote,omitempty"`
+	// TrafficHooks defines Jobs which are run for every stack before it
+	// first gets traffic and after it gets all the traffic.
+	// +optional
+	TrafficHooks *TrafficHooks `json:"trafficHooks,omitempty"`
+	// TemplateDriftPolicy defines what happens if the stack template is
+	// changed without changing the version, i.e. if the Stack of the
+	// current version doesn't match the template anymore. The replicas
+	// aren't compared, so the Stack can still be scaled through its scale
+	// subresource.
+	// Defaults to Report.
+	// +optional
+	TemplateDriftPolicy TemplateDriftPolicy `json:"templateDriftPolicy,omitempty"`
+}
+
+// TemplateDriftPolicy defines how the controller handles a Stack of the
+// current version which doesn't match the stack template.
+// +kubebuilder:validation:Enum=Report;InPlaceUpdate
+type TemplateDriftPolicy string
+
+const (
+	// TemplateDriftPolicyReport only reports the drift with the
+	// TemplateDrift condition and an event.
+	TemplateDriftPolicyReport TemplateDriftPolicy = "Report"
+	// TemplateDriftPolicyInPlaceUpdate updates the spec and the template
+	// annotations of the Stack to match the template, so its resources
+	// are rolled.
+	TemplateDriftPolicyInPlaceUpdate TemplateDriftPolicy = "InPlaceUpdate"
+)
+
+// TrafficHooks defines the Jobs run at defined points of the traffic switch
+// to a stack. The Jobs are owned by the stack and are run once per stack.
+// +k8s:deepcopy-gen=true
+type TrafficHooks struct {
+	// PreTrafficSwitch is run once the stack is ready, before it first
+	// gets traffic, e.g. to run smoke tests against its per-stack
+	// hostnames. The traffic of the stack is only increased once the Job
+	// succeeded.
+	// +optional
+	PreTrafficSwitch *TrafficHookJobSpec `json:"preTrafficSwitch,omitempty"`
+	// PostTrafficSwitch is run once the stack gets all the traffic.
+	// +optional
+	PostTrafficSwitch *TrafficHookJobSpec `json:"postTrafficSwitch,omitempty"`
+}
+
+// TrafficHookJobSpec describes the Job of a traffic hook. The name, the
+// namespace and the hostnames of the stack are passed to its containers in
+// the STACK_NAME, STACK_NAMESPACE and STACK_HOSTNAMES environment
+// variables.
+// +k8s:deepcopy-gen=true
+type TrafficHookJobSpec struct {
+	EmbeddedObjectMetaWithAnnotations `json:"metadata,omitempty"`
+	// BackoffLimit is the number of retries before the Job is considered
+	// failed. Defaults to 6.
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds is the time in seconds the Job may run before
+	// it's considered failed.
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// PodTemplate describes the pods of the Job. The restart policy of the
+	// pods defaults to Never.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate TrafficHookPodTemplate `json:"podTemplate"`
+}
+
+// TrafficHookPodTemplate is a PodTemplateSpec which isn't described in the
+// schema of the CRD. The schema already contains the pod template of the
+// stack, with two more for the traffic hooks it would exceed the size
+// limits of etcd. The pod template is validated when the Job is created.
+// +k8s:deepcopy-gen=true
+// +kubebuilder:validation:Type=object
+type TrafficHookPodTemplate struct {
+	PodTemplateSpec `json:"-"`
+}
+
+// MarshalJSON encodes the pod template like a PodTemplateSpec.
+func (t TrafficHookPodTemplate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.PodTemplateSpec)
+}
+
+// UnmarshalJSON decodes the pod template like a PodTemplateSpec.
+func (t *TrafficHookPodTemplate) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.PodTemplateSpec)
+}
+
+// AutoPromoteSpec defines how the stack of the current version is promoted
+// once it becomes ready.
+// +k8s:deepcopy-gen=true
+type AutoPromoteSpec struct {
+	// IntermediateWeight is the traffic weight in percent the stack gets
+	// first, before getting all the traffic. If not set, the stack gets
+	// all the traffic right away.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	// +optional
+	IntermediateWeight *int32 `json:"intermediateWeight,omitempty"`
+	// IntermediateDurationSeconds is the minimum time in seconds the stack
+	// stays on the intermediate weight before getting all the traffic.
+	// Defaults to 300 seconds.
+	// +optional
+	IntermediateDurationSeconds *int64 `json:"intermediateDurationSeconds,omitempty"`
+}
+
+// ProgressiveTrafficSpec defines the steps in which traffic is shifted to a
+// stack gaining traffic.
+// +k8s:deepcopy-gen=true
+type ProgressiveTrafficSpec struct {
+	// Steps is the list of traffic weights in percent a stack goes
+	// through on its way to the desired traffic weight, e.g. [5, 20, 50].
+	// Steps above the desired traffic weight are skipped.
+	// +kubebuilder:validation:MinItems=1
+	Steps []int32 `json:"steps"`
+	// StepDurationSeconds is the minimum time in seconds a stack stays on
+	// a step before moving to the next one.
+	// Defaults to 60 seconds.
+	// +optional
+	StepDurationSeconds *int64 `json:"stepDurationSeconds,omitempty"`
+}
+
+// TrafficAnalysisSpec defines how a traffic switch is analyzed before the
+// new traffic weights are considered good.
+// +k8s:deepcopy-gen=true
+type TrafficAnalysisSpec struct {
+	// Address is the URL of the Prometheus compatible HTTP API used to
+	// evaluate the queries. Defaults to the address configured for the
+	// controller.
+	// +optional
+	Address string `json:"address,omitempty"`
+	// DurationSeconds is the time in seconds the queries must stay below
+	// their thresholds after the last traffic increase before the new
+	// traffic weights are considered good.
+	// Defaults to 300 seconds.
+	// +optional
+	DurationSeconds *int64 `json:"durationSeconds,omitempty"`
+	// Queries is the list of queries evaluated for every stack gaining
+	// traffic.
+	// +kubebuilder:validation:MinItems=1
+	Queries []TrafficAnalysisQuery `json:"queries"`
+}
+
+// TrafficAnalysisQuery is a query evaluated for a stack gaining traffic.
+// +k8s:deepcopy-gen=true
+type TrafficAnalysisQuery struct {
+	// Name of the query, used when reporting a rollback.
+	Name string `json:"name"`
+	// Query is a PromQL query returning a single value. It's a Go template
+	// which can refer to the fields `Namespace`, `StackSet` and `Stack` of
+	// the stack gaining traffic, e.g.
+	// `sum(rate(errors_total{stack="{{ .Stack }}"}[1m]))`.
+	Query string `json:"query"`
+	// Threshold is the maximum value the query may return. The traffic is
+	// rolled back if the query returns a value above it.
+	Threshold resource.Quantity `json:"threshold"`
 }
 
 // EmbeddedObjectMetaWithAnnotations defines the metadata which can be attached
@@ -124,8 +301,73 @@ type RouteGroupSpec struct {
 	AdditionalBackends []rg.RouteGroupBackend `json:"additionalBackends,omitempty"`
 	// Routes is the list of routes to be applied to the routegroup.
 	// +kubebuilder:validation:MinItems=1
-	Routes      []rg.RouteGroupRouteSpec `json:"routes"`
-	BackendPort int                      `json:"backendPort"`
+	Routes []rg.RouteGroupRouteSpec `json:"routes"`
+	// StackRoutes is the list of rules routing the requests matching
+	// headers or cookies to a specific stack, independent of the traffic
+	// weights. E.g. for testing a new stack before it gets any traffic.
+	// The targeted stacks are neither scaled down nor garbage collected.
+	// +optional
+	StackRoutes []StackRoute `json:"stackRoutes,omitempty"`
+	// ShadowTraffic is the list of stacks receiving a mirrored copy of a
+	// percentage of the requests. The responses of the stacks are
+	// discarded.
+	// +optional
+	ShadowTraffic []ShadowTraffic `json:"shadowTraffic,omitempty"`
+	BackendPort   int             `json:"backendPort"`
+}
+
+// ShadowTraffic mirrors a percentage of the requests to a stack.
+// +k8s:deepcopy-gen=true
+type ShadowTraffic struct {
+	// StackName is the name of the stack the requests are mirrored to.
+	StackName string `json:"stackName"`
+	// Weight is the percentage of the requests mirrored to the stack.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+}
+
+// StackRoute routes the requests matching all of its headers and cookies to
+// a stack.
+// +k8s:deepcopy-gen=true
+type StackRoute struct {
+	// StackName is the name of the stack the matching requests are routed
+	// to.
+	StackName string `json:"stackName"`
+	// Headers is the list of request headers which must match.
+	// +optional
+	Headers []StackRouteMatch `json:"headers,omitempty"`
+	// Cookies is the list of request cookies which must match.
+	// +optional
+	Cookies []StackRouteMatch `json:"cookies,omitempty"`
+}
+
+// StackRouteMatch matches the value of a request header or cookie.
+// +k8s:deepcopy-gen=true
+type StackRouteMatch struct {
+	// Name of the header or cookie.
+	Name string `json:"name"`
+	// Value the header or cookie must be equal to.
+	Value string `json:"value"`
+}
+
+// HTTPRouteSpec defines the specification for defining a Gateway API
+// HTTPRoute attached to a StackSet.
+// +k8s:deepcopy-gen=true
+type HTTPRouteSpec struct {
+	EmbeddedObjectMetaWithAnnotations `json:"metadata,omitempty"`
+	// ParentRefs is the list of Gateways the HTTPRoute is attached to.
+	// +kubebuilder:validation:MinItems=1
+	ParentRefs []gatewayv1.ParentReference `json:"parentRefs"`
+	// Hostnames is the list of hostnames to add to the HTTPRoute.
+	Hostnames []string `json:"hostnames"`
+	// Rules is the list of rules to be applied to the HTTPRoute. Rules
+	// without backendRefs get the stacks as backends, weighted by their
+	// traffic. If no rules are specified, all the requests are routed to
+	// the stacks.
+	// +optional
+	Rules       []gatewayv1.HTTPRouteRule `json:"rules,omitempty"`
+	BackendPort int32                     `json:"backendPort"`
 }
 
 // StackLifecycle defines lifecycle of the Stacks of a StackSet.
@@ -142,8 +384,49 @@ type StackLifecycle struct {
 	// not getting traffic are deleted.
 	// +kubebuilder:validation:Minimum=1
 	Limit *int32 `json:"limit,omitempty"`
+	// GCPolicy defines which stacks are deleted first if the number of
+	// Stacks exceeds the limit.
+	// Defaults to CreationTimestamp.
+	// +optional
+	GCPolicy StackGCPolicy `json:"gcPolicy,omitempty"`
+	// MaxAgeSeconds is the maximum age of Stacks not getting traffic when
+	// the GCPolicy is MaxAge. Older Stacks are deleted even if the limit
+	// isn't reached.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxAgeSeconds *int64 `json:"maxAgeSeconds,omitempty"`
+	// ProtectedStacks is the number of Stacks which most recently stopped
+	// getting traffic that are never deleted, so there's always a Stack to
+	// roll back to. Stacks currently getting traffic aren't counted.
+	// Protected Stacks still count against the limit.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ProtectedStacks *int32 `json:"protectedStacks,omitempty"`
+	// RevisionHistoryLimit is the number of stack revisions to keep. A
+	// revision of the stack template is stored for every created Stack,
+	// so a deleted Stack can be recreated to roll back to it.
+	// Defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
 }
 
+// StackGCPolicy defines the order in which Stacks exceeding the limit of a
+// StackSet are deleted.
+// +kubebuilder:validation:Enum=CreationTimestamp;NoTrafficSince;MaxAge
+type StackGCPolicy string
+
+const (
+	// StackGCPolicyCreationTimestamp deletes the oldest Stacks first.
+	StackGCPolicyCreationTimestamp StackGCPolicy = "CreationTimestamp"
+	// StackGCPolicyNoTrafficSince deletes the Stacks which haven't been
+	// getting traffic for the longest time first.
+	StackGCPolicyNoTrafficSince StackGCPolicy = "NoTrafficSince"
+	// StackGCPolicyMaxAge deletes the oldest Stacks first, and
+	// additionally deletes all Stacks older than MaxAgeSeconds.
+	StackGCPolicyMaxAge StackGCPolicy = "MaxAge"
+)
+
 // StackTemplate defines the template used for the Stack created from a
 // StackSet definition.
 // +k8s:deepcopy-gen=true
@@ -296,6 +579,120 @@ type StackSetStatus struct {
 	// Traffic is the actual traffic setting on services for this stackset
 	// +optional
 	Traffic []*ActualTraffic `json:"traffic,omitempty"`
+	// ShadowTraffic is the mirrored traffic setting on services for this
+	// stackset. The weight is the percentage of the requests mirrored to
+	// the stack, in addition to its actual traffic.
+	// +optional
+	ShadowTraffic []*ActualTraffic `json:"shadowTraffic,omitempty"`
+	// TrafficAnalysis holds the state of the traffic analysis.
+	// +optional
+	TrafficAnalysis *TrafficAnalysisStatus `json:"trafficAnalysis,omitempty"`
+	// AutoPromote holds the state of the automatic promotion.
+	// +optional
+	AutoPromote *AutoPromoteStatus `json:"autoPromote,omitempty"`
+	// TrafficHistory holds the most recent traffic switches, the oldest
+	// first.
+	// +optional
+	TrafficHistory []TrafficSwitch `json:"trafficHistory,omitempty"`
+	// Conditions describe the state of the traffic and of the stacks of
+	// the StackSet.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// StackSetConditionTrafficReconciled is true if the actual traffic
+	// matches the desired traffic.
+	StackSetConditionTrafficReconciled = "TrafficReconciled"
+	// StackSetConditionDegraded is true if stacks getting traffic are not
+	// ready.
+	StackSetConditionDegraded = "Degraded"
+	// StackSetConditionTemplateDrift is true if the Stack of the current
+	// version doesn't match the stack template.
+	StackSetConditionTemplateDrift = "TemplateDrift"
+)
+
+// TrafficSwitchResult is the outcome of a traffic switch.
+// +kubebuilder:validation:Enum=Applied;Partial;Blocked
+type TrafficSwitchResult string
+
+const (
+	// TrafficSwitchApplied means the actual traffic matches the desired
+	// traffic after the switch.
+	TrafficSwitchApplied TrafficSwitchResult = "Applied"
+	// TrafficSwitchPartial means the actual traffic moved towards the
+	// desired traffic, e.g. by a progressive step.
+	TrafficSwitchPartial TrafficSwitchResult = "Partial"
+	// TrafficSwitchBlocked means the desired traffic couldn't be applied,
+	// e.g. because the stacks aren't ready.
+	TrafficSwitchBlocked TrafficSwitchResult = "Blocked"
+)
+
+// TrafficSwitch is an entry of the traffic history of a StackSet.
+// +k8s:deepcopy-gen=true
+type TrafficSwitch struct {
+	// Timestamp is the time the traffic was switched.
+	Timestamp metav1.Time `json:"timestamp"`
+	// Reconciler is the traffic reconciler which switched the traffic,
+	// one of simple, prescaling or progressive.
+	// +optional
+	Reconciler string `json:"reconciler,omitempty"`
+	// Result tells if the switch was fully applied or blocked.
+	Result TrafficSwitchResult `json:"result"`
+	// Message explains why the switch was blocked.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Stacks are the traffic weights of the stacks involved in the
+	// switch.
+	Stacks []StackTrafficSwitch `json:"stacks"`
+}
+
+// StackTrafficSwitch holds the traffic weights of a stack during a traffic
+// switch.
+// +k8s:deepcopy-gen=true
+type StackTrafficSwitch struct {
+	StackName string `json:"stackName"`
+	// OldWeight is the actual traffic weight before the switch.
+	// +kubebuilder:validation:Format=float
+	// +kubebuilder:validation:Type=number
+	OldWeight float64 `json:"oldWeight"`
+	// NewWeight is the actual traffic weight after the switch.
+	// +kubebuilder:validation:Format=float
+	// +kubebuilder:validation:Type=number
+	NewWeight float64 `json:"newWeight"`
+	// DesiredWeight is the desired traffic weight at the time of the
+	// switch.
+	// +kubebuilder:validation:Format=float
+	// +kubebuilder:validation:Type=number
+	DesiredWeight float64 `json:"desiredWeight"`
+}
+
+// AutoPromoteStatus holds the state of the automatic promotion.
+// +k8s:deepcopy-gen=true
+type AutoPromoteStatus struct {
+	// StackName is the name of the stack which is being or was last
+	// promoted.
+	StackName string `json:"stackName"`
+	// IntermediateWeightSince is the time the stack got the intermediate
+	// weight. It is unset once the stack got all the traffic.
+	// +optional
+	IntermediateWeightSince *metav1.Time `json:"intermediateWeightSince,omitempty"`
+}
+
+// TrafficAnalysisStatus holds the state of the traffic analysis.
+// +k8s:deepcopy-gen=true
+type TrafficAnalysisStatus struct {
+	// LastKnownGoodTraffic is the last traffic setting which passed the
+	// analysis. The traffic is rolled back to it if a query breaches
+	// its threshold.
+	// +optional
+	LastKnownGoodTraffic []*DesiredTraffic `json:"lastKnownGoodTraffic,omitempty"`
+	// LastTrafficIncrease is the timestamp of the last traffic increase
+	// which is still being analyzed.
+	// +optional
+	LastTrafficIncrease *metav1.Time `json:"lastTrafficIncrease,omitempty"`
 }
 
 // Traffic is the actual traffic setting on services for this
@@ -345,6 +742,7 @@ type StackSetList struct {
 // +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`,description="Number of ready replicas"
 // +kubebuilder:printcolumn:name="Traffic",type=number,JSONPath=`.status.actualTrafficWeight`,description="Current traffic weight for the stack"
 // +kubebuilder:printcolumn:name="No-Traffic-Since",type=date,JSONPath=`.status.noTrafficSince`,description="Time since the stack didn't get any traffic"
+// +kubebuilder:printcolumn:name="Pinned",type=boolean,JSONPath=`.status.pinned`,description="Whether the stack is pinned"
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`,description="Age of the stack"
 // +kubebuilder:subresource:status
 // +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.labelSelector
@@ -389,6 +787,62 @@ type StackSpec struct {
 
 	// Strategy describe the rollout strategy for the underlying deployment
 	Strategy *appsv1.DeploymentStrategy `json:"strategy,omitempty"`
+
+	// ReadinessGates are conditions the stack must meet, next to having
+	// all its replicas ready, before it's considered ready and gets more
+	// traffic.
+	// +optional
+	ReadinessGates []StackReadinessGate `json:"readinessGates,omitempty"`
+
+	// Pin prevents the stack from being scaled down and deleted, e.g. to
+	// keep a known good fallback. The traffic of a pinned stack is still
+	// managed as usual. Ignored in the stack template of a StackSet.
+	// +optional
+	Pin *StackPin `json:"pin,omitempty"`
+}
+
+// StackPin marks a stack as pinned.
+// +k8s:deepcopy-gen=true
+type StackPin struct {
+	// Reason describes why the stack is pinned.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Until is the time the pin expires. The stack is pinned indefinitely
+	// if it's not set.
+	// +optional
+	Until *metav1.Time `json:"until,omitempty"`
+}
+
+// StackReadinessGateType is the type of a readiness gate of a stack.
+type StackReadinessGateType string
+
+const (
+	// StackReadinessGateHPAScalingActive is met if the HPA of the stack
+	// has valid metrics, i.e. its ScalingActive condition is true. It's
+	// always met by stacks without autoscaling.
+	StackReadinessGateHPAScalingActive StackReadinessGateType = "HPAScalingActive"
+	// StackReadinessGateRoutesAccepted is met if the per-stack Ingress,
+	// RouteGroup and HTTPRoute of the stack were accepted, i.e. they have
+	// a load balancer or an Accepted condition in their status.
+	StackReadinessGateRoutesAccepted StackReadinessGateType = "RoutesAccepted"
+	// StackReadinessGateAnnotation is met if the stack has an annotation
+	// with the expected value, e.g. set by an external system.
+	StackReadinessGateAnnotation StackReadinessGateType = "Annotation"
+)
+
+// StackReadinessGate is a condition a stack must meet to be ready.
+// +k8s:deepcopy-gen=true
+type StackReadinessGate struct {
+	// Type of the readiness gate.
+	// +kubebuilder:validation:Enum=HPAScalingActive;RoutesAccepted;Annotation
+	Type StackReadinessGateType `json:"type"`
+	// Annotation is the key of the annotation checked by Annotation
+	// readiness gates.
+	// +optional
+	Annotation string `json:"annotation,omitempty"`
+	// Value is the value the annotation must have. Defaults to "true".
+	// +optional
+	Value string `json:"value,omitempty"`
 }
 
 // StackServiceSpec makes it possible to customize the service generated for
@@ -410,6 +864,12 @@ type StackSpecTemplate struct {
 	StackSpec `json:",inline"`
 	// +kubebuilder:validation:Pattern="^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$"
 	Version string `json:"version"`
+	// AutoVersion derives the version from a hash of the fields of the
+	// stack template defining its resources if Version is empty, so every
+	// change of the pod template, the service, the autoscaling, the
+	// strategy or the readiness gates creates a new Stack.
+	// +optional
+	AutoVersion bool `json:"autoVersion,omitempty"`
 }
 
 // StackStatus is the status part of the Stack.
@@ -446,14 +906,48 @@ type StackStatus struct {
 	// Prescaling current prescaling information
 	// +optional
 	Prescaling PrescalingStatus `json:"prescalingStatus"`
+	// ProgressiveTraffic current progressive traffic information
+	// +optional
+	ProgressiveTraffic ProgressiveTrafficStatus `json:"progressiveTrafficStatus"`
 	// NoTrafficSince is the timestamp defining the last time the stack was
 	// observed getting traffic.
 	NoTrafficSince *metav1.Time `json:"noTrafficSince,omitempty"`
 	// LabelSelector is the label selector used to find all pods managed by
 	// a stack.
 	LabelSelector string `json:"labelSelector,omitempty"`
+	// Pinned is true if the stack has an unexpired pin and is therefore
+	// neither scaled down nor deleted.
+	// +optional
+	Pinned bool `json:"pinned,omitempty"`
+	// Conditions describe the state of the resources and of the traffic
+	// of the Stack.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// StackConditionReady is true if all the replicas of the stack are
+	// updated and ready.
+	StackConditionReady = "Ready"
+	// StackConditionResourcesUpToDate is true if all the resources of the
+	// stack were updated to the current generation of the stack.
+	StackConditionResourcesUpToDate = "ResourcesUpToDate"
+	// StackConditionTrafficSwitching is true while the actual traffic of
+	// the stack differs from the desired traffic.
+	StackConditionTrafficSwitching = "TrafficSwitching"
+	// StackConditionPrescaling is true while the stack is prescaled
+	// before getting more traffic.
+	StackConditionPrescaling = "Prescaling"
+	// StackConditionScaledDown is true if the stack was scaled down after
+	// it didn't get traffic for longer than the scaledown TTL.
+	StackConditionScaledDown = "ScaledDown"
+	// StackConditionPendingRemoval is true if the stack is going to be
+	// deleted.
+	StackConditionPendingRemoval = "PendingRemoval"
+)
+
 // Prescaling hold prescaling information
 // +k8s:deepcopy-gen=true
 type PrescalingStatus struct {
@@ -473,6 +967,22 @@ type PrescalingStatus struct {
 	LastTrafficIncrease *metav1.Time `json:"lastTrafficIncrease,omitempty"`
 }
 
+// ProgressiveTrafficStatus holds the progress of a stack through the
+// progressive traffic steps.
+// +k8s:deepcopy-gen=true
+type ProgressiveTrafficStatus struct {
+	// Active indicates if the stack is currently moving through the steps
+	// +optional
+	Active bool `json:"active"`
+	// Step is the index of the step the stack is currently on
+	// +optional
+	Step int32 `json:"step,omitempty"`
+	// LastStepIncrease is the timestamp when the stack was last moved to
+	// the next step
+	// +optional
+	LastStepIncrease *metav1.Time `json:"lastStepIncrease,omitempty"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // StackList is a list of Stacks.
@@ -22,13 +22,61 @@ package v1
 
 import (
 	zalandoorgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewaynetworkingk8siov1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	v2beta1 "k8s.io/api/autoscaling/v2beta1"
 	v2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoPromoteSpec) DeepCopyInto(out *AutoPromoteSpec) {
+	*out = *in
+	if in.IntermediateWeight != nil {
+		in, out := &in.IntermediateWeight, &out.IntermediateWeight
+		*out = new(int32)
+		**out = **in
+	}
+	if in.IntermediateDurationSeconds != nil {
+		in, out := &in.IntermediateDurationSeconds, &out.IntermediateDurationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoPromoteSpec.
+func (in *AutoPromoteSpec) DeepCopy() *AutoPromoteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoPromoteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoPromoteStatus) DeepCopyInto(out *AutoPromoteStatus) {
+	*out = *in
+	if in.IntermediateWeightSince != nil {
+		in, out := &in.IntermediateWeightSince, &out.IntermediateWeightSince
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoPromoteStatus.
+func (in *AutoPromoteStatus) DeepCopy() *AutoPromoteStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoPromoteStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Autoscaler) DeepCopyInto(out *Autoscaler) {
 	*out = *in
@@ -187,6 +235,42 @@ func (in *HPAScalingRules) DeepCopy() *HPAScalingRules {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPRouteSpec) DeepCopyInto(out *HTTPRouteSpec) {
+	*out = *in
+	in.EmbeddedObjectMetaWithAnnotations.DeepCopyInto(&out.EmbeddedObjectMetaWithAnnotations)
+	if in.ParentRefs != nil {
+		in, out := &in.ParentRefs, &out.ParentRefs
+		*out = make([]gatewaynetworkingk8siov1.ParentReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Hostnames != nil {
+		in, out := &in.Hostnames, &out.Hostnames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]gatewaynetworkingk8siov1.HTTPRouteRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPRouteSpec.
+func (in *HTTPRouteSpec) DeepCopy() *HTTPRouteSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPRouteSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HorizontalPodAutoscaler) DeepCopyInto(out *HorizontalPodAutoscaler) {
 	*out = *in
@@ -344,6 +428,52 @@ func (in *PrescalingStatus) DeepCopy() *PrescalingStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgressiveTrafficSpec) DeepCopyInto(out *ProgressiveTrafficSpec) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.StepDurationSeconds != nil {
+		in, out := &in.StepDurationSeconds, &out.StepDurationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgressiveTrafficSpec.
+func (in *ProgressiveTrafficSpec) DeepCopy() *ProgressiveTrafficSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgressiveTrafficSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgressiveTrafficStatus) DeepCopyInto(out *ProgressiveTrafficStatus) {
+	*out = *in
+	if in.LastStepIncrease != nil {
+		in, out := &in.LastStepIncrease, &out.LastStepIncrease
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgressiveTrafficStatus.
+func (in *ProgressiveTrafficStatus) DeepCopy() *ProgressiveTrafficStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgressiveTrafficStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RouteGroupSpec) DeepCopyInto(out *RouteGroupSpec) {
 	*out = *in
@@ -367,6 +497,18 @@ func (in *RouteGroupSpec) DeepCopyInto(out *RouteGroupSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.StackRoutes != nil {
+		in, out := &in.StackRoutes, &out.StackRoutes
+		*out = make([]StackRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ShadowTraffic != nil {
+		in, out := &in.ShadowTraffic, &out.ShadowTraffic
+		*out = make([]ShadowTraffic, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -380,6 +522,22 @@ func (in *RouteGroupSpec) DeepCopy() *RouteGroupSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShadowTraffic) DeepCopyInto(out *ShadowTraffic) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShadowTraffic.
+func (in *ShadowTraffic) DeepCopy() *ShadowTraffic {
+	if in == nil {
+		return nil
+	}
+	out := new(ShadowTraffic)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Stack) DeepCopyInto(out *Stack) {
 	*out = *in
@@ -421,6 +579,21 @@ func (in *StackLifecycle) DeepCopyInto(out *StackLifecycle) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.MaxAgeSeconds != nil {
+		in, out := &in.MaxAgeSeconds, &out.MaxAgeSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ProtectedStacks != nil {
+		in, out := &in.ProtectedStacks, &out.ProtectedStacks
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
 	return
 }
 
@@ -467,6 +640,84 @@ func (in *StackList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackPin) DeepCopyInto(out *StackPin) {
+	*out = *in
+	if in.Until != nil {
+		in, out := &in.Until, &out.Until
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackPin.
+func (in *StackPin) DeepCopy() *StackPin {
+	if in == nil {
+		return nil
+	}
+	out := new(StackPin)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackReadinessGate) DeepCopyInto(out *StackReadinessGate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackReadinessGate.
+func (in *StackReadinessGate) DeepCopy() *StackReadinessGate {
+	if in == nil {
+		return nil
+	}
+	out := new(StackReadinessGate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRoute) DeepCopyInto(out *StackRoute) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]StackRouteMatch, len(*in))
+		copy(*out, *in)
+	}
+	if in.Cookies != nil {
+		in, out := &in.Cookies, &out.Cookies
+		*out = make([]StackRouteMatch, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRoute.
+func (in *StackRoute) DeepCopy() *StackRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRouteMatch) DeepCopyInto(out *StackRouteMatch) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRouteMatch.
+func (in *StackRouteMatch) DeepCopy() *StackRouteMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRouteMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackServiceSpec) DeepCopyInto(out *StackServiceSpec) {
 	*out = *in
@@ -593,6 +844,11 @@ func (in *StackSetSpec) DeepCopyInto(out *StackSetSpec) {
 		*out = new(RouteGroupSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.HTTPRoute != nil {
+		in, out := &in.HTTPRoute, &out.HTTPRoute
+		*out = new(HTTPRouteSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	in.StackLifecycle.DeepCopyInto(&out.StackLifecycle)
 	in.StackTemplate.DeepCopyInto(&out.StackTemplate)
 	if in.Traffic != nil {
@@ -606,6 +862,26 @@ func (in *StackSetSpec) DeepCopyInto(out *StackSetSpec) {
 			}
 		}
 	}
+	if in.ProgressiveTraffic != nil {
+		in, out := &in.ProgressiveTraffic, &out.ProgressiveTraffic
+		*out = new(ProgressiveTrafficSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficAnalysis != nil {
+		in, out := &in.TrafficAnalysis, &out.TrafficAnalysis
+		*out = new(TrafficAnalysisSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoPromote != nil {
+		in, out := &in.AutoPromote, &out.AutoPromote
+		*out = new(AutoPromoteSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficHooks != nil {
+		in, out := &in.TrafficHooks, &out.TrafficHooks
+		*out = new(TrafficHooks)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -633,6 +909,41 @@ func (in *StackSetStatus) DeepCopyInto(out *StackSetStatus) {
 			}
 		}
 	}
+	if in.ShadowTraffic != nil {
+		in, out := &in.ShadowTraffic, &out.ShadowTraffic
+		*out = make([]*ActualTraffic, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(ActualTraffic)
+				**out = **in
+			}
+		}
+	}
+	if in.TrafficAnalysis != nil {
+		in, out := &in.TrafficAnalysis, &out.TrafficAnalysis
+		*out = new(TrafficAnalysisStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutoPromote != nil {
+		in, out := &in.AutoPromote, &out.AutoPromote
+		*out = new(AutoPromoteStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficHistory != nil {
+		in, out := &in.TrafficHistory, &out.TrafficHistory
+		*out = make([]TrafficSwitch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -675,6 +986,16 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 		*out = new(appsv1.DeploymentStrategy)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ReadinessGates != nil {
+		in, out := &in.ReadinessGates, &out.ReadinessGates
+		*out = make([]StackReadinessGate, len(*in))
+		copy(*out, *in)
+	}
+	if in.Pin != nil {
+		in, out := &in.Pin, &out.Pin
+		*out = new(StackPin)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -709,10 +1030,18 @@ func (in *StackSpecTemplate) DeepCopy() *StackSpecTemplate {
 func (in *StackStatus) DeepCopyInto(out *StackStatus) {
 	*out = *in
 	in.Prescaling.DeepCopyInto(&out.Prescaling)
+	in.ProgressiveTraffic.DeepCopyInto(&out.ProgressiveTraffic)
 	if in.NoTrafficSince != nil {
 		in, out := &in.NoTrafficSince, &out.NoTrafficSince
 		*out = (*in).DeepCopy()
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -743,3 +1072,188 @@ func (in *StackTemplate) DeepCopy() *StackTemplate {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackTrafficSwitch) DeepCopyInto(out *StackTrafficSwitch) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackTrafficSwitch.
+func (in *StackTrafficSwitch) DeepCopy() *StackTrafficSwitch {
+	if in == nil {
+		return nil
+	}
+	out := new(StackTrafficSwitch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficAnalysisQuery) DeepCopyInto(out *TrafficAnalysisQuery) {
+	*out = *in
+	out.Threshold = in.Threshold.DeepCopy()
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficAnalysisQuery.
+func (in *TrafficAnalysisQuery) DeepCopy() *TrafficAnalysisQuery {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficAnalysisQuery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficAnalysisSpec) DeepCopyInto(out *TrafficAnalysisSpec) {
+	*out = *in
+	if in.DurationSeconds != nil {
+		in, out := &in.DurationSeconds, &out.DurationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Queries != nil {
+		in, out := &in.Queries, &out.Queries
+		*out = make([]TrafficAnalysisQuery, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficAnalysisSpec.
+func (in *TrafficAnalysisSpec) DeepCopy() *TrafficAnalysisSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficAnalysisSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficAnalysisStatus) DeepCopyInto(out *TrafficAnalysisStatus) {
+	*out = *in
+	if in.LastKnownGoodTraffic != nil {
+		in, out := &in.LastKnownGoodTraffic, &out.LastKnownGoodTraffic
+		*out = make([]*DesiredTraffic, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(DesiredTraffic)
+				**out = **in
+			}
+		}
+	}
+	if in.LastTrafficIncrease != nil {
+		in, out := &in.LastTrafficIncrease, &out.LastTrafficIncrease
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficAnalysisStatus.
+func (in *TrafficAnalysisStatus) DeepCopy() *TrafficAnalysisStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficAnalysisStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficHookJobSpec) DeepCopyInto(out *TrafficHookJobSpec) {
+	*out = *in
+	in.EmbeddedObjectMetaWithAnnotations.DeepCopyInto(&out.EmbeddedObjectMetaWithAnnotations)
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	in.PodTemplate.DeepCopyInto(&out.PodTemplate)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficHookJobSpec.
+func (in *TrafficHookJobSpec) DeepCopy() *TrafficHookJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficHookJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficHookPodTemplate) DeepCopyInto(out *TrafficHookPodTemplate) {
+	*out = *in
+	in.PodTemplateSpec.DeepCopyInto(&out.PodTemplateSpec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficHookPodTemplate.
+func (in *TrafficHookPodTemplate) DeepCopy() *TrafficHookPodTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficHookPodTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficHooks) DeepCopyInto(out *TrafficHooks) {
+	*out = *in
+	if in.PreTrafficSwitch != nil {
+		in, out := &in.PreTrafficSwitch, &out.PreTrafficSwitch
+		*out = new(TrafficHookJobSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PostTrafficSwitch != nil {
+		in, out := &in.PostTrafficSwitch, &out.PostTrafficSwitch
+		*out = new(TrafficHookJobSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficHooks.
+func (in *TrafficHooks) DeepCopy() *TrafficHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficSwitch) DeepCopyInto(out *TrafficSwitch) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+	if in.Stacks != nil {
+		in, out := &in.Stacks, &out.Stacks
+		*out = make([]StackTrafficSwitch, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficSwitch.
+func (in *TrafficSwitch) DeepCopy() *TrafficSwitch {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficSwitch)
+	in.DeepCopyInto(out)
+	return out
+}
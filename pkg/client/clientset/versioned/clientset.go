@@ -21,6 +21,7 @@ package versioned
 import (
 	"fmt"
 
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/gateway.networking.k8s.io/v1"
 	zalandov1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
@@ -29,6 +30,7 @@ import (
 
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
+	GatewayV1() gatewayv1.GatewayV1Interface
 	ZalandoV1() zalandov1.ZalandoV1Interface
 }
 
@@ -36,9 +38,15 @@ type Interface interface {
 // version included in a Clientset.
 type Clientset struct {
 	*discovery.DiscoveryClient
+	gatewayV1 *gatewayv1.GatewayV1Client
 	zalandoV1 *zalandov1.ZalandoV1Client
 }
 
+// GatewayV1 retrieves the GatewayV1Client
+func (c *Clientset) GatewayV1() gatewayv1.GatewayV1Interface {
+	return c.gatewayV1
+}
+
 // ZalandoV1 retrieves the ZalandoV1Client
 func (c *Clientset) ZalandoV1() zalandov1.ZalandoV1Interface {
 	return c.zalandoV1
@@ -65,6 +73,10 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 	}
 	var cs Clientset
 	var err error
+	cs.gatewayV1, err = gatewayv1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
 	cs.zalandoV1, err = zalandov1.NewForConfig(&configShallowCopy)
 	if err != nil {
 		return nil, err
@@ -81,6 +93,7 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 // panics if there is an error in the config.
 func NewForConfigOrDie(c *rest.Config) *Clientset {
 	var cs Clientset
+	cs.gatewayV1 = gatewayv1.NewForConfigOrDie(c)
 	cs.zalandoV1 = zalandov1.NewForConfigOrDie(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
@@ -90,6 +103,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 // New creates a new Clientset for the given RESTClient.
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
+	cs.gatewayV1 = gatewayv1.New(c)
 	cs.zalandoV1 = zalandov1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
@@ -20,6 +20,8 @@ package fake
 
 import (
 	clientset "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/gateway.networking.k8s.io/v1"
+	fakegatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/gateway.networking.k8s.io/v1/fake"
 	zalandov1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1"
 	fakezalandov1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -76,6 +78,11 @@ func (c *Clientset) Tracker() testing.ObjectTracker {
 
 var _ clientset.Interface = &Clientset{}
 
+// GatewayV1 retrieves the GatewayV1Client
+func (c *Clientset) GatewayV1() gatewayv1.GatewayV1Interface {
+	return &fakegatewayv1.FakeGatewayV1{Fake: &c.Fake}
+}
+
 // ZalandoV1 retrieves the ZalandoV1Client
 func (c *Clientset) ZalandoV1() zalandov1.ZalandoV1Interface {
 	return &fakezalandov1.FakeZalandoV1{Fake: &c.Fake}
@@ -24,6 +24,7 @@ import (
 	time "time"
 
 	versioned "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned"
+	gatewaynetworkingk8sio "github.com/zalando-incubator/stackset-controller/pkg/client/informers/externalversions/gateway.networking.k8s.io"
 	internalinterfaces "github.com/zalando-incubator/stackset-controller/pkg/client/informers/externalversions/internalinterfaces"
 	zalandoorg "github.com/zalando-incubator/stackset-controller/pkg/client/informers/externalversions/zalando.org"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -172,9 +173,14 @@ type SharedInformerFactory interface {
 	ForResource(resource schema.GroupVersionResource) (GenericInformer, error)
 	WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool
 
+	Gateway() gatewaynetworkingk8sio.Interface
 	Zalando() zalandoorg.Interface
 }
 
+func (f *sharedInformerFactory) Gateway() gatewaynetworkingk8sio.Interface {
+	return gatewaynetworkingk8sio.New(f, f.namespace, f.tweakListOptions)
+}
+
 func (f *sharedInformerFactory) Zalando() zalandoorg.Interface {
 	return zalandoorg.New(f, f.namespace, f.tweakListOptions)
 }
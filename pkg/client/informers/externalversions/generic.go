@@ -21,7 +21,8 @@ package externalversions
 import (
 	"fmt"
 
-	v1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
+	zalandoorgv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
@@ -52,10 +53,14 @@ func (f *genericInformer) Lister() cache.GenericLister {
 // TODO extend this to unknown resources with a client pool
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
-	// Group=zalando.org, Version=v1
-	case v1.SchemeGroupVersion.WithResource("stacks"):
+	// Group=gateway.networking.k8s.io, Version=v1
+	case v1.SchemeGroupVersion.WithResource("httproutes"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Gateway().V1().HTTPRoutes().Informer()}, nil
+
+		// Group=zalando.org, Version=v1
+	case zalandoorgv1.SchemeGroupVersion.WithResource("stacks"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Zalando().V1().Stacks().Informer()}, nil
-	case v1.SchemeGroupVersion.WithResource("stacksets"):
+	case zalandoorgv1.SchemeGroupVersion.WithResource("stacksets"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Zalando().V1().StackSets().Informer()}, nil
 
 	}
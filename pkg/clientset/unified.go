@@ -4,6 +4,7 @@ import (
 	rg "github.com/szuecs/routegroup-client/client/clientset/versioned"
 	rgv1 "github.com/szuecs/routegroup-client/client/clientset/versioned/typed/zalando.org/v1"
 	stackset "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/gateway.networking.k8s.io/v1"
 	zalandov1 "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/typed/zalando.org/v1"
 	"k8s.io/client-go/kubernetes"
 	rest "k8s.io/client-go/rest"
@@ -13,6 +14,7 @@ type Interface interface {
 	kubernetes.Interface
 	ZalandoV1() zalandov1.ZalandoV1Interface
 	RouteGroupV1() rgv1.ZalandoV1Interface
+	GatewayV1() gatewayv1.GatewayV1Interface
 }
 
 type Clientset struct {
@@ -55,3 +57,7 @@ func (c *Clientset) ZalandoV1() zalandov1.ZalandoV1Interface {
 func (c *Clientset) RouteGroupV1() rgv1.ZalandoV1Interface {
 	return c.routegroup.ZalandoV1()
 }
+
+func (c *Clientset) GatewayV1() gatewayv1.GatewayV1Interface {
+	return c.stackset.GatewayV1()
+}
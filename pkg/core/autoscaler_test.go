@@ -297,6 +297,10 @@ func pint32(val int) *int32 {
 	return &[]int32{int32(val)}[0]
 }
 
+func pint64(val int) *int64 {
+	return &[]int64{int64(val)}[0]
+}
+
 func generateHPA(minReplicas, maxReplicas int32) StackContainer {
 	return StackContainer{
 		Stack: &zv1.Stack{
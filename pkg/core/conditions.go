@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// conditionSetter updates a list of conditions, the transition time of a
+// condition is only changed if its status changes.
+type conditionSetter struct {
+	conditions []metav1.Condition
+	generation int64
+	now        metav1.Time
+}
+
+func newConditionSetter(existing []metav1.Condition, generation int64, now time.Time) *conditionSetter {
+	conditions := make([]metav1.Condition, len(existing))
+	copy(conditions, existing)
+	return &conditionSetter{
+		conditions: conditions,
+		generation: generation,
+		now:        metav1.NewTime(now),
+	}
+}
+
+func (s *conditionSetter) set(conditionType string, status bool, reason, messageFmt string, args ...interface{}) {
+	conditionStatus := metav1.ConditionFalse
+	if status {
+		conditionStatus = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&s.conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: s.generation,
+		LastTransitionTime: s.now,
+		Reason:             reason,
+		Message:            fmt.Sprintf(messageFmt, args...),
+	})
+}
+
+// generateConditions returns the conditions of the stack derived from the
+// state computed by UpdateFromResources and the traffic management.
+func (sc *StackContainer) generateConditions() []metav1.Condition {
+	conditions := newConditionSetter(sc.Stack.Status.Conditions, sc.Stack.Generation, sc.now())
+
+	switch {
+	case sc.IsReady():
+		conditions.set(zv1.StackConditionReady, true, "ReplicasReady", "%d/%d replicas are ready", sc.readyReplicas, sc.deploymentReplicas)
+	case !sc.resourcesUpdated:
+		conditions.set(zv1.StackConditionReady, false, "ResourcesOutdated", "The resources of the stack are not updated yet")
+	case sc.deploymentReplicas == 0:
+		conditions.set(zv1.StackConditionReady, false, "NoReplicas", "The deployment of the stack has no replicas")
+	case sc.replicasReady():
+		conditions.set(zv1.StackConditionReady, false, "ReadinessGatesNotMet", "%d/%d replicas are ready, readiness gates not met: %s", sc.readyReplicas, sc.deploymentReplicas, strings.Join(sc.unmetReadinessGates, ", "))
+	default:
+		conditions.set(zv1.StackConditionReady, false, "ReplicasNotReady", "%d/%d replicas are ready, %d are updated", sc.readyReplicas, sc.deploymentReplicas, sc.updatedReplicas)
+	}
+
+	if sc.resourcesUpdated {
+		conditions.set(zv1.StackConditionResourcesUpToDate, true, "ResourcesUpToDate", "All resources are updated to generation %d", sc.Stack.Generation)
+	} else {
+		conditions.set(zv1.StackConditionResourcesUpToDate, false, "ResourcesOutdated", "Resources not updated to generation %d: %s", sc.Stack.Generation, strings.Join(sc.outdatedResources, ", "))
+	}
+
+	switch {
+	case sc.desiredTrafficWeight == sc.actualTrafficWeight:
+		conditions.set(zv1.StackConditionTrafficSwitching, false, "TrafficSwitched", "Getting %.1f%% of the traffic", sc.actualTrafficWeight)
+	case sc.preTrafficSwitchHookPending() && sc.preTrafficSwitchHookFailed():
+		conditions.set(zv1.StackConditionTrafficSwitching, true, "PreTrafficSwitchHookFailed", "The pre traffic switch hook Job %s failed, the stack doesn't get traffic", sc.Resources.PreTrafficSwitchJob.Name)
+	case sc.preTrafficSwitchHookPending() && sc.IsReady():
+		conditions.set(zv1.StackConditionTrafficSwitching, true, "WaitingForPreTrafficSwitchHook", "Waiting for the pre traffic switch hook to succeed to increase the traffic to %.1f%%", sc.desiredTrafficWeight)
+	case sc.desiredTrafficWeight > sc.actualTrafficWeight && sc.prescalingActive && sc.readyReplicas < sc.prescalingReplicas:
+		conditions.set(zv1.StackConditionTrafficSwitching, true, "WaitingForPrescaling", "Waiting for %d ready replicas to increase the traffic from %.1f%% to %.1f%%", sc.prescalingReplicas, sc.actualTrafficWeight, sc.desiredTrafficWeight)
+	case sc.desiredTrafficWeight > sc.actualTrafficWeight && !sc.IsReady():
+		conditions.set(zv1.StackConditionTrafficSwitching, true, "WaitingForReadiness", "Waiting for the stack to be ready to increase the traffic from %.1f%% to %.1f%%", sc.actualTrafficWeight, sc.desiredTrafficWeight)
+	default:
+		conditions.set(zv1.StackConditionTrafficSwitching, true, "SwitchingTraffic", "Switching the traffic from %.1f%% to %.1f%%", sc.actualTrafficWeight, sc.desiredTrafficWeight)
+	}
+
+	if sc.prescalingActive {
+		conditions.set(zv1.StackConditionPrescaling, true, "Prescaled", "Prescaled to %d replicas for %.1f%% of the traffic", sc.prescalingReplicas, sc.prescalingDesiredTrafficWeight)
+	} else {
+		conditions.set(zv1.StackConditionPrescaling, false, "NotPrescaled", "The stack is not prescaled")
+	}
+
+	switch {
+	case sc.Pinned():
+		conditions.set(zv1.StackConditionScaledDown, false, "Pinned", "The stack is pinned and is never scaled down")
+	case sc.ScaledDown():
+		conditions.set(zv1.StackConditionScaledDown, true, "NoTraffic", "Scaled down, no traffic since %s", sc.noTrafficSince.Format(time.RFC3339))
+	case !sc.noTrafficSince.IsZero() && !sc.HasTraffic():
+		conditions.set(zv1.StackConditionScaledDown, false, "ScaledownPending", "No traffic since %s, the stack is scaled down after %s", sc.noTrafficSince.Format(time.RFC3339), sc.scaledownTTL)
+	default:
+		conditions.set(zv1.StackConditionScaledDown, false, "Active", "The stack is not scaled down")
+	}
+
+	if sc.PendingRemoval {
+		conditions.set(zv1.StackConditionPendingRemoval, true, "Expired", "The stack exceeds the stack limit of the stackset and is going to be deleted")
+	} else {
+		conditions.set(zv1.StackConditionPendingRemoval, false, "NotExpired", "The stack is not going to be deleted")
+	}
+
+	return conditions.conditions
+}
+
+// generateConditions returns the conditions of the stackset derived from
+// the state of its stacks and the result of the traffic management.
+func (ssc *StackSetContainer) generateConditions() []metav1.Condition {
+	conditions := newConditionSetter(ssc.StackSet.Status.Conditions, ssc.StackSet.Generation, ssc.now())
+
+	var switching, notReady []string
+	for _, sc := range ssc.StackContainers {
+		if sc.PendingRemoval {
+			continue
+		}
+		if sc.desiredTrafficWeight != sc.actualTrafficWeight {
+			switching = append(switching, TrafficChange{
+				StackName:        sc.Name(),
+				OldTrafficWeight: sc.actualTrafficWeight,
+				NewTrafficWeight: sc.desiredTrafficWeight,
+			}.String())
+		}
+		if sc.actualTrafficWeight > 0 && !sc.IsReady() {
+			notReady = append(notReady, sc.Name())
+		}
+	}
+	sort.Strings(switching)
+	sort.Strings(notReady)
+
+	switch {
+	case !ssc.trafficManagementEnabled():
+		conditions.set(zv1.StackSetConditionTrafficReconciled, true, "TrafficNotManaged", "The traffic is not managed by the stackset")
+	case ssc.trafficError != nil:
+		conditions.set(zv1.StackSetConditionTrafficReconciled, false, "TrafficNotSwitched", "Failed to switch traffic: %v", ssc.trafficError)
+	case len(switching) > 0:
+		conditions.set(zv1.StackSetConditionTrafficReconciled, false, "SwitchingTraffic", "Switching traffic: %s", strings.Join(switching, ", "))
+	default:
+		conditions.set(zv1.StackSetConditionTrafficReconciled, true, "TrafficSwitched", "The actual traffic matches the desired traffic")
+	}
+
+	if len(notReady) > 0 {
+		conditions.set(zv1.StackSetConditionDegraded, true, "StacksNotReady", "Stacks getting traffic are not ready: %s", strings.Join(notReady, ", "))
+	} else {
+		conditions.set(zv1.StackSetConditionDegraded, false, "StacksReady", "All stacks getting traffic are ready")
+	}
+
+	if sc := ssc.TemplateDrift(); sc != nil {
+		conditions.set(zv1.StackSetConditionTemplateDrift, true, "TemplateChanged", "The stack template changed without a new version, stack %s doesn't match it", sc.Name())
+	} else {
+		conditions.set(zv1.StackSetConditionTemplateDrift, false, "TemplateUnchanged", "The stack of the current version matches the stack template")
+	}
+
+	return conditions.conditions
+}
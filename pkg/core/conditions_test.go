@@ -0,0 +1,279 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// conditionReasons returns the status and the reason of the conditions by
+// type.
+func conditionReasons(conditions []metav1.Condition) map[string]string {
+	result := make(map[string]string, len(conditions))
+	for _, condition := range conditions {
+		result[condition.Type] = string(condition.Status) + "/" + condition.Reason
+	}
+	return result
+}
+
+func TestStackConditions(t *testing.T) {
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name     string
+		stack    *StackContainer
+		expected map[string]string
+	}{
+		{
+			name:  "ready stack getting traffic",
+			stack: testStack("foo").ready(3).traffic(50, 50).stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "True/ReplicasReady",
+				zv1.StackConditionResourcesUpToDate: "True/ResourcesUpToDate",
+				zv1.StackConditionTrafficSwitching:  "False/TrafficSwitched",
+				zv1.StackConditionPrescaling:        "False/NotPrescaled",
+				zv1.StackConditionScaledDown:        "False/Active",
+				zv1.StackConditionPendingRemoval:    "False/NotExpired",
+			},
+		},
+		{
+			name:  "outdated resources",
+			stack: testStack("foo").deployment(false, 3, 3, 3).stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "False/ResourcesOutdated",
+				zv1.StackConditionResourcesUpToDate: "False/ResourcesOutdated",
+				zv1.StackConditionTrafficSwitching:  "False/TrafficSwitched",
+				zv1.StackConditionPrescaling:        "False/NotPrescaled",
+				zv1.StackConditionScaledDown:        "False/Active",
+				zv1.StackConditionPendingRemoval:    "False/NotExpired",
+			},
+		},
+		{
+			name:  "traffic waiting for the replicas",
+			stack: testStack("foo").deployment(true, 3, 3, 1).traffic(50, 0).stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "False/ReplicasNotReady",
+				zv1.StackConditionResourcesUpToDate: "True/ResourcesUpToDate",
+				zv1.StackConditionTrafficSwitching:  "True/WaitingForReadiness",
+				zv1.StackConditionPrescaling:        "False/NotPrescaled",
+				zv1.StackConditionScaledDown:        "False/Active",
+				zv1.StackConditionPendingRemoval:    "False/NotExpired",
+			},
+		},
+		{
+			name:  "traffic waiting for the prescaling",
+			stack: testStack("foo").ready(3).traffic(50, 0).prescaling(5, 50, now).stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "True/ReplicasReady",
+				zv1.StackConditionResourcesUpToDate: "True/ResourcesUpToDate",
+				zv1.StackConditionTrafficSwitching:  "True/WaitingForPrescaling",
+				zv1.StackConditionPrescaling:        "True/Prescaled",
+				zv1.StackConditionScaledDown:        "False/Active",
+				zv1.StackConditionPendingRemoval:    "False/NotExpired",
+			},
+		},
+		{
+			name:  "traffic decreasing",
+			stack: testStack("foo").ready(3).traffic(20, 50).stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "True/ReplicasReady",
+				zv1.StackConditionResourcesUpToDate: "True/ResourcesUpToDate",
+				zv1.StackConditionTrafficSwitching:  "True/SwitchingTraffic",
+				zv1.StackConditionPrescaling:        "False/NotPrescaled",
+				zv1.StackConditionScaledDown:        "False/Active",
+				zv1.StackConditionPendingRemoval:    "False/NotExpired",
+			},
+		},
+		{
+			name:  "no traffic within the TTL",
+			stack: testStack("foo").ready(3).noTrafficSince(now.Add(-time.Minute)).stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "True/ReplicasReady",
+				zv1.StackConditionResourcesUpToDate: "True/ResourcesUpToDate",
+				zv1.StackConditionTrafficSwitching:  "False/TrafficSwitched",
+				zv1.StackConditionPrescaling:        "False/NotPrescaled",
+				zv1.StackConditionScaledDown:        "False/ScaledownPending",
+				zv1.StackConditionPendingRemoval:    "False/NotExpired",
+			},
+		},
+		{
+			name:  "scaled down and pending removal",
+			stack: testStack("foo").deployment(true, 0, 0, 0).noTrafficSince(now.Add(-time.Hour)).pendingRemoval().stack(),
+			expected: map[string]string{
+				zv1.StackConditionReady:             "False/NoReplicas",
+				zv1.StackConditionResourcesUpToDate: "True/ResourcesUpToDate",
+				zv1.StackConditionTrafficSwitching:  "False/TrafficSwitched",
+				zv1.StackConditionPrescaling:        "False/NotPrescaled",
+				zv1.StackConditionScaledDown:        "True/NoTraffic",
+				zv1.StackConditionPendingRemoval:    "True/Expired",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.stack.scaledownTTL = defaultScaledownTTL
+			tc.stack.clock = clock.NewFakeClock(now)
+
+			conditions := tc.stack.GenerateStackStatus().Conditions
+			require.Equal(t, tc.expected, conditionReasons(conditions))
+			for _, condition := range conditions {
+				require.NotEmpty(t, condition.Message)
+				require.Equal(t, now, condition.LastTransitionTime.Time)
+			}
+		})
+	}
+}
+
+func TestStackConditionsTransitionTime(t *testing.T) {
+	before := time.Now().Add(-time.Hour).Truncate(time.Second)
+	now := time.Now()
+
+	sc := testStack("foo").deployment(true, 3, 3, 1).stack()
+	sc.clock = clock.NewFakeClock(before)
+	sc.Stack.Status.Conditions = sc.GenerateStackStatus().Conditions
+
+	sc.clock = clock.NewFakeClock(now)
+	sc.readyReplicas = 2
+	conditions := sc.GenerateStackStatus().Conditions
+
+	// the reason and message are updated without a transition
+	ready := meta.FindStatusCondition(conditions, zv1.StackConditionReady)
+	require.Equal(t, metav1.ConditionFalse, ready.Status)
+	require.Equal(t, "2/3 replicas are ready, 3 are updated", ready.Message)
+	require.Equal(t, before, ready.LastTransitionTime.Time)
+
+	sc.Stack.Status.Conditions = conditions
+	sc.readyReplicas = 3
+	conditions = sc.GenerateStackStatus().Conditions
+
+	ready = meta.FindStatusCondition(conditions, zv1.StackConditionReady)
+	require.Equal(t, metav1.ConditionTrue, ready.Status)
+	require.Equal(t, now, ready.LastTransitionTime.Time)
+	upToDate := meta.FindStatusCondition(conditions, zv1.StackConditionResourcesUpToDate)
+	require.Equal(t, before, upToDate.LastTransitionTime.Time)
+}
+
+func TestStackSetConditions(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		stacks       []*StackContainer
+		noIngress    bool
+		template     *zv1.StackTemplate
+		trafficError error
+		expected     map[string]string
+		message      string
+	}{
+		{
+			name: "traffic switched",
+			stacks: []*StackContainer{
+				testStack("foo-v1").ready(3).traffic(50, 50).stack(),
+				testStack("foo-v2").ready(3).traffic(50, 50).stack(),
+			},
+			expected: map[string]string{
+				zv1.StackSetConditionTrafficReconciled: "True/TrafficSwitched",
+				zv1.StackSetConditionDegraded:          "False/StacksReady",
+				zv1.StackSetConditionTemplateDrift:     "False/TemplateUnchanged",
+			},
+		},
+		{
+			name: "traffic not switched",
+			stacks: []*StackContainer{
+				testStack("foo-v1").ready(3).traffic(0, 100).stack(),
+				testStack("foo-v2").deployment(true, 3, 3, 0).traffic(100, 0).stack(),
+			},
+			trafficError: errors.New("stacks not ready: foo-v2"),
+			expected: map[string]string{
+				zv1.StackSetConditionTrafficReconciled: "False/TrafficNotSwitched",
+				zv1.StackSetConditionDegraded:          "False/StacksReady",
+				zv1.StackSetConditionTemplateDrift:     "False/TemplateUnchanged",
+			},
+			message: "Failed to switch traffic: stacks not ready: foo-v2",
+		},
+		{
+			name: "traffic switching",
+			stacks: []*StackContainer{
+				testStack("foo-v1").ready(3).traffic(0, 80).stack(),
+				testStack("foo-v2").ready(3).traffic(100, 20).stack(),
+			},
+			expected: map[string]string{
+				zv1.StackSetConditionTrafficReconciled: "False/SwitchingTraffic",
+				zv1.StackSetConditionDegraded:          "False/StacksReady",
+				zv1.StackSetConditionTemplateDrift:     "False/TemplateUnchanged",
+			},
+			message: "Switching traffic: foo-v1: 80.0% to 0.0%, foo-v2: 20.0% to 100.0%",
+		},
+		{
+			name: "stack with traffic not ready",
+			stacks: []*StackContainer{
+				testStack("foo-v1").deployment(true, 3, 3, 1).traffic(100, 100).stack(),
+				testStack("foo-v2").deployment(true, 3, 3, 1).pendingRemoval().traffic(0, 0).stack(),
+			},
+			expected: map[string]string{
+				zv1.StackSetConditionTrafficReconciled: "True/TrafficSwitched",
+				zv1.StackSetConditionDegraded:          "True/StacksNotReady",
+				zv1.StackSetConditionTemplateDrift:     "False/TemplateUnchanged",
+			},
+		},
+		{
+			name: "traffic not managed",
+			stacks: []*StackContainer{
+				testStack("foo-v1").ready(3).stack(),
+			},
+			noIngress: true,
+			expected: map[string]string{
+				zv1.StackSetConditionTrafficReconciled: "True/TrafficNotManaged",
+				zv1.StackSetConditionDegraded:          "False/StacksReady",
+				zv1.StackSetConditionTemplateDrift:     "False/TemplateUnchanged",
+			},
+		},
+		{
+			name: "template changed without a new version",
+			stacks: []*StackContainer{
+				testStack("foo-v1").ready(3).traffic(100, 100).stack(),
+			},
+			template: &zv1.StackTemplate{
+				Spec: zv1.StackSpecTemplate{
+					Version:   "v1",
+					StackSpec: zv1.StackSpec{PodTemplate: testPodTemplate("foo:2")},
+				},
+			},
+			expected: map[string]string{
+				zv1.StackSetConditionTrafficReconciled: "True/TrafficSwitched",
+				zv1.StackSetConditionDegraded:          "False/StacksReady",
+				zv1.StackSetConditionTemplateDrift:     "True/TemplateChanged",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := &zv1.StackSet{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+			if !tc.noIngress {
+				stackset.Spec.Ingress = &zv1.StackSetIngressSpec{}
+			}
+			if tc.template != nil {
+				stackset.Spec.StackTemplate = *tc.template
+			}
+
+			ssc := &StackSetContainer{
+				StackSet:        stackset,
+				StackContainers: make(map[types.UID]*StackContainer),
+				Clock:           clock.RealClock{},
+				trafficError:    tc.trafficError,
+			}
+			for _, sc := range tc.stacks {
+				ssc.StackContainers[types.UID(sc.Name())] = sc
+			}
+
+			conditions := ssc.GenerateStackSetStatus().Conditions
+			require.Equal(t, tc.expected, conditionReasons(conditions))
+			if tc.message != "" {
+				require.Equal(t, tc.message, meta.FindStatusCondition(conditions, zv1.StackSetConditionTrafficReconciled).Message)
+			}
+		})
+	}
+}
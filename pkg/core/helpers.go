@@ -13,7 +13,8 @@ const (
 	KindStackSet = "StackSet"
 	KindStack    = "Stack"
 
-	stackGenerationAnnotationKey = "stackset-controller.zalando.org/stack-generation"
+	stackGenerationAnnotationKey          = "stackset-controller.zalando.org/stack-generation"
+	stackTemplateAnnotationsAnnotationKey = "stackset-controller.zalando.org/template-annotations"
 )
 
 func mergeLabels(labelMaps ...map[string]string) map[string]string {
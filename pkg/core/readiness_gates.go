@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const (
+	defaultReadinessGateAnnotationValue = "true"
+
+	// httpRouteConditionAccepted is the condition set by a gateway
+	// controller on the parents of an HTTPRoute it accepted.
+	httpRouteConditionAccepted = "Accepted"
+)
+
+// checkReadinessGates returns the readiness gates of the stack which aren't
+// met by its resources.
+func (sc *StackContainer) checkReadinessGates() []string {
+	var result []string
+	for _, gate := range sc.Stack.Spec.ReadinessGates {
+		var met bool
+		name := string(gate.Type)
+
+		switch gate.Type {
+		case zv1.StackReadinessGateHPAScalingActive:
+			met = sc.hpaScalingActive()
+		case zv1.StackReadinessGateRoutesAccepted:
+			met = sc.routesAccepted()
+		case zv1.StackReadinessGateAnnotation:
+			value := gate.Value
+			if value == "" {
+				value = defaultReadinessGateAnnotationValue
+			}
+			met = sc.Stack.Annotations[gate.Annotation] == value
+			name = fmt.Sprintf("%s %s=%s", gate.Type, gate.Annotation, value)
+		}
+
+		if !met {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// hpaScalingActive returns true if the HPA of the stack has valid metrics,
+// or if the stack isn't autoscaled.
+func (sc *StackContainer) hpaScalingActive() bool {
+	if !sc.IsAutoscaled() {
+		return true
+	}
+	if sc.Resources.HPA == nil {
+		return false
+	}
+	for _, condition := range sc.Resources.HPA.Status.Conditions {
+		if condition.Type == autoscaling.ScalingActive {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// routesAccepted returns true if the per-stack Ingress, RouteGroup and
+// HTTPRoute were accepted by their controllers.
+func (sc *StackContainer) routesAccepted() bool {
+	if ingress := sc.Resources.Ingress; ingress != nil && len(ingress.Status.LoadBalancer.Ingress) == 0 {
+		return false
+	}
+	if rg := sc.Resources.RouteGroup; rg != nil && len(rg.Status.LoadBalancer.RouteGroup) == 0 {
+		return false
+	}
+	if httpRoute := sc.Resources.HTTPRoute; httpRoute != nil {
+		accepted := false
+		for _, parent := range httpRoute.Status.Parents {
+			if meta.IsStatusConditionTrue(parent.Conditions, httpRouteConditionAccepted) {
+				accepted = true
+			}
+		}
+		if !accepted {
+			return false
+		}
+	}
+	return true
+}
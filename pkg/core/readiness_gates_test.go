@@ -0,0 +1,185 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadinessGates(t *testing.T) {
+	hpa := func(scalingActive v1.ConditionStatus) *autoscaling.HorizontalPodAutoscaler {
+		return &autoscaling.HorizontalPodAutoscaler{
+			Status: autoscaling.HorizontalPodAutoscalerStatus{
+				Conditions: []autoscaling.HorizontalPodAutoscalerCondition{
+					{Type: autoscaling.AbleToScale, Status: v1.ConditionTrue},
+					{Type: autoscaling.ScalingActive, Status: scalingActive},
+				},
+			},
+		}
+	}
+	acceptedIngress := &networking.Ingress{
+		Status: networking.IngressStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{Hostname: "lb.example.org"}},
+			},
+		},
+	}
+	acceptedRouteGroup := &rgv1.RouteGroup{
+		Status: rgv1.RouteGroupStatus{
+			LoadBalancer: rgv1.RouteGroupLoadBalancerStatus{
+				RouteGroup: []rgv1.RouteGroupLoadBalancer{{Hostname: "lb.example.org"}},
+			},
+		},
+	}
+	httpRoute := func(accepted metav1.ConditionStatus) *gatewayv1.HTTPRoute {
+		return &gatewayv1.HTTPRoute{
+			Status: gatewayv1.HTTPRouteStatus{
+				Parents: []gatewayv1.RouteParentStatus{
+					{
+						ParentRef: gatewayv1.ParentReference{Name: "gateway"},
+						Conditions: []metav1.Condition{
+							{Type: httpRouteConditionAccepted, Status: accepted},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		gates       []zv1.StackReadinessGate
+		autoscaled  bool
+		annotations map[string]string
+		resources   StackResources
+		expected    []string
+	}{
+		{
+			name: "no readiness gates",
+		},
+		{
+			name:       "HPA scaling active",
+			gates:      []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateHPAScalingActive}},
+			autoscaled: true,
+			resources:  StackResources{HPA: hpa(v1.ConditionTrue)},
+		},
+		{
+			name:       "HPA without valid metrics",
+			gates:      []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateHPAScalingActive}},
+			autoscaled: true,
+			resources:  StackResources{HPA: hpa(v1.ConditionFalse)},
+			expected:   []string{"HPAScalingActive"},
+		},
+		{
+			name:       "HPA missing",
+			gates:      []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateHPAScalingActive}},
+			autoscaled: true,
+			expected:   []string{"HPAScalingActive"},
+		},
+		{
+			name:  "stack without autoscaling",
+			gates: []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateHPAScalingActive}},
+		},
+		{
+			name:  "routes accepted",
+			gates: []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateRoutesAccepted}},
+			resources: StackResources{
+				Ingress:    acceptedIngress,
+				RouteGroup: acceptedRouteGroup,
+				HTTPRoute:  httpRoute(metav1.ConditionTrue),
+			},
+		},
+		{
+			name:      "ingress not accepted",
+			gates:     []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateRoutesAccepted}},
+			resources: StackResources{Ingress: &networking.Ingress{}, RouteGroup: acceptedRouteGroup},
+			expected:  []string{"RoutesAccepted"},
+		},
+		{
+			name:      "routegroup not accepted",
+			gates:     []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateRoutesAccepted}},
+			resources: StackResources{RouteGroup: &rgv1.RouteGroup{}},
+			expected:  []string{"RoutesAccepted"},
+		},
+		{
+			name:      "httproute not accepted",
+			gates:     []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateRoutesAccepted}},
+			resources: StackResources{HTTPRoute: httpRoute(metav1.ConditionFalse)},
+			expected:  []string{"RoutesAccepted"},
+		},
+		{
+			name:        "annotation set",
+			gates:       []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateAnnotation, Annotation: "example.org/approved"}},
+			annotations: map[string]string{"example.org/approved": "true"},
+		},
+		{
+			name:        "annotation with a custom value",
+			gates:       []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateAnnotation, Annotation: "example.org/checks", Value: "passed"}},
+			annotations: map[string]string{"example.org/checks": "pending"},
+			expected:    []string{"Annotation example.org/checks=passed"},
+		},
+		{
+			name: "multiple gates not met",
+			gates: []zv1.StackReadinessGate{
+				{Type: zv1.StackReadinessGateAnnotation, Annotation: "example.org/approved"},
+				{Type: zv1.StackReadinessGateRoutesAccepted},
+			},
+			resources: StackResources{Ingress: &networking.Ingress{}},
+			expected:  []string{"Annotation example.org/approved=true", "RoutesAccepted"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := testStack("foo-v1").stack()
+			sc.Stack.Spec.ReadinessGates = tc.gates
+			sc.Stack.Annotations = tc.annotations
+			if tc.autoscaled {
+				sc.Stack.Spec.Autoscaler = &zv1.Autoscaler{MaxReplicas: 3}
+			}
+			sc.Resources = tc.resources
+
+			require.Equal(t, tc.expected, sc.checkReadinessGates())
+		})
+	}
+}
+
+func TestReadinessGatesBlockTraffic(t *testing.T) {
+	sc := testStack("foo-v2").ready(3).traffic(100, 0).stack()
+	sc.Stack.Spec.ReadinessGates = []zv1.StackReadinessGate{
+		{Type: zv1.StackReadinessGateAnnotation, Annotation: "example.org/approved"},
+	}
+	sc.unmetReadinessGates = sc.checkReadinessGates()
+	require.False(t, sc.IsReady())
+
+	stacks := map[string]*StackContainer{
+		"foo-v1": testStack("foo-v1").ready(3).traffic(0, 100).stack(),
+		"foo-v2": sc,
+	}
+	for _, reconciler := range []TrafficReconciler{
+		SimpleTrafficReconciler{},
+		PrescalingTrafficReconciler{ResetHPAMinReplicasTimeout: time.Minute},
+	} {
+		err := reconciler.Reconcile(stacks, time.Now())
+		require.EqualError(t, err, "stacks not ready: foo-v2", reconciler.Name())
+	}
+
+	ready := meta.FindStatusCondition(sc.GenerateStackStatus().Conditions, zv1.StackConditionReady)
+	require.Equal(t, metav1.ConditionFalse, ready.Status)
+	require.Equal(t, "ReadinessGatesNotMet", ready.Reason)
+	require.Equal(t, "3/3 replicas are ready, readiness gates not met: Annotation example.org/approved=true", ready.Message)
+
+	// the stack gets traffic once the gate is met
+	sc.Stack.Annotations = map[string]string{"example.org/approved": "true"}
+	sc.unmetReadinessGates = sc.checkReadinessGates()
+	require.True(t, sc.IsReady())
+	require.NoError(t, SimpleTrafficReconciler{}.Reconcile(stacks, time.Now()))
+	require.EqualValues(t, 100, sc.actualTrafficWeight)
+}
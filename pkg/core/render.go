@@ -0,0 +1,135 @@
+package core
+
+import (
+	"sort"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Render returns the resources the controller generates for the stackset
+// without a cluster: the Stack for the current version if it doesn't exist
+// yet, the resources of every stack and the Ingress, RouteGroup and
+// HTTPRoute of the stackset. The desired traffic of the stackset is
+// rendered as if it was switched already, if there is none the current
+// stack gets all the traffic. The container is expected to be populated
+// with the existing stacks only, it's modified while rendering.
+func (ssc *StackSetContainer) Render() ([]runtime.Object, error) {
+	var result []runtime.Object
+
+	if newStack, _ := ssc.NewStack(); newStack != nil {
+		ssc.StackContainers[types.UID(newStack.Name())] = newStack
+		result = append(result, newStack.Stack)
+	}
+
+	stackset := ssc.StackSet
+	if len(stackset.Spec.Traffic) == 0 {
+		stackset.Spec.Traffic = []*zv1.DesiredTraffic{
+			{
+				StackName: generateStackName(stackset, currentStackVersion(stackset)),
+				Weight:    100,
+			},
+		}
+	}
+	stackset.Status.Traffic = nil
+	for _, desired := range stackset.Spec.Traffic {
+		stackset.Status.Traffic = append(stackset.Status.Traffic, &zv1.ActualTraffic{
+			StackName:   desired.StackName,
+			ServiceName: desired.StackName,
+			Weight:      desired.Weight,
+		})
+	}
+
+	err := ssc.UpdateFromResources()
+	if err != nil {
+		return nil, err
+	}
+
+	stacks := make([]*StackContainer, 0, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		stacks = append(stacks, sc)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		return stacks[i].Name() < stacks[j].Name()
+	})
+
+	for _, sc := range stacks {
+		stackResources, err := sc.render()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, stackResources...)
+	}
+
+	ingress, err := ssc.GenerateIngress()
+	if err != nil && err != errNoPaths {
+		return nil, err
+	}
+	if ingress != nil {
+		result = append(result, ingress)
+	}
+
+	routeGroup, err := ssc.GenerateRouteGroup()
+	if err != nil {
+		return nil, err
+	}
+	if routeGroup != nil {
+		result = append(result, routeGroup)
+	}
+
+	httpRoute, err := ssc.GenerateHTTPRoute()
+	if err != nil {
+		return nil, err
+	}
+	if httpRoute != nil {
+		result = append(result, httpRoute)
+	}
+
+	return result, nil
+}
+
+// render returns the resources generated for the stack.
+func (sc *StackContainer) render() ([]runtime.Object, error) {
+	result := []runtime.Object{sc.GenerateDeployment()}
+
+	hpa, err := sc.GenerateHPA()
+	if err != nil {
+		return nil, err
+	}
+	if hpa != nil {
+		result = append(result, hpa)
+	}
+
+	service, err := sc.GenerateService()
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, service)
+
+	ingress, err := sc.GenerateIngress()
+	if err != nil {
+		return nil, err
+	}
+	if ingress != nil {
+		result = append(result, ingress)
+	}
+
+	routeGroup, err := sc.GenerateRouteGroup()
+	if err != nil {
+		return nil, err
+	}
+	if routeGroup != nil {
+		result = append(result, routeGroup)
+	}
+
+	httpRoute, err := sc.GenerateHTTPRoute()
+	if err != nil {
+		return nil, err
+	}
+	if httpRoute != nil {
+		result = append(result, httpRoute)
+	}
+
+	return result, nil
+}
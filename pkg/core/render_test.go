@@ -0,0 +1,145 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestRender(t *testing.T) {
+	podTemplate := zv1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:  "foo",
+					Image: "foo",
+					Ports: []v1.ContainerPort{{ContainerPort: 80}},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name              string
+		stacks            []string
+		traffic           []*zv1.DesiredTraffic
+		expectedResources []string
+		expectedBackends  []string
+	}{
+		{
+			name: "current stack gets all the traffic by default",
+			expectedResources: []string{
+				"*v1.Stack/foo-v2",
+				"*v1.Deployment/foo-v2",
+				"*v1.Service/foo-v2",
+				"*v1.Ingress/foo-v2",
+				"*v1.Ingress/foo",
+			},
+			expectedBackends: []string{"foo-v2"},
+		},
+		{
+			name:   "existing stacks are rendered with the desired traffic",
+			stacks: []string{"foo-v1"},
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+			expectedResources: []string{
+				"*v1.Stack/foo-v2",
+				"*v1.Deployment/foo-v1",
+				"*v1.Service/foo-v1",
+				"*v1.Ingress/foo-v1",
+				"*v1.Deployment/foo-v2",
+				"*v1.Service/foo-v2",
+				"*v1.Ingress/foo-v2",
+				"*v1.Ingress/foo",
+			},
+			expectedBackends: []string{"foo-v1"},
+		},
+		{
+			name:   "current stack isn't rendered again",
+			stacks: []string{"foo-v1", "foo-v2"},
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 50},
+				{StackName: "foo-v2", Weight: 50},
+			},
+			expectedResources: []string{
+				"*v1.Deployment/foo-v1",
+				"*v1.Service/foo-v1",
+				"*v1.Ingress/foo-v1",
+				"*v1.Deployment/foo-v2",
+				"*v1.Service/foo-v2",
+				"*v1.Ingress/foo-v2",
+				"*v1.Ingress/foo",
+			},
+			expectedBackends: []string{"foo-v1", "foo-v2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := &zv1.StackSet{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: APIVersion,
+					Kind:       KindStackSet,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: zv1.StackSetSpec{
+					Ingress: &zv1.StackSetIngressSpec{
+						Hosts:       []string{"foo.example.org"},
+						BackendPort: intstr.FromInt(80),
+					},
+					Traffic: tc.traffic,
+					StackTemplate: zv1.StackTemplate{
+						Spec: zv1.StackSpecTemplate{
+							Version: "v2",
+							StackSpec: zv1.StackSpec{
+								PodTemplate: podTemplate,
+							},
+						},
+					},
+				},
+			}
+
+			ssc := NewContainer(stackset, &SimpleTrafficReconciler{}, "", []string{"example.org"}, clock.RealClock{})
+			for _, name := range tc.stacks {
+				ssc.StackContainers[types.UID(name)] = &StackContainer{
+					Stack: &zv1.Stack{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      name,
+							Namespace: "default",
+						},
+						Spec: zv1.StackSpec{
+							PodTemplate: podTemplate,
+						},
+					},
+				}
+			}
+
+			objects, err := ssc.Render()
+			require.NoError(t, err)
+
+			var resources []string
+			var backends []string
+			for _, object := range objects {
+				resources = append(resources, fmt.Sprintf("%T/%s", object, object.(metav1.Object).GetName()))
+
+				if ingress, ok := object.(*networking.Ingress); ok && ingress.Name == "foo" {
+					for _, path := range ingress.Spec.Rules[0].HTTP.Paths {
+						backends = append(backends, path.Backend.Service.Name)
+					}
+				}
+			}
+			require.Equal(t, tc.expectedResources, resources)
+			require.Equal(t, tc.expectedBackends, backends)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	defaultRevisionHistoryLimit = 10
+)
+
+// GenerateStackRevision returns a ControllerRevision owned by the stackset
+// storing the metadata and the spec of a stack, so the stack can be
+// recreated after it was deleted.
+func (ssc *StackSetContainer) GenerateStackRevision(stack *zv1.Stack, revision int64) (*apps.ControllerRevision, error) {
+	template := &zv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        stack.Name,
+			Labels:      stack.Labels,
+			Annotations: stack.Annotations,
+		},
+		Spec: stack.Spec,
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+
+	stackset := ssc.StackSet
+	return &apps.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      stack.Name,
+			Namespace: stack.Namespace,
+			Labels:    mapCopy(stack.Labels),
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: APIVersion,
+					Kind:       KindStackSet,
+					Name:       stackset.Name,
+					UID:        stackset.UID,
+				},
+			},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}, nil
+}
+
+// ExpiredStackRevisions returns the oldest revisions exceeding the revision
+// history limit of the stackset.
+func (ssc *StackSetContainer) ExpiredStackRevisions(revisions []*apps.ControllerRevision) []*apps.ControllerRevision {
+	limit := defaultRevisionHistoryLimit
+	if ssc.StackSet.Spec.StackLifecycle.RevisionHistoryLimit != nil {
+		limit = int(*ssc.StackSet.Spec.StackLifecycle.RevisionHistoryLimit)
+	}
+	if len(revisions) <= limit {
+		return nil
+	}
+
+	sorted := make([]*apps.ControllerRevision, len(revisions))
+	copy(sorted, revisions)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Revision < sorted[j].Revision
+	})
+	return sorted[:len(sorted)-limit]
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGenerateStackRevision(t *testing.T) {
+	ssc := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: APIVersion, Kind: KindStackSet},
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar", UID: "abc"},
+		},
+	}
+	stack := &zv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-v1",
+			Namespace:       "bar",
+			UID:             "def",
+			ResourceVersion: "123",
+			Labels:          map[string]string{StacksetHeritageLabelKey: "foo", StackVersionLabelKey: "v1"},
+			Annotations:     map[string]string{"example.org/team": "foo"},
+		},
+		Spec: zv1.StackSpec{Replicas: wrapReplicas(3)},
+		Status: zv1.StackStatus{
+			ReadyReplicas: 3,
+		},
+	}
+
+	revision, err := ssc.GenerateStackRevision(stack, 4)
+	require.NoError(t, err)
+	require.Equal(t, metav1.ObjectMeta{
+		Name:      "foo-v1",
+		Namespace: "bar",
+		Labels:    stack.Labels,
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: APIVersion, Kind: KindStackSet, Name: "foo", UID: "abc"},
+		},
+	}, revision.ObjectMeta)
+	require.EqualValues(t, 4, revision.Revision)
+
+	var template zv1.Stack
+	require.NoError(t, json.Unmarshal(revision.Data.Raw, &template))
+	require.Equal(t, zv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo-v1",
+			Labels:      stack.Labels,
+			Annotations: stack.Annotations,
+		},
+		Spec: stack.Spec,
+	}, template)
+}
+
+func TestExpiredStackRevisions(t *testing.T) {
+	revision := func(name string, revision int64) *apps.ControllerRevision {
+		return &apps.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Name: name}, Revision: revision}
+	}
+	revisions := []*apps.ControllerRevision{
+		revision("foo-v3", 3),
+		revision("foo-v1", 1),
+		revision("foo-v4", 4),
+		revision("foo-v2", 2),
+	}
+
+	for _, tc := range []struct {
+		name     string
+		limit    *int32
+		expected []*apps.ControllerRevision
+	}{
+		{
+			name: "default limit",
+		},
+		{
+			name:     "oldest revisions exceeding the limit",
+			limit:    pint32(2),
+			expected: []*apps.ControllerRevision{revisions[1], revisions[3]},
+		},
+		{
+			name:  "limit not reached",
+			limit: pint32(4),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						StackLifecycle: zv1.StackLifecycle{RevisionHistoryLimit: tc.limit},
+					},
+				},
+			}
+			require.Equal(t, tc.expected, ssc.ExpiredStackRevisions(revisions))
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2beta2"
@@ -455,6 +456,56 @@ func (sc *StackContainer) GenerateRouteGroup() (*rgv1.RouteGroup, error) {
 	return result, nil
 }
 
+func (sc *StackContainer) GenerateHTTPRoute() (*gatewayv1.HTTPRoute, error) {
+	if !sc.HasBackendPort() || sc.httpRouteSpec == nil {
+		return nil, nil
+	}
+
+	clusterDomains := make(map[string]struct{}, len(sc.httpRouteSpec.Hostnames))
+	for _, host := range sc.httpRouteSpec.Hostnames {
+		for _, domain := range sc.clusterDomains {
+			if strings.HasSuffix(host, domain) {
+				clusterDomains[domain] = struct{}{}
+			}
+		}
+	}
+
+	if len(clusterDomains) == 0 {
+		return nil, nil
+	}
+
+	hostnames := make([]string, 0, len(clusterDomains))
+	for domain := range clusterDomains {
+		hostnames = append(hostnames, fmt.Sprintf("%s.%s", sc.Name(), domain))
+	}
+
+	// sort hostnames for a stable order
+	sort.Strings(hostnames)
+
+	stacks := map[string]struct{}{sc.Name(): {}}
+	backendRefs := []gatewayv1.HTTPBackendRef{
+		httpBackendRef(sc.Name(), sc.httpRouteSpec.BackendPort, 100),
+	}
+	rules, err := generateHTTPRouteRules(sc.httpRouteSpec.Rules, stacks, backendRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &gatewayv1.HTTPRoute{
+		ObjectMeta: sc.resourceMeta(),
+		Spec: gatewayv1.HTTPRouteSpec{
+			ParentRefs: sc.httpRouteSpec.ParentRefs,
+			Hostnames:  hostnames,
+			Rules:      rules,
+		},
+	}
+
+	// insert annotations
+	result.Annotations = mergeLabels(result.Annotations, sc.httpRouteSpec.Annotations)
+
+	return result, nil
+}
+
 func (sc *StackContainer) GenerateStackStatus() *zv1.StackStatus {
 	prescaling := zv1.PrescalingStatus{}
 	if sc.prescalingActive {
@@ -465,6 +516,14 @@ func (sc *StackContainer) GenerateStackStatus() *zv1.StackStatus {
 			LastTrafficIncrease:  wrapTime(sc.prescalingLastTrafficIncrease),
 		}
 	}
+	progressive := zv1.ProgressiveTrafficStatus{}
+	if sc.progressiveActive {
+		progressive = zv1.ProgressiveTrafficStatus{
+			Active:           sc.progressiveActive,
+			Step:             sc.progressiveStep,
+			LastStepIncrease: wrapTime(sc.progressiveLastStepIncrease),
+		}
+	}
 	return &zv1.StackStatus{
 		ActualTrafficWeight:  sc.actualTrafficWeight,
 		DesiredTrafficWeight: sc.desiredTrafficWeight,
@@ -473,7 +532,10 @@ func (sc *StackContainer) GenerateStackStatus() *zv1.StackStatus {
 		UpdatedReplicas:      sc.updatedReplicas,
 		DesiredReplicas:      sc.deploymentReplicas,
 		Prescaling:           prescaling,
+		ProgressiveTraffic:   progressive,
 		NoTrafficSince:       wrapTime(sc.noTrafficSince),
 		LabelSelector:        labels.Set(sc.selector()).String(),
+		Pinned:               sc.Pinned(),
+		Conditions:           sc.generateConditions(),
 	}
 }
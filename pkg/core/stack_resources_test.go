@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	apps "k8s.io/api/apps/v1"
 	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
@@ -379,6 +380,67 @@ func TestStackGenerateRouteGroup(t *testing.T) {
 	require.Equal(t, expected, rg)
 }
 
+func TestStackGenerateHTTPRoute(t *testing.T) {
+	backendPort := int32(80)
+	intStrBackendPort := intstr.FromInt(int(backendPort))
+	pathPrefix := "PathPrefix"
+	example := "/example"
+	c := &StackContainer{
+		Stack: &zv1.Stack{
+			ObjectMeta: testStackMeta,
+		},
+		stacksetName: "foo",
+		httpRouteSpec: &zv1.HTTPRouteSpec{
+			EmbeddedObjectMetaWithAnnotations: zv1.EmbeddedObjectMetaWithAnnotations{
+				Annotations: map[string]string{"httproute": "annotation"},
+			},
+			ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+			Hostnames:  []string{"foo.example.org", "foo.example.com"},
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					Matches: []gatewayv1.HTTPRouteMatch{
+						{Path: &gatewayv1.HTTPPathMatch{Type: &pathPrefix, Value: &example}},
+					},
+				},
+			},
+			BackendPort: backendPort,
+		},
+		backendPort:    &intStrBackendPort,
+		clusterDomains: []string{"example.org"},
+	}
+	httpRoute, err := c.GenerateHTTPRoute()
+	require.NoError(t, err)
+
+	// Annotations are copied from the httproute as well
+	expectedMeta := testResourceMeta.DeepCopy()
+	expectedMeta.Annotations["httproute"] = "annotation"
+
+	expected := &gatewayv1.HTTPRoute{
+		ObjectMeta: *expectedMeta,
+		Spec: gatewayv1.HTTPRouteSpec{
+			ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+			Hostnames:  []string{"foo-v1.example.org"},
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					Matches: []gatewayv1.HTTPRouteMatch{
+						{Path: &gatewayv1.HTTPPathMatch{Type: &pathPrefix, Value: &example}},
+					},
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						httpBackendRef("foo-v1", backendPort, 100),
+					},
+				},
+			},
+		},
+	}
+	require.Equal(t, expected, httpRoute)
+
+	// No per-stack HTTPRoute without hostnames in the cluster domains
+	c.clusterDomains = []string{"example.net"}
+	httpRoute, err = c.GenerateHTTPRoute()
+	require.NoError(t, err)
+	require.Nil(t, httpRoute)
+}
+
 func TestStackGenerateIngressNone(t *testing.T) {
 	c := &StackContainer{}
 	ingress, err := c.GenerateIngress()
@@ -546,6 +608,7 @@ func TestStackGenerateDeployment(t *testing.T) {
 		prescalingReplicas int32
 		deploymentReplicas int32
 		noTrafficSince     time.Time
+		pin                *zv1.StackPin
 		expectedReplicas   int32
 		maxUnavailable     int
 		maxSurge           int
@@ -582,6 +645,22 @@ func TestStackGenerateDeployment(t *testing.T) {
 			deploymentReplicas: 0,
 			expectedReplicas:   0,
 		},
+		{
+			name:               "stack without traffic isn't scaled down because it's pinned",
+			stackReplicas:      3,
+			deploymentReplicas: 3,
+			noTrafficSince:     time.Now().Add(-time.Hour),
+			pin:                &zv1.StackPin{Until: &metav1.Time{Time: time.Now().Add(time.Hour)}},
+			expectedReplicas:   3,
+		},
+		{
+			name:               "stack without traffic is scaled down because its pin expired",
+			stackReplicas:      3,
+			deploymentReplicas: 3,
+			noTrafficSince:     time.Now().Add(-time.Hour),
+			pin:                &zv1.StackPin{Until: &metav1.Time{Time: time.Now().Add(-time.Minute)}},
+			expectedReplicas:   0,
+		},
 		{
 			name:               "stack running, deployment has zero replicas",
 			stackReplicas:      3,
@@ -700,6 +779,7 @@ func TestStackGenerateDeployment(t *testing.T) {
 					ObjectMeta: testStackMeta,
 					Spec: zv1.StackSpec{
 						Strategy: strategy,
+						Pin:      tc.pin,
 						PodTemplate: zv1.PodTemplateSpec{
 							EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{
 								Labels: map[string]string{
@@ -978,6 +1058,10 @@ func TestGenerateStackStatus(t *testing.T) {
 					LastTrafficIncrease:  wrapTime(tc.prescalingLastTrafficIncrease),
 				},
 			}
+
+			// the conditions are covered by TestStackConditions
+			require.Len(t, status.Conditions, 6)
+			status.Conditions = nil
 			require.Equal(t, expected, status)
 		})
 	}
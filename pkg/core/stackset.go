@@ -1,11 +1,19 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
+	"time"
 
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	corev1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
@@ -17,22 +25,81 @@ const (
 	StackVersionLabelKey     = "stack-version"
 
 	ingressTrafficAuthoritativeAnnotation = "zalando.org/traffic-authoritative"
+
+	stackTemplateHashLength = 10
 )
 
 var (
 	errNoPaths             = errors.New("invalid ingress, no paths defined")
 	errNoStacks            = errors.New("no stacks to assign traffic to")
 	errStackServiceBackend = errors.New("additionalBackends must not reference a Stack Service")
+	errStackServiceRef     = errors.New("backendRefs must not reference a Stack Service")
 )
 
 func currentStackVersion(stackset *zv1.StackSet) string {
 	version := stackset.Spec.StackTemplate.Spec.Version
 	if version == "" {
+		if stackset.Spec.StackTemplate.Spec.AutoVersion {
+			return stackTemplateHash(stackset.Spec.StackTemplate)
+		}
 		version = defaultVersion
 	}
 	return version
 }
 
+// stackTemplateHash returns a stable hash of the stack template used as the
+// version of the stack. Only the fields defining the resources of the stack
+// are hashed, changes of e.g. the replicas or the annotations are handled
+// like with an explicit version. The fields are hashed in a canonical form,
+// so the hash doesn't depend on the order of the fields in the API types,
+// and empty fields are left out, so adding a field doesn't change it.
+func stackTemplateHash(template zv1.StackTemplate) string {
+	spec := template.Spec.StackSpec
+
+	fields := map[string]interface{}{
+		"podTemplate": spec.PodTemplate,
+	}
+	if spec.Service != nil {
+		fields["service"] = spec.Service
+	}
+	if spec.HorizontalPodAutoscaler != nil {
+		fields["horizontalPodAutoscaler"] = spec.HorizontalPodAutoscaler
+	}
+	if spec.Autoscaler != nil {
+		fields["autoscaler"] = spec.Autoscaler
+	}
+	if spec.Strategy != nil {
+		fields["strategy"] = spec.Strategy
+	}
+	if len(spec.ReadinessGates) > 0 {
+		fields["readinessGates"] = spec.ReadinessGates
+	}
+
+	// The API types can always be encoded and decoded
+	data, _ := canonicalJSON(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:stackTemplateHashLength]
+}
+
+// canonicalJSON encodes the value as JSON with the keys of all the objects
+// sorted.
+func canonicalJSON(value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Maps are encoded with sorted keys, unlike structs
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	err = decoder.Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
 func generateStackName(stackset *zv1.StackSet, version string) string {
 	return stackset.Name + "-" + version
 }
@@ -50,6 +117,18 @@ func sanitizeServicePorts(service *zv1.StackServiceSpec) *zv1.StackServiceSpec {
 	return service
 }
 
+// stackSpecFromTemplate returns the spec of a stack created from the stack
+// template of the stackset.
+func stackSpecFromTemplate(stackset *zv1.StackSet) zv1.StackSpec {
+	spec := stackset.Spec.StackTemplate.Spec.StackSpec.DeepCopy()
+	if spec.Service != nil {
+		spec.Service = sanitizeServicePorts(spec.Service)
+	}
+	// the pin is only set on stacks
+	spec.Pin = nil
+	return *spec
+}
+
 // NewStack returns an (optional) stack that should be created
 func (ssc *StackSetContainer) NewStack() (*StackContainer, string) {
 	stackset := ssc.StackSet
@@ -62,11 +141,6 @@ func (ssc *StackSetContainer) NewStack() (*StackContainer, string) {
 	// If the current stack doesn't exist, check that we haven't created it before. We shouldn't recreate
 	// it if it was removed for any reason.
 	if stack == nil && observedStackVersion != stackVersion {
-		var service *zv1.StackServiceSpec
-		if stackset.Spec.StackTemplate.Spec.Service != nil {
-			service = sanitizeServicePorts(stackset.Spec.StackTemplate.Spec.Service)
-		}
-
 		return &StackContainer{
 			Stack: &zv1.Stack{
 				ObjectMeta: metav1.ObjectMeta{
@@ -84,16 +158,9 @@ func (ssc *StackSetContainer) NewStack() (*StackContainer, string) {
 						map[string]string{StacksetHeritageLabelKey: stackset.Name},
 						stackset.Labels,
 						map[string]string{StackVersionLabelKey: stackVersion}),
-					Annotations: stackset.Spec.StackTemplate.Annotations,
-				},
-				Spec: zv1.StackSpec{
-					Replicas:                stackset.Spec.StackTemplate.Spec.Replicas,
-					HorizontalPodAutoscaler: stackset.Spec.StackTemplate.Spec.HorizontalPodAutoscaler.DeepCopy(),
-					Service:                 service,
-					PodTemplate:             stackset.Spec.StackTemplate.Spec.PodTemplate,
-					Autoscaler:              stackset.Spec.StackTemplate.Spec.Autoscaler.DeepCopy(),
-					Strategy:                stackset.Spec.StackTemplate.Spec.Strategy,
+					Annotations: stackAnnotationsFromTemplate(stackset),
 				},
+				Spec: stackSpecFromTemplate(stackset),
 			},
 		}, stackVersion
 	}
@@ -101,38 +168,102 @@ func (ssc *StackSetContainer) NewStack() (*StackContainer, string) {
 	return nil, ""
 }
 
-// MarkExpiredStacks marks stacks that should be deleted
+// MarkExpiredStacks marks stacks that should be deleted according to the
+// limit and the GC policy of the stackset.
 func (ssc *StackSetContainer) MarkExpiredStacks() {
+	lifecycle := ssc.StackSet.Spec.StackLifecycle
+
 	historyLimit := defaultStackLifecycleLimit
-	if ssc.StackSet.Spec.StackLifecycle.Limit != nil {
-		historyLimit = int(*ssc.StackSet.Spec.StackLifecycle.Limit)
+	if lifecycle.Limit != nil {
+		historyLimit = int(*lifecycle.Limit)
+	}
+
+	var maxAge time.Duration
+	if lifecycle.GCPolicy == zv1.StackGCPolicyMaxAge && lifecycle.MaxAgeSeconds != nil {
+		maxAge = time.Duration(*lifecycle.MaxAgeSeconds) * time.Second
 	}
 
 	gcCandidates := make([]*StackContainer, 0, len(ssc.StackContainers))
 
 	for _, sc := range ssc.StackContainers {
-		// Stacks are considered for cleanup if we don't have RouteGroup nor an ingress or if the stack is scaled down because of inactivity
-		hasIngress := sc.routeGroupSpec != nil || sc.ingressSpec != nil || ssc.StackSet.Spec.ExternalIngress != nil
+		// Pinned stacks are never deleted and don't count against the limit
+		if sc.Pinned() {
+			continue
+		}
+
+		// Stacks are considered for cleanup if we don't have RouteGroup, HTTPRoute nor an ingress or if the stack is scaled down because of inactivity
+		hasIngress := sc.routeGroupSpec != nil || sc.httpRouteSpec != nil || sc.ingressSpec != nil || ssc.StackSet.Spec.ExternalIngress != nil
 		if !hasIngress || sc.ScaledDown() {
 			gcCandidates = append(gcCandidates, sc)
 		}
 	}
 
-	// only garbage collect if history limit is reached
-	if len(gcCandidates) <= historyLimit {
+	// only garbage collect if history limit is reached, or if stacks can
+	// expire because of their age
+	if len(gcCandidates) <= historyLimit && maxAge == 0 {
 		return
 	}
 
-	// sort candidates by oldest
+	// sort candidates by the order they should be deleted in
+	now := ssc.now()
 	sort.Slice(gcCandidates, func(i, j int) bool {
-		// TODO: maybe we use noTrafficSince instead of CreationTimeStamp to decide oldest
+		if lifecycle.GCPolicy == zv1.StackGCPolicyNoTrafficSince {
+			lastTrafficI, lastTrafficJ := gcCandidates[i].lastTrafficTime(now), gcCandidates[j].lastTrafficTime(now)
+			if !lastTrafficI.Equal(lastTrafficJ) {
+				return lastTrafficI.Before(lastTrafficJ)
+			}
+		}
 		return gcCandidates[i].Stack.CreationTimestamp.Time.Before(gcCandidates[j].Stack.CreationTimestamp.Time)
 	})
 
+	protected := ssc.protectedStacks()
+
+	// protected stacks count against the limit, the next candidates are
+	// deleted instead
 	excessStacks := len(gcCandidates) - historyLimit
-	for _, sc := range gcCandidates[:excessStacks] {
-		sc.PendingRemoval = true
+	for _, sc := range gcCandidates {
+		if protected[sc] {
+			continue
+		}
+		expired := maxAge > 0 && now.Sub(sc.Stack.CreationTimestamp.Time) > maxAge
+		if excessStacks > 0 || expired {
+			sc.PendingRemoval = true
+		}
+		excessStacks--
+	}
+}
+
+// protectedStacks returns the stacks which most recently stopped getting
+// traffic and must never be garbage collected, so they can be rolled back
+// to. The stacks currently getting traffic are never garbage collected
+// anyway and don't take up a protected slot.
+func (ssc *StackSetContainer) protectedStacks() map[*StackContainer]bool {
+	protectedStacks := ssc.StackSet.Spec.StackLifecycle.ProtectedStacks
+	if protectedStacks == nil || *protectedStacks == 0 {
+		return nil
+	}
+
+	stacks := make([]*StackContainer, 0, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		if !sc.noTrafficSince.IsZero() {
+			stacks = append(stacks, sc)
+		}
 	}
+
+	// sort stacks by the most recently used first
+	sort.Slice(stacks, func(i, j int) bool {
+		lastTrafficI, lastTrafficJ := stacks[i].noTrafficSince, stacks[j].noTrafficSince
+		if !lastTrafficI.Equal(lastTrafficJ) {
+			return lastTrafficI.After(lastTrafficJ)
+		}
+		return stacks[i].Stack.CreationTimestamp.Time.After(stacks[j].Stack.CreationTimestamp.Time)
+	})
+
+	result := make(map[*StackContainer]bool)
+	for i := 0; i < len(stacks) && i < int(*protectedStacks); i++ {
+		result[stacks[i]] = true
+	}
+	return result
 }
 
 func (ssc *StackSetContainer) GenerateRouteGroup() (*rgv1.RouteGroup, error) {
@@ -198,6 +329,20 @@ func (ssc *StackSetContainer) GenerateRouteGroup() (*rgv1.RouteGroup, error) {
 		result.Spec.Backends = append(result.Spec.Backends, additionalBackend)
 	}
 
+	// add the routes of the stack routes and the shadow traffic after the
+	// configured ones
+	stackRoutes, err := generateStackRoutes(stackset.Spec.RouteGroup, stacks)
+	if err != nil {
+		return nil, err
+	}
+	shadowRoutes := generateShadowRoutes(stackset.Spec.RouteGroup, stacks)
+	if len(stackRoutes) > 0 || len(shadowRoutes) > 0 {
+		routes := make([]rgv1.RouteGroupRouteSpec, 0, len(stackset.Spec.RouteGroup.Routes)+len(stackRoutes)+len(shadowRoutes))
+		routes = append(routes, stackset.Spec.RouteGroup.Routes...)
+		routes = append(routes, stackRoutes...)
+		result.Spec.Routes = append(routes, shadowRoutes...)
+	}
+
 	// sort backends/defaultBackends to ensure have a consistent generated RoutGroup resource
 	sort.Slice(result.Spec.Backends, func(i, j int) bool {
 		return result.Spec.Backends[i].Name < result.Spec.Backends[j].Name
@@ -209,6 +354,183 @@ func (ssc *StackSetContainer) GenerateRouteGroup() (*rgv1.RouteGroup, error) {
 	return result, nil
 }
 
+// generateStackRoutes returns the RouteGroup routes for the stack routes of
+// the existing stacks. Every configured route without explicit backends is
+// copied for each stack route, with additional Header and Cookie predicates
+// and the stack as the only backend. Cookie values are matched exactly, like
+// header values.
+func generateStackRoutes(spec *zv1.RouteGroupSpec, stacks map[string]struct{}) ([]rgv1.RouteGroupRouteSpec, error) {
+	var result []rgv1.RouteGroupRouteSpec
+	for _, stackRoute := range spec.StackRoutes {
+		if len(stackRoute.Headers) == 0 && len(stackRoute.Cookies) == 0 {
+			return nil, fmt.Errorf("stackRoute for stack %s must match at least one header or cookie", stackRoute.StackName)
+		}
+
+		// the stack might not exist yet or was already removed
+		if _, ok := stacks[stackRoute.StackName]; !ok {
+			continue
+		}
+
+		predicates := make([]string, 0, len(stackRoute.Headers)+len(stackRoute.Cookies))
+		for _, header := range stackRoute.Headers {
+			predicates = append(predicates, fmt.Sprintf("Header(%s, %s)", strconv.Quote(header.Name), strconv.Quote(header.Value)))
+		}
+		for _, cookie := range stackRoute.Cookies {
+			// the value of the Cookie predicate is a regular expression
+			value := "^" + regexp.QuoteMeta(cookie.Value) + "$"
+			predicates = append(predicates, fmt.Sprintf("Cookie(%s, %s)", strconv.Quote(cookie.Name), strconv.Quote(value)))
+		}
+
+		for _, route := range spec.Routes {
+			if len(route.Backends) > 0 {
+				continue
+			}
+			generated := *route.DeepCopy()
+			generated.Predicates = append(generated.Predicates, predicates...)
+			generated.Backends = []rgv1.RouteGroupBackendReference{
+				{
+					BackendName: stackRoute.StackName,
+					Weight:      100,
+				},
+			}
+			result = append(result, generated)
+		}
+	}
+	return result, nil
+}
+
+// generateShadowRoutes returns the RouteGroup routes mirroring requests to
+// the stacks receiving shadow traffic. Every configured route without
+// explicit backends gets a copy which, for the configured percentage of the
+// requests, sends a copy of the request through a loopback (teeLoopback)
+// and a copy routing the mirrored requests (Tee) to the stack.
+func generateShadowRoutes(spec *zv1.RouteGroupSpec, stacks map[string]struct{}) []rgv1.RouteGroupRouteSpec {
+	var result []rgv1.RouteGroupRouteSpec
+	for _, shadow := range spec.ShadowTraffic {
+		// the stack might not exist yet or was already removed
+		if _, ok := stacks[shadow.StackName]; !ok || shadow.Weight <= 0 {
+			continue
+		}
+
+		teeKey := strconv.Quote(shadow.StackName)
+		for _, route := range spec.Routes {
+			if len(route.Backends) > 0 {
+				continue
+			}
+
+			mirrored := *route.DeepCopy()
+			mirrored.Predicates = append(mirrored.Predicates, fmt.Sprintf("Traffic(%g)", float64(shadow.Weight)/100))
+			mirrored.Filters = append(mirrored.Filters, fmt.Sprintf("teeLoopback(%s)", teeKey))
+
+			shadowed := *route.DeepCopy()
+			shadowed.Predicates = append(shadowed.Predicates, fmt.Sprintf("Tee(%s)", teeKey))
+			shadowed.Backends = []rgv1.RouteGroupBackendReference{
+				{
+					BackendName: shadow.StackName,
+					Weight:      100,
+				},
+			}
+
+			result = append(result, mirrored, shadowed)
+		}
+	}
+	return result
+}
+
+func (ssc *StackSetContainer) GenerateHTTPRoute() (*gatewayv1.HTTPRoute, error) {
+	stackset := ssc.StackSet
+	if stackset.Spec.HTTPRoute == nil {
+		return nil, nil
+	}
+
+	labels := mergeLabels(
+		map[string]string{StacksetHeritageLabelKey: stackset.Name},
+		stackset.Labels,
+	)
+
+	// Generate the weighted backends of the stacks getting traffic
+	stacks := make(map[string]struct{}, len(ssc.StackContainers))
+	backendRefs := make([]gatewayv1.HTTPBackendRef, 0, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		stacks[sc.Name()] = struct{}{}
+		if sc.actualTrafficWeight > 0 {
+			backendRefs = append(backendRefs, httpBackendRef(sc.Name(), stackset.Spec.HTTPRoute.BackendPort, int32(sc.actualTrafficWeight)))
+		}
+	}
+
+	// sort backendRefs to ensure have a consistent generated HTTPRoute resource
+	sort.Slice(backendRefs, func(i, j int) bool {
+		return backendRefs[i].Name < backendRefs[j].Name
+	})
+
+	rules, err := generateHTTPRouteRules(stackset.Spec.HTTPRoute.Rules, stacks, backendRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        stackset.Name,
+			Namespace:   stackset.Namespace,
+			Labels:      labels,
+			Annotations: stackset.Spec.HTTPRoute.Annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: stackset.APIVersion,
+					Kind:       stackset.Kind,
+					Name:       stackset.Name,
+					UID:        stackset.UID,
+				},
+			},
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			ParentRefs: stackset.Spec.HTTPRoute.ParentRefs,
+			Hostnames:  stackset.Spec.HTTPRoute.Hostnames,
+			Rules:      rules,
+		},
+	}, nil
+}
+
+// generateHTTPRouteRules returns a copy of the configured HTTPRoute rules
+// where the rules without backendRefs route to the provided backendRefs. If no
+// rules are configured, a single rule routing all the requests to the
+// backendRefs is returned. Explicit backendRefs must not reference one of the
+// stacks.
+func generateHTTPRouteRules(configured []gatewayv1.HTTPRouteRule, stacks map[string]struct{}, backendRefs []gatewayv1.HTTPBackendRef) ([]gatewayv1.HTTPRouteRule, error) {
+	if len(configured) == 0 {
+		return []gatewayv1.HTTPRouteRule{{BackendRefs: backendRefs}}, nil
+	}
+
+	rules := make([]gatewayv1.HTTPRouteRule, 0, len(configured))
+	for _, rule := range configured {
+		generated := *rule.DeepCopy()
+		for _, ref := range generated.BackendRefs {
+			if _, ok := stacks[ref.Name]; ok {
+				return nil, errStackServiceRef
+			}
+		}
+		if len(generated.BackendRefs) == 0 {
+			generated.BackendRefs = backendRefs
+		}
+		rules = append(rules, generated)
+	}
+	return rules, nil
+}
+
+// httpBackendRef returns a weighted HTTPRoute backendRef for the service of a
+// stack.
+func httpBackendRef(serviceName string, port, weight int32) gatewayv1.HTTPBackendRef {
+	return gatewayv1.HTTPBackendRef{
+		BackendRef: gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Name: serviceName,
+				Port: &port,
+			},
+			Weight: &weight,
+		},
+	}
+}
+
 func (ssc *StackSetContainer) GenerateIngress() (*networking.Ingress, error) {
 	stackset := ssc.StackSet
 	if stackset.Spec.Ingress == nil {
@@ -311,7 +633,7 @@ func (ssc *StackSetContainer) GenerateStackSetStatus() *zv1.StackSetStatus {
 		StacksWithTraffic:    0,
 		ObservedStackVersion: ssc.StackSet.Status.ObservedStackVersion,
 	}
-	var traffic []*zv1.ActualTraffic
+	var traffic, shadowTraffic []*zv1.ActualTraffic
 
 	for _, sc := range ssc.StackContainers {
 		if sc.PendingRemoval {
@@ -325,6 +647,15 @@ func (ssc *StackSetContainer) GenerateStackSetStatus() *zv1.StackSetStatus {
 				Weight:      sc.actualTrafficWeight,
 			}
 			traffic = append(traffic, t)
+
+			if sc.HasShadowTraffic() {
+				shadowTraffic = append(shadowTraffic, &zv1.ActualTraffic{
+					StackName:   sc.Name(),
+					ServiceName: sc.Name(),
+					ServicePort: *sc.backendPort,
+					Weight:      sc.shadowTrafficWeight,
+				})
+			}
 		}
 
 		result.Stacks += 1
@@ -338,7 +669,15 @@ func (ssc *StackSetContainer) GenerateStackSetStatus() *zv1.StackSetStatus {
 	sort.Slice(traffic, func(i, j int) bool {
 		return traffic[i].StackName < traffic[j].StackName
 	})
+	sort.Slice(shadowTraffic, func(i, j int) bool {
+		return shadowTraffic[i].StackName < shadowTraffic[j].StackName
+	})
 	result.Traffic = traffic
+	result.ShadowTraffic = shadowTraffic
+	result.TrafficAnalysis = ssc.generateTrafficAnalysisStatus()
+	result.AutoPromote = ssc.generateAutoPromoteStatus()
+	result.TrafficHistory = ssc.generateTrafficHistory()
+	result.Conditions = ssc.generateConditions()
 	return result
 }
 
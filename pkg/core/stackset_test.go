@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	"github.com/zalando-incubator/stackset-controller/pkg/traffic"
 	apps "k8s.io/api/apps/v1"
@@ -15,6 +16,7 @@ import (
 	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -40,6 +42,17 @@ func TestExpiredStacks(t *testing.T) {
 			},
 			expected: map[string]bool{"stack2": true},
 		},
+		{
+			name:       "stacks targeted by a stack route aren't GCed",
+			limit:      1,
+			routegroup: true,
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stackRoute().stack(),
+				testStack("stack3").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack3": true},
+		},
 		{
 			name:       "test GC oldest RouteGroup stack",
 			limit:      1,
@@ -182,6 +195,141 @@ func TestExpiredStacks(t *testing.T) {
 	}
 }
 
+func TestExpiredStacksGCPolicy(t *testing.T) {
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name      string
+		lifecycle zv1.StackLifecycle
+		stacks    []*StackContainer
+		expected  map[string]bool
+	}{
+		{
+			name:      "CreationTimestamp deletes the oldest stack",
+			lifecycle: zv1.StackLifecycle{GCPolicy: zv1.StackGCPolicyCreationTimestamp},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack2": true},
+		},
+		{
+			name:      "NoTrafficSince deletes the stack without traffic for the longest time",
+			lifecycle: zv1.StackLifecycle{GCPolicy: zv1.StackGCPolicyNoTrafficSince},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack1": true},
+		},
+		{
+			name:      "NoTrafficSince falls back to the creation timestamp",
+			lifecycle: zv1.StackLifecycle{GCPolicy: zv1.StackGCPolicyNoTrafficSince},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack2": true},
+		},
+		{
+			name:      "MaxAge deletes stacks older than the max age below the limit",
+			lifecycle: zv1.StackLifecycle{Limit: pint32(5), GCPolicy: zv1.StackGCPolicyMaxAge, MaxAgeSeconds: pint64(7200)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack3").createdAt(now.Add(-4*time.Hour)).noTrafficSince(now.Add(-1*time.Hour)).traffic(1, 1).stack(),
+			},
+			expected: map[string]bool{"stack2": true},
+		},
+		{
+			name:      "MaxAge still enforces the limit",
+			lifecycle: zv1.StackLifecycle{GCPolicy: zv1.StackGCPolicyMaxAge, MaxAgeSeconds: pint64(7200)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-90 * time.Minute)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack2": true},
+		},
+		{
+			name:      "the most recently used stacks are protected",
+			lifecycle: zv1.StackLifecycle{ProtectedStacks: pint32(2)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1*time.Hour)).traffic(1, 1).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack3").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+				testStack("stack4").createdAt(now.Add(-4 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack4": true},
+		},
+		{
+			name:      "stacks getting traffic don't take up protected slots",
+			lifecycle: zv1.StackLifecycle{ProtectedStacks: pint32(1)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1*time.Hour)).traffic(100, 100).stack(),
+				testStack("stack2").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack3").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack3": true},
+		},
+		{
+			name:      "protected stacks count against the limit",
+			lifecycle: zv1.StackLifecycle{Limit: pint32(2), ProtectedStacks: pint32(1)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+				testStack("stack3").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack2": true},
+		},
+		{
+			name:      "pinned stacks are never deleted and don't count against the limit",
+			lifecycle: zv1.StackLifecycle{GCPolicy: zv1.StackGCPolicyMaxAge, MaxAgeSeconds: pint64(60)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).pinned(time.Time{}).stack(),
+				testStack("stack3").createdAt(now.Add(-3 * time.Hour)).noTrafficSince(now.Add(-3 * time.Hour)).pinned(now.Add(time.Hour)).stack(),
+				testStack("stack4").createdAt(now.Add(-4 * time.Hour)).noTrafficSince(now.Add(-4 * time.Hour)).pinned(now.Add(-time.Hour)).stack(),
+			},
+			expected: map[string]bool{"stack1": true, "stack4": true},
+		},
+		{
+			name:      "protected stacks are never deleted",
+			lifecycle: zv1.StackLifecycle{Limit: pint32(1), GCPolicy: zv1.StackGCPolicyMaxAge, MaxAgeSeconds: pint64(60), ProtectedStacks: pint32(3)},
+			stacks: []*StackContainer{
+				testStack("stack1").createdAt(now.Add(-1 * time.Hour)).noTrafficSince(now.Add(-1 * time.Hour)).stack(),
+				testStack("stack2").createdAt(now.Add(-2 * time.Hour)).noTrafficSince(now.Add(-2 * time.Hour)).stack(),
+			},
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lifecycle := tc.lifecycle
+			if lifecycle.Limit == nil {
+				lifecycle.Limit = pint32(1)
+			}
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						StackLifecycle: lifecycle,
+					},
+				},
+				StackContainers:             map[types.UID]*StackContainer{},
+				backendWeightsAnnotationKey: traffic.DefaultBackendWeightsAnnotationKey,
+			}
+			for _, stack := range tc.stacks {
+				stack.scaledownTTL = defaultScaledownTTL
+				stack.ingressSpec = &zv1.StackSetIngressSpec{}
+				c.StackContainers[types.UID(stack.Name())] = stack
+			}
+
+			c.MarkExpiredStacks()
+			for _, stack := range tc.stacks {
+				require.Equal(t, tc.expected[stack.Name()], stack.PendingRemoval, "stack %s", stack.Stack.Name)
+			}
+		})
+	}
+}
+
 func TestSanitizeServicePorts(t *testing.T) {
 	service := &zv1.StackServiceSpec{
 		Ports: []v1.ServicePort{
@@ -196,6 +344,158 @@ func TestSanitizeServicePorts(t *testing.T) {
 	require.Equal(t, v1.ProtocolTCP, service.Ports[0].Protocol)
 }
 
+func TestCurrentStackVersion(t *testing.T) {
+	template := zv1.StackTemplate{
+		Spec: zv1.StackSpecTemplate{
+			StackSpec: zv1.StackSpec{
+				Replicas: wrapReplicas(3),
+				PodTemplate: zv1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{Name: "foo", Image: "foo:1"}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		version     string
+		autoVersion bool
+		expected    string
+	}{
+		{
+			name:     "explicit version",
+			version:  "v1",
+			expected: "v1",
+		},
+		{
+			name:        "explicit version with auto version",
+			version:     "v1",
+			autoVersion: true,
+			expected:    "v1",
+		},
+		{
+			name:     "default version",
+			expected: defaultVersion,
+		},
+		{
+			name:        "version from the template hash",
+			autoVersion: true,
+			expected:    "ffc70df2a1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := &zv1.StackSet{Spec: zv1.StackSetSpec{StackTemplate: *template.DeepCopy()}}
+			stackset.Spec.StackTemplate.Spec.Version = tc.version
+			stackset.Spec.StackTemplate.Spec.AutoVersion = tc.autoVersion
+			require.Equal(t, tc.expected, currentStackVersion(stackset))
+		})
+	}
+}
+
+func TestStackTemplateHash(t *testing.T) {
+	base := zv1.StackTemplate{
+		EmbeddedObjectMetaWithAnnotations: zv1.EmbeddedObjectMetaWithAnnotations{
+			Annotations: map[string]string{"a": "1", "b": "2"},
+		},
+		Spec: zv1.StackSpecTemplate{
+			AutoVersion: true,
+			StackSpec: zv1.StackSpec{
+				Replicas: wrapReplicas(3),
+				PodTemplate: zv1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{Name: "foo", Image: "foo:1"}},
+					},
+				},
+			},
+		},
+	}
+	baseHash := stackTemplateHash(base)
+	require.Regexp(t, "^[0-9a-f]{10}$", baseHash)
+
+	unchanged := map[string]func(template *zv1.StackTemplate){
+		"same template": func(template *zv1.StackTemplate) {},
+		"annotations": func(template *zv1.StackTemplate) {
+			template.Annotations["a"] = "3"
+		},
+		"replicas": func(template *zv1.StackTemplate) {
+			template.Spec.Replicas = wrapReplicas(4)
+		},
+		"version": func(template *zv1.StackTemplate) {
+			template.Spec.Version = "v2"
+		},
+		"pin": func(template *zv1.StackTemplate) {
+			template.Spec.Pin = &zv1.StackPin{Reason: "ignored in the template"}
+		},
+	}
+	for name, update := range unchanged {
+		template := *base.DeepCopy()
+		update(&template)
+		require.Equal(t, baseHash, stackTemplateHash(template), name)
+	}
+
+	changed := map[string]func(template *zv1.StackTemplate){
+		"pod template": func(template *zv1.StackTemplate) {
+			template.Spec.PodTemplate.Spec.Containers[0].Image = "foo:2"
+		},
+		"service": func(template *zv1.StackTemplate) {
+			template.Spec.Service = &zv1.StackServiceSpec{Ports: []v1.ServicePort{{Port: 8080}}}
+		},
+		"autoscaler": func(template *zv1.StackTemplate) {
+			template.Spec.Autoscaler = &zv1.Autoscaler{MaxReplicas: 10}
+		},
+		"strategy": func(template *zv1.StackTemplate) {
+			template.Spec.Strategy = &apps.DeploymentStrategy{Type: apps.RecreateDeploymentStrategyType}
+		},
+		"readiness gates": func(template *zv1.StackTemplate) {
+			template.Spec.ReadinessGates = []zv1.StackReadinessGate{{Type: zv1.StackReadinessGateHPAScalingActive}}
+		},
+	}
+	for name, update := range changed {
+		template := *base.DeepCopy()
+		update(&template)
+		require.NotEqual(t, baseHash, stackTemplateHash(template), name)
+	}
+}
+
+// TestStackTemplateHashGolden pins the hash of a template, a changed hash
+// creates new stacks for all the stacksets using the auto version.
+func TestStackTemplateHashGolden(t *testing.T) {
+	template := zv1.StackTemplate{
+		Spec: zv1.StackSpecTemplate{
+			AutoVersion: true,
+			StackSpec: zv1.StackSpec{
+				Replicas: wrapReplicas(3),
+				Service: &zv1.StackServiceSpec{
+					Ports: []v1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)}},
+				},
+				Autoscaler: &zv1.Autoscaler{
+					MaxReplicas: 10,
+					Metrics:     []zv1.AutoscalerMetrics{{Type: zv1.CPUAutoscalerMetric, AverageUtilization: pint32(50)}},
+				},
+				Strategy: &apps.DeploymentStrategy{Type: apps.RollingUpdateDeploymentStrategyType},
+				PodTemplate: zv1.PodTemplateSpec{
+					EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{
+						Labels: map[string]string{"application": "foo"},
+					},
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{
+							{
+								Name:  "foo",
+								Image: "foo:1",
+								Ports: []v1.ContainerPort{{ContainerPort: 8080}},
+								Env:   []v1.EnvVar{{Name: "FOO", Value: "bar"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	require.Equal(t, "c5df747f1d", stackTemplateHash(template))
+}
+
 func TestStackSetNewStack(t *testing.T) {
 	for _, tc := range []struct {
 		name              string
@@ -527,6 +827,104 @@ func TestStackSetUpdateFromResourcesScaleDown(t *testing.T) {
 	}
 }
 
+func TestStackSetUpdateFromResourcesShadowTraffic(t *testing.T) {
+	c := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "foo",
+			},
+			Spec: zv1.StackSetSpec{
+				RouteGroup: &zv1.RouteGroupSpec{
+					Hosts: []string{"example.org"},
+					ShadowTraffic: []zv1.ShadowTraffic{
+						{StackName: "foo-v2", Weight: 10},
+						{StackName: "foo-v3", Weight: 20},
+					},
+					BackendPort: 80,
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": {Stack: &zv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "foo-v1"}}},
+			"v2": {Stack: &zv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "foo-v2"}}},
+		},
+	}
+
+	// without a RouteGroup, e.g. if RouteGroup support is disabled, no
+	// requests are mirrored
+	err := c.UpdateFromResources()
+	require.NoError(t, err)
+	require.EqualValues(t, 0, c.StackContainers["v2"].shadowTrafficWeight)
+
+	c.RouteGroup = &rgv1.RouteGroup{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+	err = c.UpdateFromResources()
+	require.NoError(t, err)
+	require.EqualValues(t, 0, c.StackContainers["v1"].shadowTrafficWeight)
+	require.EqualValues(t, 10, c.StackContainers["v2"].shadowTrafficWeight)
+
+	// the shadowed stack counts as getting traffic
+	now := time.Now()
+	c.updateNoTrafficSince(now)
+	require.Equal(t, now, c.StackContainers["v1"].noTrafficSince)
+	require.True(t, c.StackContainers["v2"].noTrafficSince.IsZero())
+
+	c.StackContainers["v2"].noTrafficSince = now.Add(-time.Hour)
+	c.StackContainers["v2"].scaledownTTL = time.Minute
+	require.False(t, c.StackContainers["v2"].ScaledDown())
+}
+
+func TestStackSetUpdateFromResourcesStackRoutes(t *testing.T) {
+	c := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "foo",
+			},
+			Spec: zv1.StackSetSpec{
+				RouteGroup: &zv1.RouteGroupSpec{
+					Hosts: []string{"example.org"},
+					StackRoutes: []zv1.StackRoute{
+						{
+							StackName: "foo-v2",
+							Headers:   []zv1.StackRouteMatch{{Name: "X-Version", Value: "v2"}},
+						},
+						{
+							StackName: "foo-v3",
+							Cookies:   []zv1.StackRouteMatch{{Name: "version", Value: "v3"}},
+						},
+					},
+					BackendPort: 80,
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": {Stack: &zv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "foo-v1"}}},
+			"v2": {Stack: &zv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "foo-v2"}}},
+		},
+	}
+
+	// without a RouteGroup, e.g. if RouteGroup support is disabled, no
+	// requests are routed to the stacks
+	err := c.UpdateFromResources()
+	require.NoError(t, err)
+	require.False(t, c.StackContainers["v2"].HasStackRoute())
+
+	c.RouteGroup = &rgv1.RouteGroup{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+	err = c.UpdateFromResources()
+	require.NoError(t, err)
+	require.False(t, c.StackContainers["v1"].HasStackRoute())
+	require.True(t, c.StackContainers["v2"].HasStackRoute())
+
+	// the routed stack counts as getting traffic even without a weight
+	now := time.Now()
+	c.updateNoTrafficSince(now)
+	require.Equal(t, now, c.StackContainers["v1"].noTrafficSince)
+	require.True(t, c.StackContainers["v2"].noTrafficSince.IsZero())
+
+	c.StackContainers["v2"].noTrafficSince = now.Add(-time.Hour)
+	c.StackContainers["v2"].scaledownTTL = time.Minute
+	require.False(t, c.StackContainers["v2"].ScaledDown())
+}
+
 func TestStackSetUpdateFromResourcesClusterDomain(t *testing.T) {
 	c := dummyStacksetContainer()
 	c.clusterDomains = []string{"foo.example.org"}
@@ -872,7 +1270,7 @@ func TestGenerateStackSetStatus(t *testing.T) {
 		StackContainers: map[types.UID]*StackContainer{
 			"v1": testStack("v1").pendingRemoval().ready(3).stack(),
 			"v2": testStack("v2").ready(3).traffic(80, 90).stack(),
-			"v3": testStack("v3").ready(3).stack(),
+			"v3": testStack("v3").ready(3).shadowTraffic(10).stack(),
 			"v4": testStack("v4").stack(),
 			"v5": testStack("v5").ready(3).traffic(20, 10).stack(),
 		},
@@ -911,6 +1309,14 @@ func TestGenerateStackSetStatus(t *testing.T) {
 				Weight:      10,
 			},
 		},
+		ShadowTraffic: []*zv1.ActualTraffic{
+			{
+				StackName:   "v3",
+				ServiceName: "v3",
+				ServicePort: intStrTestPort,
+				Weight:      10,
+			},
+		},
 	}
 	status := c.GenerateStackSetStatus()
 	require.Equal(t, expected.Stacks, status.Stacks)
@@ -918,6 +1324,7 @@ func TestGenerateStackSetStatus(t *testing.T) {
 	require.Equal(t, expected.StacksWithTraffic, status.StacksWithTraffic)
 	require.Equal(t, expected.ObservedStackVersion, status.ObservedStackVersion)
 	require.Equal(t, expected.Traffic, status.Traffic)
+	require.Equal(t, expected.ShadowTraffic, status.ShadowTraffic)
 }
 
 func TestGenerateStackSetTraffic(t *testing.T) {
@@ -930,7 +1337,7 @@ func TestGenerateStackSetTraffic(t *testing.T) {
 		StackContainers: map[types.UID]*StackContainer{
 			"v1": testStack("v1").pendingRemoval().ready(3).stack(),
 			"v2": testStack("v2").ready(3).traffic(80, 90).stack(),
-			"v3": testStack("v3").ready(3).stack(),
+			"v3": testStack("v3").ready(3).shadowTraffic(10).stack(),
 			"v4": testStack("v4").stack(),
 			"v5": testStack("v5").ready(3).traffic(20, 10).stack(),
 		},
@@ -1258,3 +1665,323 @@ func TestStackSetGenerateRouteGroup(t *testing.T) {
 	}
 	require.Equal(t, expected, routegroup)
 }
+
+func TestStackSetGenerateRouteGroupStackRoutes(t *testing.T) {
+	c := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "bar",
+			},
+			Spec: zv1.StackSetSpec{
+				RouteGroup: &zv1.RouteGroupSpec{
+					Hosts: []string{"example.org"},
+					Routes: []rgv1.RouteGroupRouteSpec{
+						{
+							PathSubtree: "/",
+							Predicates:  []string{"Method(\"GET\")"},
+						},
+						{
+							Path: "/login",
+							Backends: []rgv1.RouteGroupBackendReference{
+								{BackendName: "shunt"},
+							},
+						},
+					},
+					StackRoutes: []zv1.StackRoute{
+						{
+							StackName: "foo-v2",
+							Headers:   []zv1.StackRouteMatch{{Name: "X-Canary", Value: "v2"}},
+							Cookies: []zv1.StackRouteMatch{
+								{Name: "canary", Value: "true"},
+								{Name: "version", Value: "v2.0+beta"},
+							},
+						},
+						{
+							StackName: "foo-v3",
+							Headers:   []zv1.StackRouteMatch{{Name: "X-Canary", Value: "v3"}},
+						},
+					},
+					BackendPort: int(testPort),
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": testStack("foo-v1").traffic(100, 100).stack(),
+			"v2": testStack("foo-v2").traffic(0, 0).stack(),
+		},
+	}
+	routegroup, err := c.GenerateRouteGroup()
+	require.NoError(t, err)
+
+	expected := []rgv1.RouteGroupRouteSpec{
+		{
+			PathSubtree: "/",
+			Predicates:  []string{"Method(\"GET\")"},
+		},
+		{
+			Path: "/login",
+			Backends: []rgv1.RouteGroupBackendReference{
+				{BackendName: "shunt"},
+			},
+		},
+		{
+			PathSubtree: "/",
+			Predicates: []string{
+				"Method(\"GET\")",
+				"Header(\"X-Canary\", \"v2\")",
+				"Cookie(\"canary\", \"^true$\")",
+				"Cookie(\"version\", \"^v2\\\\.0\\\\+beta$\")",
+			},
+			Backends: []rgv1.RouteGroupBackendReference{
+				{BackendName: "foo-v2", Weight: 100},
+			},
+		},
+	}
+	require.Equal(t, expected, routegroup.Spec.Routes)
+	require.Len(t, c.StackSet.Spec.RouteGroup.Routes, 2)
+	require.Equal(t, []string{"Method(\"GET\")"}, c.StackSet.Spec.RouteGroup.Routes[0].Predicates)
+
+	// Stack routes must match something
+	c.StackSet.Spec.RouteGroup.StackRoutes = []zv1.StackRoute{{StackName: "foo-v2"}}
+	_, err = c.GenerateRouteGroup()
+	require.Error(t, err)
+}
+
+func TestStackSetGenerateRouteGroupShadowTraffic(t *testing.T) {
+	c := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "bar",
+			},
+			Spec: zv1.StackSetSpec{
+				RouteGroup: &zv1.RouteGroupSpec{
+					Hosts: []string{"example.org"},
+					Routes: []rgv1.RouteGroupRouteSpec{
+						{
+							PathSubtree: "/",
+						},
+						{
+							Path: "/login",
+							Backends: []rgv1.RouteGroupBackendReference{
+								{BackendName: "shunt"},
+							},
+						},
+					},
+					ShadowTraffic: []zv1.ShadowTraffic{
+						{StackName: "foo-v2", Weight: 25},
+						{StackName: "foo-v3", Weight: 50},
+					},
+					BackendPort: int(testPort),
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": testStack("foo-v1").traffic(100, 100).stack(),
+			"v2": testStack("foo-v2").traffic(0, 0).stack(),
+		},
+	}
+	routegroup, err := c.GenerateRouteGroup()
+	require.NoError(t, err)
+
+	expected := []rgv1.RouteGroupRouteSpec{
+		{
+			PathSubtree: "/",
+		},
+		{
+			Path: "/login",
+			Backends: []rgv1.RouteGroupBackendReference{
+				{BackendName: "shunt"},
+			},
+		},
+		{
+			PathSubtree: "/",
+			Predicates:  []string{"Traffic(0.25)"},
+			Filters:     []string{"teeLoopback(\"foo-v2\")"},
+		},
+		{
+			PathSubtree: "/",
+			Predicates:  []string{"Tee(\"foo-v2\")"},
+			Backends: []rgv1.RouteGroupBackendReference{
+				{BackendName: "foo-v2", Weight: 100},
+			},
+		},
+	}
+	require.Equal(t, expected, routegroup.Spec.Routes)
+	require.Equal(t, []rgv1.RouteGroupBackendReference{{BackendName: "foo-v1", Weight: 100}}, routegroup.Spec.DefaultBackends)
+}
+
+func TestStackSetGenerateHTTPRoute(t *testing.T) {
+	pathPrefix := "PathPrefix"
+	example := "/example"
+	shuntPort := int32(9999)
+
+	c := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: APIVersion,
+				Kind:       KindStackSet,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "bar",
+				Labels: map[string]string{
+					"stackset-label": "foobar",
+				},
+				UID: "abc-123",
+			},
+			Spec: zv1.StackSetSpec{
+				HTTPRoute: &zv1.HTTPRouteSpec{
+					EmbeddedObjectMetaWithAnnotations: zv1.EmbeddedObjectMetaWithAnnotations{
+						Annotations: map[string]string{
+							"httproute": "annotation",
+						},
+					},
+					ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+					Hostnames:  []string{"example.org", "example.com"},
+					Rules: []gatewayv1.HTTPRouteRule{
+						{
+							Matches: []gatewayv1.HTTPRouteMatch{
+								{Path: &gatewayv1.HTTPPathMatch{Type: &pathPrefix, Value: &example}},
+							},
+						},
+						{
+							BackendRefs: []gatewayv1.HTTPBackendRef{
+								httpBackendRef("shunt", shuntPort, 1),
+							},
+						},
+					},
+					BackendPort: testPort,
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": testStack("foo-v1").traffic(12.5, 25).stack(),
+			"v2": testStack("foo-v2").traffic(50, 13).stack(),
+			"v3": testStack("foo-v3").traffic(62.5, 62).stack(),
+			"v4": testStack("foo-v4").traffic(0, 0).stack(),
+		},
+	}
+	httpRoute, err := c.GenerateHTTPRoute()
+	require.NoError(t, err)
+
+	expected := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "bar",
+			Labels: map[string]string{
+				"stackset":       "foo",
+				"stackset-label": "foobar",
+			},
+			Annotations: map[string]string{
+				"httproute": "annotation",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: APIVersion,
+					Kind:       KindStackSet,
+					Name:       "foo",
+					UID:        "abc-123",
+				},
+			},
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+			Hostnames:  []string{"example.org", "example.com"},
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					Matches: []gatewayv1.HTTPRouteMatch{
+						{Path: &gatewayv1.HTTPPathMatch{Type: &pathPrefix, Value: &example}},
+					},
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						httpBackendRef("foo-v1", testPort, 25),
+						httpBackendRef("foo-v2", testPort, 13),
+						httpBackendRef("foo-v3", testPort, 62),
+					},
+				},
+				{
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						httpBackendRef("shunt", shuntPort, 1),
+					},
+				},
+			},
+		},
+	}
+	require.Equal(t, expected, httpRoute)
+
+	// Without rules all the requests are routed to the stacks
+	c.StackSet.Spec.HTTPRoute.Rules = nil
+	httpRoute, err = c.GenerateHTTPRoute()
+	require.NoError(t, err)
+	require.Equal(t, []gatewayv1.HTTPRouteRule{
+		{
+			BackendRefs: []gatewayv1.HTTPBackendRef{
+				httpBackendRef("foo-v1", testPort, 25),
+				httpBackendRef("foo-v2", testPort, 13),
+				httpBackendRef("foo-v3", testPort, 62),
+			},
+		},
+	}, httpRoute.Spec.Rules)
+
+	// Explicit backendRefs must not reference a stack
+	c.StackSet.Spec.HTTPRoute.Rules = []gatewayv1.HTTPRouteRule{
+		{
+			BackendRefs: []gatewayv1.HTTPBackendRef{
+				httpBackendRef("foo-v4", testPort, 1),
+			},
+		},
+	}
+	_, err = c.GenerateHTTPRoute()
+	require.Equal(t, errStackServiceRef, err)
+}
+
+func TestStackSetContainerClock(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	scaledownTTL := int64(300)
+
+	stackset := &zv1.StackSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+		},
+		Spec: zv1.StackSetSpec{
+			Ingress: &zv1.StackSetIngressSpec{
+				BackendPort: intStrTestPort,
+			},
+			StackLifecycle: zv1.StackLifecycle{
+				ScaledownTTLSeconds: &scaledownTTL,
+			},
+			Traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+		},
+		Status: zv1.StackSetStatus{
+			Traffic: []*zv1.ActualTraffic{
+				{StackName: "foo-v1", ServiceName: "foo-v1", Weight: 100},
+			},
+		},
+	}
+
+	ssc := NewContainer(stackset, SimpleTrafficReconciler{}, "", nil, fakeClock)
+	ssc.StackContainers = map[types.UID]*StackContainer{
+		"v1": testStack("foo-v1").stack(),
+		"v2": testStack("foo-v2").stack(),
+	}
+
+	err := ssc.UpdateFromResources()
+	require.NoError(t, err)
+	err = ssc.ManageTraffic(fakeClock.Now())
+	require.NoError(t, err)
+
+	// Stacks without traffic are scaled down once the TTL of the clock
+	// expired
+	stack := ssc.StackContainers["v2"]
+	require.False(t, stack.ScaledDown())
+
+	fakeClock.Step(time.Duration(scaledownTTL) * time.Second)
+	require.False(t, stack.ScaledDown())
+
+	fakeClock.Step(time.Second)
+	require.True(t, stack.ScaledDown())
+	require.False(t, ssc.StackContainers["v1"].ScaledDown())
+}
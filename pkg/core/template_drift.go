@@ -0,0 +1,80 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// TemplateDrift returns the stack of the current version if it doesn't
+// match the stack template anymore, i.e. if the template was changed
+// without changing the version.
+func (ssc *StackSetContainer) TemplateDrift() *StackContainer {
+	sc := ssc.stackByName(generateStackName(ssc.StackSet, currentStackVersion(ssc.StackSet)))
+	if sc == nil || sc.PendingRemoval {
+		return nil
+	}
+
+	expected := ssc.StackFromTemplate(sc.Stack)
+	if equality.Semantic.DeepEqual(expected.Spec, sc.Stack.Spec) && equality.Semantic.DeepEqual(withoutTemplateAnnotationKeys(expected.Annotations), withoutTemplateAnnotationKeys(sc.Stack.Annotations)) {
+		return nil
+	}
+	return sc
+}
+
+// withoutTemplateAnnotationKeys returns the annotations without the keys of
+// the template annotations, which stacks created by older versions of the
+// controller don't have.
+func withoutTemplateAnnotationKeys(annotations map[string]string) map[string]string {
+	result := mapCopy(annotations)
+	delete(result, stackTemplateAnnotationsAnnotationKey)
+	return result
+}
+
+// StackFromTemplate returns a copy of the stack updated to match the stack
+// template. The replicas and the pin of the stack and the annotations which
+// aren't part of the template, e.g. set by external systems, are kept, so
+// scaling the stack through its scale subresource isn't a drift. Annotations applied
+// from an earlier template are tracked on the stack, so the ones removed
+// from the template are removed from the stack as well.
+func (ssc *StackSetContainer) StackFromTemplate(stack *zv1.Stack) *zv1.Stack {
+	updated := stack.DeepCopy()
+	updated.Spec = stackSpecFromTemplate(ssc.StackSet)
+	updated.Spec.Replicas = stack.Spec.Replicas
+	updated.Spec.Pin = stack.Spec.Pin.DeepCopy()
+
+	for _, key := range strings.Split(stack.Annotations[stackTemplateAnnotationsAnnotationKey], ",") {
+		delete(updated.Annotations, key)
+	}
+	delete(updated.Annotations, stackTemplateAnnotationsAnnotationKey)
+
+	for key, value := range stackAnnotationsFromTemplate(ssc.StackSet) {
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+		updated.Annotations[key] = value
+	}
+	return updated
+}
+
+// stackAnnotationsFromTemplate returns the annotations of a stack created
+// from the stack template, including the keys of the template annotations
+// so they can be told apart from annotations set by other systems.
+func stackAnnotationsFromTemplate(stackset *zv1.StackSet) map[string]string {
+	template := stackset.Spec.StackTemplate.Annotations
+	if len(template) == 0 {
+		return nil
+	}
+
+	annotations := make(map[string]string, len(template)+1)
+	keys := make([]string, 0, len(template))
+	for key, value := range template {
+		annotations[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	annotations[stackTemplateAnnotationsAnnotationKey] = strings.Join(keys, ",")
+	return annotations
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testPodTemplate(image string) zv1.PodTemplateSpec {
+	return zv1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "foo", Image: image}},
+		},
+	}
+}
+
+func TestTemplateDrift(t *testing.T) {
+	pin := &zv1.StackPin{Reason: "investigation", Until: &metav1.Time{Time: time.Unix(1000, 0)}}
+
+	for _, tc := range []struct {
+		name        string
+		stack       *StackContainer
+		image       string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name:  "stack matches the template",
+			stack: testStack("foo-v1").stack(),
+			image: "foo:1",
+		},
+		{
+			name:     "spec changed",
+			stack:    testStack("foo-v1").stack(),
+			image:    "foo:2",
+			expected: true,
+		},
+		{
+			name:        "template annotations changed",
+			stack:       testStack("foo-v1").stack(),
+			image:       "foo:1",
+			annotations: map[string]string{"example.org/team": "bar"},
+			expected:    true,
+		},
+		{
+			name: "annotations set by other systems are kept",
+			stack: func() *StackContainer {
+				sc := testStack("foo-v1").stack()
+				sc.Stack.Annotations = map[string]string{"example.org/team": "foo", "example.org/deployed-by": "ci"}
+				return sc
+			}(),
+			image:       "foo:1",
+			annotations: map[string]string{"example.org/team": "foo"},
+		},
+		{
+			name: "annotation removed from the template",
+			stack: func() *StackContainer {
+				sc := testStack("foo-v1").stack()
+				sc.Stack.Annotations = map[string]string{
+					"example.org/team":                    "foo",
+					"example.org/owner":                   "bar",
+					"example.org/deployed-by":             "ci",
+					stackTemplateAnnotationsAnnotationKey: "example.org/owner,example.org/team",
+				}
+				return sc
+			}(),
+			image:       "foo:1",
+			annotations: map[string]string{"example.org/team": "foo"},
+			expected:    true,
+		},
+		{
+			name: "replicas of the stack are kept",
+			stack: func() *StackContainer {
+				sc := testStack("foo-v1").stack()
+				sc.Stack.Spec.Replicas = wrapReplicas(10)
+				return sc
+			}(),
+			image: "foo:1",
+		},
+		{
+			name: "pin of the stack is kept",
+			stack: func() *StackContainer {
+				sc := testStack("foo-v1").stack()
+				sc.Stack.Spec.Pin = pin
+				return sc
+			}(),
+			image: "foo:1",
+		},
+		{
+			name:  "stack pending removal",
+			stack: testStack("foo-v1").pendingRemoval().stack(),
+			image: "foo:2",
+		},
+		{
+			name:  "stack of another version",
+			stack: testStack("foo-v2").stack(),
+			image: "foo:2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.stack.Stack.Spec.Replicas == nil {
+				tc.stack.Stack.Spec.Replicas = wrapReplicas(3)
+			}
+			tc.stack.Stack.Spec.PodTemplate = testPodTemplate("foo:1")
+
+			stackset := &zv1.StackSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+				Spec: zv1.StackSetSpec{
+					StackTemplate: zv1.StackTemplate{
+						EmbeddedObjectMetaWithAnnotations: zv1.EmbeddedObjectMetaWithAnnotations{
+							Annotations: tc.annotations,
+						},
+						Spec: zv1.StackSpecTemplate{
+							Version: "v1",
+							StackSpec: zv1.StackSpec{
+								Replicas:    wrapReplicas(3),
+								PodTemplate: testPodTemplate(tc.image),
+							},
+						},
+					},
+				},
+			}
+			ssc := &StackSetContainer{
+				StackSet:        stackset,
+				StackContainers: map[types.UID]*StackContainer{"uid": tc.stack},
+			}
+
+			drift := ssc.TemplateDrift()
+			if !tc.expected {
+				require.Nil(t, drift)
+				return
+			}
+			require.Equal(t, tc.stack, drift)
+
+			updated := ssc.StackFromTemplate(drift.Stack)
+			require.Equal(t, tc.image, updated.Spec.PodTemplate.Spec.Containers[0].Image)
+			require.Equal(t, tc.stack.Stack.Spec.Replicas, updated.Spec.Replicas)
+			for key, value := range tc.annotations {
+				require.Equal(t, value, updated.Annotations[key])
+			}
+			require.Equal(t, tc.stack.Stack.Spec.Pin, updated.Spec.Pin)
+			require.NotContains(t, updated.Annotations, "example.org/owner")
+
+			// the updated stack matches the template
+			tc.stack.Stack = updated
+			require.Nil(t, ssc.TemplateDrift())
+		})
+	}
+}
+
+func TestStackFromTemplate(t *testing.T) {
+	pin := &zv1.StackPin{Reason: "investigation"}
+
+	stack := testStack("foo-v1").stack().Stack
+	stack.Annotations = map[string]string{"example.org/team": "foo", "example.org/deployed-by": "ci"}
+	stack.Spec.Replicas = wrapReplicas(3)
+	stack.Spec.Pin = pin
+
+	ssc := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			Spec: zv1.StackSetSpec{
+				StackTemplate: zv1.StackTemplate{
+					EmbeddedObjectMetaWithAnnotations: zv1.EmbeddedObjectMetaWithAnnotations{
+						Annotations: map[string]string{"example.org/team": "bar"},
+					},
+					Spec: zv1.StackSpecTemplate{
+						Version: "v1",
+						StackSpec: zv1.StackSpec{
+							Replicas:    wrapReplicas(5),
+							Pin:         &zv1.StackPin{Reason: "ignored"},
+							PodTemplate: testPodTemplate("foo:2"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	updated := ssc.StackFromTemplate(stack)
+	require.Equal(t, stack.Name, updated.Name)
+	require.Equal(t, map[string]string{
+		"example.org/team":                    "bar",
+		"example.org/deployed-by":             "ci",
+		stackTemplateAnnotationsAnnotationKey: "example.org/team",
+	}, updated.Annotations)
+	require.Equal(t, zv1.StackSpec{Replicas: wrapReplicas(3), Pin: pin, PodTemplate: testPodTemplate("foo:2")}, updated.Spec)
+
+	// annotations removed from the template are removed from the stack
+	ssc.StackSet.Spec.StackTemplate.Annotations = nil
+	updated = ssc.StackFromTemplate(updated)
+	require.Equal(t, map[string]string{"example.org/deployed-by": "ci"}, updated.Annotations)
+
+	// the original stack isn't modified
+	require.Equal(t, "foo", stack.Annotations["example.org/team"])
+	require.Empty(t, stack.Spec.PodTemplate.Spec.Containers)
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -67,6 +68,16 @@ func (f *testStackFactory) traffic(desiredTrafficWeight, actualTrafficWeight flo
 	return f
 }
 
+func (f *testStackFactory) shadowTraffic(weight float64) *testStackFactory {
+	f.container.shadowTrafficWeight = weight
+	return f
+}
+
+func (f *testStackFactory) stackRoute() *testStackFactory {
+	f.container.stackRouted = true
+	return f
+}
+
 func (f *testStackFactory) currentActualTrafficWeight(weight float64) *testStackFactory {
 	f.container.currentActualTrafficWeight = weight
 	return f
@@ -89,6 +100,14 @@ func (f *testStackFactory) noTrafficSince(since time.Time) *testStackFactory {
 	return f
 }
 
+func (f *testStackFactory) pinned(until time.Time) *testStackFactory {
+	f.container.Stack.Spec.Pin = &zv1.StackPin{}
+	if !until.IsZero() {
+		f.container.Stack.Spec.Pin.Until = &metav1.Time{Time: until}
+	}
+	return f
+}
+
 func (f *testStackFactory) pendingRemoval() *testStackFactory {
 	f.container.PendingRemoval = true
 	return f
@@ -102,6 +121,34 @@ func (f *testStackFactory) prescaling(replicas int32, desiredTrafficWeight float
 	return f
 }
 
+func (f *testStackFactory) progressive(step int32, lastStepIncrease time.Time) *testStackFactory {
+	f.container.progressiveActive = true
+	f.container.progressiveStep = step
+	f.container.progressiveLastStepIncrease = lastStepIncrease
+	return f
+}
+
+// preTrafficSwitchHook configures a pre traffic switch hook for the stack,
+// its Job is created with the given condition unless it's empty.
+func (f *testStackFactory) preTrafficSwitchHook(jobCondition batchv1.JobConditionType) *testStackFactory {
+	f.container.trafficHooks = &zv1.TrafficHooks{
+		PreTrafficSwitch: &zv1.TrafficHookJobSpec{},
+	}
+	if jobCondition != "" {
+		f.container.Resources.PreTrafficSwitchJob = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: f.container.Name() + "-" + PreTrafficSwitchHook,
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{
+					{Type: jobCondition, Status: v1.ConditionTrue},
+				},
+			},
+		}
+	}
+	return f
+}
+
 func (f *testStackFactory) stack() *StackContainer {
 	return f.container
 }
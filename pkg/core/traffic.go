@@ -9,6 +9,8 @@ import (
 type TrafficReconciler interface {
 	// Handle the traffic switching and/or scaling logic.
 	Reconcile(stacks map[string]*StackContainer, currentTimestamp time.Time) error
+	// Name identifies the reconciler in the traffic history.
+	Name() string
 }
 
 // allZero returns true if all weights defined in the map are 0.
@@ -109,17 +111,42 @@ func roundWeights(weights map[string]float64) {
 	}
 }
 
+// trafficManagementEnabled returns true if the traffic of the stackset is
+// managed by the controller.
+func (ssc *StackSetContainer) trafficManagementEnabled() bool {
+	return ssc.StackSet.Spec.Ingress != nil || ssc.StackSet.Spec.RouteGroup != nil || ssc.StackSet.Spec.HTTPRoute != nil || ssc.StackSet.Spec.ExternalIngress != nil
+}
+
+// updateNoTrafficSince updates NoTrafficSince of all the stacks according to
+// their traffic and shadow traffic weights and their stack routes.
+func (ssc *StackSetContainer) updateNoTrafficSince(currentTimestamp time.Time) {
+	for _, stack := range ssc.StackContainers {
+		if stack.HasTraffic() || stack.HasShadowTraffic() || stack.HasStackRoute() {
+			stack.noTrafficSince = time.Time{}
+		} else if stack.noTrafficSince.IsZero() {
+			stack.noTrafficSince = currentTimestamp
+		}
+	}
+}
+
 // ManageTraffic handles the traffic reconciler logic
 func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
+	ssc.trafficError = nil
+
 	// No ingress -> no traffic management required
-	if ssc.StackSet.Spec.Ingress == nil && ssc.StackSet.Spec.RouteGroup == nil && ssc.StackSet.Spec.ExternalIngress == nil {
+	if !ssc.trafficManagementEnabled() {
 		for _, sc := range ssc.StackContainers {
 			sc.desiredTrafficWeight = 0
 			sc.actualTrafficWeight = 0
+			sc.shadowTrafficWeight = 0
+			sc.stackRouted = false
 			sc.noTrafficSince = time.Time{}
 			sc.prescalingActive = false
 			sc.prescalingReplicas = 0
 			sc.prescalingLastTrafficIncrease = time.Time{}
+			sc.progressiveActive = false
+			sc.progressiveStep = 0
+			sc.progressiveLastStepIncrease = time.Time{}
 		}
 		return nil
 	}
@@ -146,6 +173,7 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 		if allZero(weights) {
 			fallbackStack := findFallbackStack(stacks)
 			if fallbackStack == nil {
+				ssc.trafficError = errNoStacks
 				return errNoStacks
 			}
 			weights[fallbackStack.Name()] = 100
@@ -160,9 +188,16 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 		stack.actualTrafficWeight = actualWeights[stackName]
 	}
 
+	// Stacks only get traffic for the first time once their pre traffic switch hook succeeded. The reconciler still
+	// runs to e.g. prescale the stacks, but the traffic isn't switched.
+	hookErr := checkPreTrafficSwitchHooks(stacks)
+
 	// Run the traffic reconciler which will update the actual weights according to the desired weights. The resulting
 	// weights **must** be normalised.
 	err := ssc.TrafficReconciler.Reconcile(stacks, currentTimestamp)
+	if err == nil {
+		err = hookErr
+	}
 
 	// Update the actual weights from the reconciled ones
 	if err == nil {
@@ -180,14 +215,8 @@ func (ssc *StackSetContainer) ManageTraffic(currentTimestamp time.Time) error {
 		stack.actualTrafficWeight = actualWeights[stackName]
 	}
 
-	// update NoTrafficSince
-	for _, stack := range ssc.StackContainers {
-		if stack.HasTraffic() {
-			stack.noTrafficSince = time.Time{}
-		} else if stack.noTrafficSince.IsZero() {
-			stack.noTrafficSince = currentTimestamp
-		}
-	}
+	ssc.updateNoTrafficSince(currentTimestamp)
+	ssc.trafficError = err
 	return err
 }
 
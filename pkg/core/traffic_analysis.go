@@ -0,0 +1,240 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+)
+
+const (
+	defaultTrafficAnalysisDuration = 300 * time.Second
+)
+
+// MetricsProvider evaluates traffic analysis queries against a metrics
+// backend.
+type MetricsProvider interface {
+	// Query evaluates the query and returns its value. ok is false if the
+	// query didn't return a value, e.g. because there was no traffic.
+	Query(ctx context.Context, query string) (value float64, ok bool, err error)
+}
+
+// TrafficRollback describes a traffic switch which was rolled back because
+// a traffic analysis query breached its threshold.
+type TrafficRollback struct {
+	// Reason describes the query which breached its threshold.
+	Reason string
+	// Changes are the traffic changes caused by the rollback.
+	Changes []TrafficChange
+}
+
+func (r *TrafficRollback) String() string {
+	changes := make([]string, 0, len(r.Changes))
+	for _, change := range r.Changes {
+		changes = append(changes, change.String())
+	}
+	return fmt.Sprintf("%s, traffic rolled back: %s", r.Reason, strings.Join(changes, ", "))
+}
+
+// analysisQueryData is passed to the query templates.
+type analysisQueryData struct {
+	Namespace string
+	StackSet  string
+	Stack     string
+}
+
+// updateTrafficAnalysis gets the traffic analysis state from the stackset
+// status.
+func (ssc *StackSetContainer) updateTrafficAnalysis() {
+	ssc.lastKnownGoodTraffic = nil
+	ssc.analysisLastTrafficIncrease = time.Time{}
+
+	status := ssc.StackSet.Status.TrafficAnalysis
+	if status == nil {
+		return
+	}
+	if len(status.LastKnownGoodTraffic) > 0 {
+		ssc.lastKnownGoodTraffic = make(map[string]float64, len(status.LastKnownGoodTraffic))
+		for _, traffic := range status.LastKnownGoodTraffic {
+			ssc.lastKnownGoodTraffic[traffic.StackName] = traffic.Weight
+		}
+	}
+	ssc.analysisLastTrafficIncrease = unwrapTime(status.LastTrafficIncrease)
+}
+
+// generateTrafficAnalysisStatus returns the traffic analysis state to be
+// stored in the stackset status.
+func (ssc *StackSetContainer) generateTrafficAnalysisStatus() *zv1.TrafficAnalysisStatus {
+	if ssc.StackSet.Spec.TrafficAnalysis == nil || ssc.lastKnownGoodTraffic == nil {
+		return nil
+	}
+
+	result := &zv1.TrafficAnalysisStatus{
+		LastTrafficIncrease: wrapTime(ssc.analysisLastTrafficIncrease),
+	}
+	for stackName, weight := range ssc.lastKnownGoodTraffic {
+		if weight > 0 {
+			result.LastKnownGoodTraffic = append(result.LastKnownGoodTraffic, &zv1.DesiredTraffic{
+				StackName: stackName,
+				Weight:    weight,
+			})
+		}
+	}
+	sort.Slice(result.LastKnownGoodTraffic, func(i, j int) bool {
+		return result.LastKnownGoodTraffic[i].StackName < result.LastKnownGoodTraffic[j].StackName
+	})
+	return result
+}
+
+// AnalyzeTraffic evaluates the traffic analysis queries for all the stacks
+// which are getting more traffic than with the last known good traffic
+// weights. If one of the queries breaches its threshold, the desired and the
+// actual traffic weights are rolled back to the last known good ones and the
+// rollback is returned. Once the queries stayed below their thresholds for
+// the analysis duration after the last traffic increase, the current traffic
+// weights become the last known good ones.
+//
+// It must be called after ManageTraffic.
+func (ssc *StackSetContainer) AnalyzeTraffic(ctx context.Context, provider MetricsProvider, currentTimestamp time.Time) (*TrafficRollback, error) {
+	analysis := ssc.StackSet.Spec.TrafficAnalysis
+	if analysis == nil || !ssc.trafficManagementEnabled() {
+		ssc.lastKnownGoodTraffic = nil
+		ssc.analysisLastTrafficIncrease = time.Time{}
+		return nil, nil
+	}
+
+	duration := defaultTrafficAnalysisDuration
+	if analysis.DurationSeconds != nil {
+		duration = time.Duration(*analysis.DurationSeconds) * time.Second
+	}
+
+	currentTraffic := make(map[string]float64, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		currentTraffic[sc.Name()] = sc.actualTrafficWeight
+	}
+
+	// Nothing to compare against yet, the current traffic is the baseline
+	if ssc.lastKnownGoodTraffic == nil {
+		ssc.lastKnownGoodTraffic = currentTraffic
+		return nil, nil
+	}
+
+	var gainingStacks []*StackContainer
+	for _, sc := range ssc.StackContainers {
+		if sc.actualTrafficWeight > ssc.lastKnownGoodTraffic[sc.Name()] {
+			gainingStacks = append(gainingStacks, sc)
+		}
+	}
+	if len(gainingStacks) == 0 {
+		ssc.lastKnownGoodTraffic = currentTraffic
+		ssc.analysisLastTrafficIncrease = time.Time{}
+		return nil, nil
+	}
+	sort.Slice(gainingStacks, func(i, j int) bool {
+		return gainingStacks[i].Name() < gainingStacks[j].Name()
+	})
+
+	// Restart the analysis whenever a stack gets more traffic
+	for _, change := range ssc.TrafficChanges() {
+		if change.NewTrafficWeight > change.OldTrafficWeight {
+			ssc.analysisLastTrafficIncrease = currentTimestamp
+		}
+	}
+	if ssc.analysisLastTrafficIncrease.IsZero() {
+		ssc.analysisLastTrafficIncrease = currentTimestamp
+	}
+
+	for _, sc := range gainingStacks {
+		for _, query := range analysis.Queries {
+			breached, value, err := evaluateAnalysisQuery(ctx, provider, query, analysisQueryData{
+				Namespace: sc.Namespace(),
+				StackSet:  ssc.StackSet.Name,
+				Stack:     sc.Name(),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate query %s for stack %s: %v", query.Name, sc.Name(), err)
+			}
+			if breached {
+				reason := fmt.Sprintf("query %s for stack %s returned %g, above the threshold of %s", query.Name, sc.Name(), value, query.Threshold.String())
+				return ssc.rollbackTraffic(reason, currentTimestamp)
+			}
+		}
+	}
+
+	if currentTimestamp.Sub(ssc.analysisLastTrafficIncrease) < duration {
+		return nil, nil
+	}
+
+	// Only consider the traffic good once the switch is complete
+	for _, sc := range ssc.StackContainers {
+		if sc.actualTrafficWeight != sc.desiredTrafficWeight {
+			return nil, nil
+		}
+	}
+	ssc.lastKnownGoodTraffic = currentTraffic
+	ssc.analysisLastTrafficIncrease = time.Time{}
+	return nil, nil
+}
+
+// rollbackTraffic resets the desired and actual traffic weights of all
+// stacks to the last known good ones.
+func (ssc *StackSetContainer) rollbackTraffic(reason string, currentTimestamp time.Time) (*TrafficRollback, error) {
+	weights := make(map[string]float64, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		weights[sc.Name()] = ssc.lastKnownGoodTraffic[sc.Name()]
+	}
+	if allZero(weights) {
+		return nil, fmt.Errorf("%s, but none of the stacks with last known good traffic exists", reason)
+	}
+	normalizeWeights(weights)
+
+	rollback := &TrafficRollback{Reason: reason}
+	for _, sc := range ssc.StackContainers {
+		weight := weights[sc.Name()]
+		if weight != sc.actualTrafficWeight {
+			rollback.Changes = append(rollback.Changes, TrafficChange{
+				StackName:        sc.Name(),
+				OldTrafficWeight: sc.actualTrafficWeight,
+				NewTrafficWeight: weight,
+			})
+		}
+		sc.desiredTrafficWeight = weight
+		sc.actualTrafficWeight = weight
+	}
+	sort.Slice(rollback.Changes, func(i, j int) bool {
+		return rollback.Changes[i].StackName < rollback.Changes[j].StackName
+	})
+
+	ssc.lastKnownGoodTraffic = weights
+	ssc.analysisLastTrafficIncrease = time.Time{}
+	ssc.updateNoTrafficSince(currentTimestamp)
+	ssc.stopAutoPromote(rollback.Changes)
+	return rollback, nil
+}
+
+// evaluateAnalysisQuery renders the query for a stack and checks its value
+// against the threshold.
+func evaluateAnalysisQuery(ctx context.Context, provider MetricsProvider, query zv1.TrafficAnalysisQuery, data analysisQueryData) (bool, float64, error) {
+	tmpl, err := template.New(query.Name).Option("missingkey=error").Parse(query.Query)
+	if err != nil {
+		return false, 0, err
+	}
+	var rendered bytes.Buffer
+	err = tmpl.Execute(&rendered, data)
+	if err != nil {
+		return false, 0, err
+	}
+
+	value, ok, err := provider.Query(ctx, rendered.String())
+	if err != nil || !ok {
+		return false, 0, err
+	}
+
+	threshold := float64(query.Threshold.MilliValue()) / 1000
+	return value > threshold, value, nil
+}
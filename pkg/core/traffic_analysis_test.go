@@ -0,0 +1,264 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type fakeMetricsProvider struct {
+	values map[string]float64
+	err    error
+}
+
+func (p fakeMetricsProvider) Query(_ context.Context, query string) (float64, bool, error) {
+	if p.err != nil {
+		return 0, false, p.err
+	}
+	value, ok := p.values[query]
+	return value, ok, nil
+}
+
+func TestAnalyzeTraffic(t *testing.T) {
+	now := time.Now()
+	minuteAgo := now.Add(-time.Minute)
+
+	analysis := &zv1.TrafficAnalysisSpec{
+		Queries: []zv1.TrafficAnalysisQuery{
+			{
+				Name:      "error-rate",
+				Query:     `errors{namespace="{{ .Namespace }}",stackset="{{ .StackSet }}",stack="{{ .Stack }}"}`,
+				Threshold: resource.MustParse("0.05"),
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name                        string
+		analysis                    *zv1.TrafficAnalysisSpec
+		stacks                      map[types.UID]*StackContainer
+		lastKnownGoodTraffic        map[string]float64
+		lastTrafficIncrease         time.Time
+		provider                    fakeMetricsProvider
+		expectError                 bool
+		expectedRollback            []TrafficChange
+		expectedLastKnownGood       map[string]float64
+		expectedLastTrafficIncrease time.Time
+		expectedDesiredWeights      map[string]float64
+		expectedActualWeights       map[string]float64
+	}{
+		{
+			name: "analysis is cleared if it's not configured",
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(50, 50).stack(),
+				"v2": testStack("foo-v2").traffic(50, 50).currentActualTrafficWeight(0).stack(),
+			},
+			lastKnownGoodTraffic:   map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:    minuteAgo,
+			expectedDesiredWeights: map[string]float64{"foo-v1": 50, "foo-v2": 50},
+			expectedActualWeights:  map[string]float64{"foo-v1": 50, "foo-v2": 50},
+		},
+		{
+			name:     "current traffic becomes the last known good traffic initially",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(50, 50).stack(),
+				"v2": testStack("foo-v2").traffic(50, 50).stack(),
+			},
+			expectedLastKnownGood:  map[string]float64{"foo-v1": 50, "foo-v2": 50},
+			expectedDesiredWeights: map[string]float64{"foo-v1": 50, "foo-v2": 50},
+			expectedActualWeights:  map[string]float64{"foo-v1": 50, "foo-v2": 50},
+		},
+		{
+			name:     "no analysis without stacks gaining traffic",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(100, 100).stack(),
+				"v2": testStack("foo-v2").traffic(0, 0).stack(),
+			},
+			lastKnownGoodTraffic:   map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:    minuteAgo,
+			provider:               fakeMetricsProvider{err: errors.New("should not be called")},
+			expectedLastKnownGood:  map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedDesiredWeights: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedActualWeights:  map[string]float64{"foo-v1": 100, "foo-v2": 0},
+		},
+		{
+			name:     "analysis starts when a stack gains traffic",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(0, 80).currentActualTrafficWeight(100).stack(),
+				"v2": testStack("foo-v2").traffic(100, 20).currentActualTrafficWeight(0).stack(),
+			},
+			lastKnownGoodTraffic: map[string]float64{"foo-v1": 100},
+			provider: fakeMetricsProvider{values: map[string]float64{
+				`errors{namespace="",stackset="foo",stack="foo-v2"}`: 0.01,
+			}},
+			expectedLastKnownGood:       map[string]float64{"foo-v1": 100},
+			expectedLastTrafficIncrease: now,
+			expectedDesiredWeights:      map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedActualWeights:       map[string]float64{"foo-v1": 80, "foo-v2": 20},
+		},
+		{
+			name:     "analysis is restarted when the traffic increases further",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(0, 50).currentActualTrafficWeight(80).stack(),
+				"v2": testStack("foo-v2").traffic(100, 50).currentActualTrafficWeight(20).stack(),
+			},
+			lastKnownGoodTraffic:        map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:         hourAgo,
+			provider:                    fakeMetricsProvider{},
+			expectedLastKnownGood:       map[string]float64{"foo-v1": 100},
+			expectedLastTrafficIncrease: now,
+			expectedDesiredWeights:      map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedActualWeights:       map[string]float64{"foo-v1": 50, "foo-v2": 50},
+		},
+		{
+			name:     "traffic is rolled back if a query breaches its threshold",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(0, 80).currentActualTrafficWeight(80).stack(),
+				"v2": testStack("foo-v2").traffic(100, 20).currentActualTrafficWeight(20).stack(),
+			},
+			lastKnownGoodTraffic: map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:  minuteAgo,
+			provider: fakeMetricsProvider{values: map[string]float64{
+				`errors{namespace="",stackset="foo",stack="foo-v2"}`: 0.1,
+			}},
+			expectedRollback: []TrafficChange{
+				{StackName: "foo-v1", OldTrafficWeight: 80, NewTrafficWeight: 100},
+				{StackName: "foo-v2", OldTrafficWeight: 20, NewTrafficWeight: 0},
+			},
+			expectedLastKnownGood:  map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedDesiredWeights: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedActualWeights:  map[string]float64{"foo-v1": 100, "foo-v2": 0},
+		},
+		{
+			name:     "rollback ignores stacks which no longer exist",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v2": testStack("foo-v2").traffic(50, 50).stack(),
+				"v3": testStack("foo-v3").traffic(50, 50).stack(),
+			},
+			lastKnownGoodTraffic: map[string]float64{"foo-v1": 50, "foo-v2": 25},
+			lastTrafficIncrease:  minuteAgo,
+			provider: fakeMetricsProvider{values: map[string]float64{
+				`errors{namespace="",stackset="foo",stack="foo-v2"}`: 1,
+			}},
+			expectedRollback: []TrafficChange{
+				{StackName: "foo-v2", OldTrafficWeight: 50, NewTrafficWeight: 100},
+				{StackName: "foo-v3", OldTrafficWeight: 50, NewTrafficWeight: 0},
+			},
+			expectedLastKnownGood:  map[string]float64{"foo-v2": 100, "foo-v3": 0},
+			expectedDesiredWeights: map[string]float64{"foo-v2": 100, "foo-v3": 0},
+			expectedActualWeights:  map[string]float64{"foo-v2": 100, "foo-v3": 0},
+		},
+		{
+			name:     "rollback fails if none of the last known good stacks exists",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v2": testStack("foo-v2").traffic(100, 100).stack(),
+			},
+			lastKnownGoodTraffic: map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:  minuteAgo,
+			provider: fakeMetricsProvider{values: map[string]float64{
+				`errors{namespace="",stackset="foo",stack="foo-v2"}`: 1,
+			}},
+			expectError: true,
+		},
+		{
+			name:     "query errors are returned",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(0, 80).stack(),
+				"v2": testStack("foo-v2").traffic(100, 20).stack(),
+			},
+			lastKnownGoodTraffic: map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:  minuteAgo,
+			provider:             fakeMetricsProvider{err: errors.New("failed")},
+			expectError:          true,
+		},
+		{
+			name:     "traffic becomes good once the analysis duration passed",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(0, 0).stack(),
+				"v2": testStack("foo-v2").traffic(100, 100).stack(),
+			},
+			lastKnownGoodTraffic: map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:  hourAgo,
+			provider: fakeMetricsProvider{values: map[string]float64{
+				`errors{namespace="",stackset="foo",stack="foo-v2"}`: 0.05,
+			}},
+			expectedLastKnownGood:  map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedDesiredWeights: map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedActualWeights:  map[string]float64{"foo-v1": 0, "foo-v2": 100},
+		},
+		{
+			name:     "traffic doesn't become good before the switch is complete",
+			analysis: analysis,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").traffic(0, 50).stack(),
+				"v2": testStack("foo-v2").traffic(100, 50).stack(),
+			},
+			lastKnownGoodTraffic:        map[string]float64{"foo-v1": 100},
+			lastTrafficIncrease:         hourAgo,
+			provider:                    fakeMetricsProvider{},
+			expectedLastKnownGood:       map[string]float64{"foo-v1": 100},
+			expectedLastTrafficIncrease: hourAgo,
+			expectedDesiredWeights:      map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedActualWeights:       map[string]float64{"foo-v1": 50, "foo-v2": 50},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "foo",
+					},
+					Spec: zv1.StackSetSpec{
+						Ingress:         &zv1.StackSetIngressSpec{},
+						TrafficAnalysis: tc.analysis,
+					},
+				},
+				StackContainers:             tc.stacks,
+				lastKnownGoodTraffic:        tc.lastKnownGoodTraffic,
+				analysisLastTrafficIncrease: tc.lastTrafficIncrease,
+			}
+
+			rollback, err := c.AnalyzeTraffic(context.Background(), tc.provider, now)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.expectedRollback == nil {
+				require.Nil(t, rollback)
+			} else {
+				require.NotNil(t, rollback)
+				require.Equal(t, tc.expectedRollback, rollback.Changes)
+			}
+
+			require.Equal(t, tc.expectedLastKnownGood, c.lastKnownGoodTraffic)
+			require.Equal(t, tc.expectedLastTrafficIncrease, c.analysisLastTrafficIncrease)
+
+			desiredWeights := make(map[string]float64)
+			actualWeights := make(map[string]float64)
+			for _, sc := range c.StackContainers {
+				desiredWeights[sc.Name()] = sc.desiredTrafficWeight
+				actualWeights[sc.Name()] = sc.actualTrafficWeight
+			}
+			require.Equal(t, tc.expectedDesiredWeights, desiredWeights)
+			require.Equal(t, tc.expectedActualWeights, actualWeights)
+		})
+	}
+}
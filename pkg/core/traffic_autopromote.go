@@ -0,0 +1,144 @@
+package core
+
+import (
+	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+)
+
+const (
+	defaultAutoPromoteIntermediateDuration = 300 * time.Second
+)
+
+// updateAutoPromote gets the automatic promotion state from the stackset
+// status.
+func (ssc *StackSetContainer) updateAutoPromote() {
+	ssc.autoPromoteStackName = ""
+	ssc.autoPromoteIntermediateSince = time.Time{}
+
+	status := ssc.StackSet.Status.AutoPromote
+	if status == nil {
+		return
+	}
+	ssc.autoPromoteStackName = status.StackName
+	ssc.autoPromoteIntermediateSince = unwrapTime(status.IntermediateWeightSince)
+}
+
+// generateAutoPromoteStatus returns the automatic promotion state to be
+// stored in the stackset status.
+func (ssc *StackSetContainer) generateAutoPromoteStatus() *zv1.AutoPromoteStatus {
+	if ssc.StackSet.Spec.AutoPromote == nil || ssc.autoPromoteStackName == "" {
+		return nil
+	}
+	return &zv1.AutoPromoteStatus{
+		StackName:               ssc.autoPromoteStackName,
+		IntermediateWeightSince: wrapTime(ssc.autoPromoteIntermediateSince),
+	}
+}
+
+// AutoPromote switches the desired traffic to the stack of the current
+// version once it is ready. If an intermediate weight is configured, the
+// stack gets it first and only gets all the traffic once it stayed on it for
+// the intermediate duration. Every stack is promoted only once, so the
+// traffic can still be switched back manually, and a stack which lost
+// traffic in a rollback of the traffic analysis isn't promoted any further.
+// It returns the change of the desired traffic weight of the promoted stack,
+// if any.
+//
+// It must be called before ManageTraffic.
+func (ssc *StackSetContainer) AutoPromote(currentTimestamp time.Time) *TrafficChange {
+	autoPromote := ssc.StackSet.Spec.AutoPromote
+	if autoPromote == nil || !ssc.trafficManagementEnabled() {
+		ssc.autoPromoteStackName = ""
+		ssc.autoPromoteIntermediateSince = time.Time{}
+		return nil
+	}
+
+	sc := ssc.stackByName(generateStackName(ssc.StackSet, currentStackVersion(ssc.StackSet)))
+	if sc == nil || sc.PendingRemoval || !sc.IsReady() {
+		return nil
+	}
+
+	// A new stack to promote, start with the intermediate weight if it
+	// doesn't have more traffic already
+	if ssc.autoPromoteStackName != sc.Name() {
+		ssc.autoPromoteStackName = sc.Name()
+		ssc.autoPromoteIntermediateSince = time.Time{}
+
+		if autoPromote.IntermediateWeight != nil && float64(*autoPromote.IntermediateWeight) > sc.desiredTrafficWeight {
+			ssc.autoPromoteIntermediateSince = currentTimestamp
+			return ssc.promoteStack(sc, float64(*autoPromote.IntermediateWeight))
+		}
+		return ssc.promoteStack(sc, 100)
+	}
+
+	// Already promoted
+	if ssc.autoPromoteIntermediateSince.IsZero() {
+		return nil
+	}
+
+	duration := defaultAutoPromoteIntermediateDuration
+	if autoPromote.IntermediateDurationSeconds != nil {
+		duration = time.Duration(*autoPromote.IntermediateDurationSeconds) * time.Second
+	}
+
+	// Stay on the intermediate weight until the actual traffic followed
+	// and the duration has passed
+	if currentTimestamp.Sub(ssc.autoPromoteIntermediateSince) < duration || sc.actualTrafficWeight < sc.desiredTrafficWeight {
+		return nil
+	}
+
+	ssc.autoPromoteIntermediateSince = time.Time{}
+	return ssc.promoteStack(sc, 100)
+}
+
+// stopAutoPromote ends the promotion in progress after the traffic was
+// rolled back, it would undo the rollback otherwise. If the stack of the
+// current version lost traffic it's considered promoted, so it only gets
+// promoted again once the template changes and a new version is created.
+func (ssc *StackSetContainer) stopAutoPromote(changes []TrafficChange) {
+	ssc.autoPromoteIntermediateSince = time.Time{}
+
+	current := generateStackName(ssc.StackSet, currentStackVersion(ssc.StackSet))
+	for _, change := range changes {
+		if change.StackName == current && change.NewTrafficWeight < change.OldTrafficWeight {
+			ssc.autoPromoteStackName = current
+		}
+	}
+}
+
+// promoteStack sets the desired traffic weight of a stack, the remaining
+// traffic is distributed to the other stacks proportionally to their desired
+// traffic weights.
+func (ssc *StackSetContainer) promoteStack(promoted *StackContainer, weight float64) *TrafficChange {
+	weights := make(map[string]float64, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		if sc != promoted {
+			weights[sc.Name()] = sc.desiredTrafficWeight
+		}
+	}
+
+	// Nothing to share the traffic with
+	if allZero(weights) {
+		weight = 100
+	} else {
+		normalizeWeights(weights)
+	}
+
+	for _, sc := range ssc.StackContainers {
+		if sc != promoted {
+			sc.desiredTrafficWeight = weights[sc.Name()] * (100 - weight) / 100
+		}
+	}
+
+	change := &TrafficChange{
+		StackName:        promoted.Name(),
+		OldTrafficWeight: promoted.desiredTrafficWeight,
+		NewTrafficWeight: weight,
+	}
+	promoted.desiredTrafficWeight = weight
+	if change.OldTrafficWeight == change.NewTrafficWeight {
+		return nil
+	}
+	return change
+}
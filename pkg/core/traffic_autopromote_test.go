@@ -0,0 +1,287 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAutoPromote(t *testing.T) {
+	now := time.Now()
+	minuteAgo := now.Add(-time.Minute)
+	hourAgo := now.Add(-time.Hour)
+
+	intermediateWeight := int32(10)
+	intermediateDuration := int64(30)
+
+	intermediate := &zv1.AutoPromoteSpec{
+		IntermediateWeight: &intermediateWeight,
+	}
+
+	for _, tc := range []struct {
+		name                         string
+		autoPromote                  *zv1.AutoPromoteSpec
+		stacks                       map[types.UID]*StackContainer
+		autoPromoteStackName         string
+		autoPromoteIntermediateSince time.Time
+		expectedChange               *TrafficChange
+		expectedStackName            string
+		expectedIntermediateSince    time.Time
+		expectedDesiredWeights       map[string]float64
+	}{
+		{
+			name: "state is cleared if auto promotion is not configured",
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(100, 100).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(0, 0).stack(),
+			},
+			autoPromoteStackName:         "foo-v2",
+			autoPromoteIntermediateSince: minuteAgo,
+			expectedDesiredWeights:       map[string]float64{"foo-v1": 100, "foo-v2": 0},
+		},
+		{
+			name:        "current stack is not promoted until it's ready",
+			autoPromote: &zv1.AutoPromoteSpec{},
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(100, 100).stack(),
+				"v2": testStack("foo-v2").deployment(true, 3, 3, 1).traffic(0, 0).stack(),
+			},
+			expectedDesiredWeights: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+		},
+		{
+			name:        "current stack gets all the traffic once it's ready",
+			autoPromote: &zv1.AutoPromoteSpec{},
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(100, 100).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(0, 0).stack(),
+			},
+			expectedChange:         &TrafficChange{StackName: "foo-v2", OldTrafficWeight: 0, NewTrafficWeight: 100},
+			expectedStackName:      "foo-v2",
+			expectedDesiredWeights: map[string]float64{"foo-v1": 0, "foo-v2": 100},
+		},
+		{
+			name:        "current stack gets the intermediate weight first",
+			autoPromote: intermediate,
+			stacks: map[types.UID]*StackContainer{
+				"v0": testStack("foo-v0").ready(3).traffic(25, 25).stack(),
+				"v1": testStack("foo-v1").ready(3).traffic(75, 75).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(0, 0).stack(),
+			},
+			expectedChange:            &TrafficChange{StackName: "foo-v2", OldTrafficWeight: 0, NewTrafficWeight: 10},
+			expectedStackName:         "foo-v2",
+			expectedIntermediateSince: now,
+			expectedDesiredWeights:    map[string]float64{"foo-v0": 22.5, "foo-v1": 67.5, "foo-v2": 10},
+		},
+		{
+			name:        "intermediate weight is skipped if the stack has more traffic already",
+			autoPromote: intermediate,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(50, 50).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(50, 50).stack(),
+			},
+			expectedChange:         &TrafficChange{StackName: "foo-v2", OldTrafficWeight: 50, NewTrafficWeight: 100},
+			expectedStackName:      "foo-v2",
+			expectedDesiredWeights: map[string]float64{"foo-v1": 0, "foo-v2": 100},
+		},
+		{
+			name:        "current stack stays on the intermediate weight for the intermediate duration",
+			autoPromote: intermediate,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(90, 90).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(10, 10).stack(),
+			},
+			autoPromoteStackName:         "foo-v2",
+			autoPromoteIntermediateSince: minuteAgo,
+			expectedStackName:            "foo-v2",
+			expectedIntermediateSince:    minuteAgo,
+			expectedDesiredWeights:       map[string]float64{"foo-v1": 90, "foo-v2": 10},
+		},
+		{
+			name:        "current stack stays on the intermediate weight until the actual traffic follows",
+			autoPromote: intermediate,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(90, 95).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(10, 5).stack(),
+			},
+			autoPromoteStackName:         "foo-v2",
+			autoPromoteIntermediateSince: hourAgo,
+			expectedStackName:            "foo-v2",
+			expectedIntermediateSince:    hourAgo,
+			expectedDesiredWeights:       map[string]float64{"foo-v1": 90, "foo-v2": 10},
+		},
+		{
+			name:        "current stack gets all the traffic after the intermediate duration",
+			autoPromote: intermediate,
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(90, 90).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(10, 10).stack(),
+			},
+			autoPromoteStackName:         "foo-v2",
+			autoPromoteIntermediateSince: hourAgo,
+			expectedChange:               &TrafficChange{StackName: "foo-v2", OldTrafficWeight: 10, NewTrafficWeight: 100},
+			expectedStackName:            "foo-v2",
+			expectedDesiredWeights:       map[string]float64{"foo-v1": 0, "foo-v2": 100},
+		},
+		{
+			name:        "intermediate duration can be configured",
+			autoPromote: &zv1.AutoPromoteSpec{IntermediateWeight: &intermediateWeight, IntermediateDurationSeconds: &intermediateDuration},
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(90, 90).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(10, 10).stack(),
+			},
+			autoPromoteStackName:         "foo-v2",
+			autoPromoteIntermediateSince: minuteAgo,
+			expectedChange:               &TrafficChange{StackName: "foo-v2", OldTrafficWeight: 10, NewTrafficWeight: 100},
+			expectedStackName:            "foo-v2",
+			expectedDesiredWeights:       map[string]float64{"foo-v1": 0, "foo-v2": 100},
+		},
+		{
+			name:        "promoted stack is not promoted again",
+			autoPromote: &zv1.AutoPromoteSpec{},
+			stacks: map[types.UID]*StackContainer{
+				"v1": testStack("foo-v1").ready(3).traffic(100, 100).stack(),
+				"v2": testStack("foo-v2").ready(3).traffic(0, 0).stack(),
+			},
+			autoPromoteStackName:   "foo-v2",
+			expectedStackName:      "foo-v2",
+			expectedDesiredWeights: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "foo",
+					},
+					Spec: zv1.StackSetSpec{
+						Ingress:     &zv1.StackSetIngressSpec{},
+						AutoPromote: tc.autoPromote,
+						StackTemplate: zv1.StackTemplate{
+							Spec: zv1.StackSpecTemplate{
+								Version: "v2",
+							},
+						},
+					},
+				},
+				StackContainers:              tc.stacks,
+				autoPromoteStackName:         tc.autoPromoteStackName,
+				autoPromoteIntermediateSince: tc.autoPromoteIntermediateSince,
+			}
+
+			change := ssc.AutoPromote(now)
+			require.Equal(t, tc.expectedChange, change)
+			require.Equal(t, tc.expectedStackName, ssc.autoPromoteStackName)
+			require.Equal(t, tc.expectedIntermediateSince, ssc.autoPromoteIntermediateSince)
+
+			desiredWeights := make(map[string]float64)
+			for _, sc := range ssc.StackContainers {
+				desiredWeights[sc.Name()] = sc.desiredTrafficWeight
+			}
+			require.Equal(t, tc.expectedDesiredWeights, desiredWeights)
+		})
+	}
+}
+
+func TestAutoPromoteStatus(t *testing.T) {
+	since := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+
+	stackset := &zv1.StackSet{
+		Spec: zv1.StackSetSpec{
+			AutoPromote: &zv1.AutoPromoteSpec{},
+		},
+		Status: zv1.StackSetStatus{
+			AutoPromote: &zv1.AutoPromoteStatus{
+				StackName:               "foo-v2",
+				IntermediateWeightSince: &since,
+			},
+		},
+	}
+
+	ssc := &StackSetContainer{StackSet: stackset}
+	ssc.updateAutoPromote()
+	require.Equal(t, "foo-v2", ssc.autoPromoteStackName)
+	require.Equal(t, since.Time, ssc.autoPromoteIntermediateSince)
+	require.Equal(t, stackset.Status.AutoPromote, ssc.generateAutoPromoteStatus())
+
+	stackset.Spec.AutoPromote = nil
+	require.Nil(t, ssc.generateAutoPromoteStatus())
+}
+
+func TestAutoPromoteTrafficRollback(t *testing.T) {
+	now := time.Now()
+	intermediateWeight := int32(10)
+	intermediateDuration := int64(30)
+
+	ssc := &StackSetContainer{
+		StackSet: &zv1.StackSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+			Spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{},
+				AutoPromote: &zv1.AutoPromoteSpec{
+					IntermediateWeight:          &intermediateWeight,
+					IntermediateDurationSeconds: &intermediateDuration,
+				},
+				TrafficAnalysis: &zv1.TrafficAnalysisSpec{
+					Queries: []zv1.TrafficAnalysisQuery{
+						{Name: "error-rate", Query: `errors{stack="{{ .Stack }}"}`, Threshold: resource.MustParse("0.05")},
+					},
+				},
+				StackTemplate: zv1.StackTemplate{
+					Spec: zv1.StackSpecTemplate{Version: "v2"},
+				},
+			},
+		},
+		StackContainers: map[types.UID]*StackContainer{
+			"v1": testStack("foo-v1").ready(3).traffic(100, 100).stack(),
+			"v2": testStack("foo-v2").ready(3).traffic(0, 0).stack(),
+		},
+		TrafficReconciler:    SimpleTrafficReconciler{},
+		lastKnownGoodTraffic: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+	}
+	provider := fakeMetricsProvider{values: map[string]float64{`errors{stack="foo-v2"}`: 1}}
+
+	// reconcile runs the steps in the order of the controller and persists
+	// the automatic promotion state in the status
+	reconcile := func(currentTimestamp time.Time) (*TrafficChange, *TrafficRollback) {
+		promotion := ssc.AutoPromote(currentTimestamp)
+		require.NoError(t, ssc.ManageTraffic(currentTimestamp))
+		rollback, err := ssc.AnalyzeTraffic(context.Background(), provider, currentTimestamp)
+		require.NoError(t, err)
+
+		ssc.StackSet.Status.AutoPromote = ssc.generateAutoPromoteStatus()
+		ssc.updateAutoPromote()
+		for _, sc := range ssc.StackContainers {
+			sc.currentActualTrafficWeight = sc.actualTrafficWeight
+		}
+		return promotion, rollback
+	}
+
+	// the current stack gets the intermediate weight and is rolled back
+	promotion, rollback := reconcile(now)
+	require.Equal(t, &TrafficChange{StackName: "foo-v2", OldTrafficWeight: 0, NewTrafficWeight: 10}, promotion)
+	require.NotNil(t, rollback)
+	require.Equal(t, &zv1.AutoPromoteStatus{StackName: "foo-v2"}, ssc.StackSet.Status.AutoPromote)
+
+	// once the intermediate duration passed, the rolled back stack isn't
+	// promoted again
+	for _, currentTimestamp := range []time.Time{now.Add(time.Minute), now.Add(time.Hour)} {
+		promotion, rollback = reconcile(currentTimestamp)
+		require.Nil(t, promotion)
+		require.Nil(t, rollback)
+		require.EqualValues(t, 100, ssc.StackContainers["v1"].actualTrafficWeight)
+		require.EqualValues(t, 0, ssc.StackContainers["v2"].actualTrafficWeight)
+	}
+
+	// a new version is promoted again
+	ssc.StackSet.Spec.StackTemplate.Spec.Version = "v3"
+	ssc.StackContainers["v3"] = testStack("foo-v3").ready(3).traffic(0, 0).stack()
+	provider.values = nil
+	promotion, _ = reconcile(now.Add(2 * time.Hour))
+	require.Equal(t, &TrafficChange{StackName: "foo-v3", OldTrafficWeight: 0, NewTrafficWeight: 10}, promotion)
+}
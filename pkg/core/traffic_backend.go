@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TrafficBackendObject is a routing object managed by a TrafficBackend, e.g.
+// an Ingress or a RouteGroup.
+type TrafficBackendObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// TrafficBackend manages the routing object of a StackSet which distributes
+// the traffic between its stacks according to the actual traffic weights.
+type TrafficBackend interface {
+	// Kind returns the kind of the routing object, e.g. Ingress. It's
+	// used in events and logs.
+	Kind() string
+
+	// Enabled returns true if the StackSet is configured to use the
+	// backend.
+	Enabled(ssc *StackSetContainer) bool
+
+	// Existing returns the routing object of the StackSet currently in
+	// the cluster or nil if there's none.
+	Existing(ssc *StackSetContainer) TrafficBackendObject
+
+	// Generate returns the desired routing object of the StackSet or nil
+	// if the StackSet isn't configured to use the backend.
+	Generate(ssc *StackSetContainer) (TrafficBackendObject, error)
+
+	// NeedsUpdate returns true if the existing routing object differs
+	// from the generated one.
+	NeedsUpdate(existing, generated TrafficBackendObject) bool
+
+	// Updated returns a copy of the existing routing object updated
+	// according to the generated one.
+	Updated(existing, generated TrafficBackendObject) TrafficBackendObject
+
+	// Create creates the routing object in the cluster.
+	Create(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error)
+
+	// Update updates the routing object in the cluster.
+	Update(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error)
+
+	// Delete deletes the routing object from the cluster.
+	Delete(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) error
+}
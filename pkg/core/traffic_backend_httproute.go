@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HTTPRouteTrafficBackend is a TrafficBackend managing the Gateway API
+// HTTPRoute of a StackSet.
+type HTTPRouteTrafficBackend struct{}
+
+func (HTTPRouteTrafficBackend) Kind() string {
+	return "HTTPRoute"
+}
+
+func (HTTPRouteTrafficBackend) Enabled(ssc *StackSetContainer) bool {
+	return ssc.StackSet.Spec.HTTPRoute != nil
+}
+
+func (HTTPRouteTrafficBackend) Existing(ssc *StackSetContainer) TrafficBackendObject {
+	if ssc.HTTPRoute == nil {
+		return nil
+	}
+	return ssc.HTTPRoute
+}
+
+func (HTTPRouteTrafficBackend) Generate(ssc *StackSetContainer) (TrafficBackendObject, error) {
+	route, err := ssc.GenerateHTTPRoute()
+	if err != nil || route == nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+func (HTTPRouteTrafficBackend) NeedsUpdate(existing, generated TrafficBackendObject) bool {
+	existingRoute := existing.(*gatewayv1.HTTPRoute)
+	generatedRoute := generated.(*gatewayv1.HTTPRoute)
+	return !equality.Semantic.DeepDerivative(generatedRoute.Spec, existingRoute.Spec) ||
+		!equality.Semantic.DeepEqual(generatedRoute.Annotations, existingRoute.Annotations)
+}
+
+func (HTTPRouteTrafficBackend) Updated(existing, generated TrafficBackendObject) TrafficBackendObject {
+	generatedRoute := generated.(*gatewayv1.HTTPRoute)
+
+	updated := existing.(*gatewayv1.HTTPRoute).DeepCopy()
+	updated.Spec = generatedRoute.Spec
+	if generatedRoute.Annotations != nil {
+		updated.Annotations = mapCopy(generatedRoute.Annotations)
+	} else {
+		updated.Annotations = make(map[string]string)
+	}
+	return updated
+}
+
+func (HTTPRouteTrafficBackend) Create(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error) {
+	route := obj.(*gatewayv1.HTTPRoute)
+	created, err := client.GatewayV1().HTTPRoutes(route.Namespace).Create(ctx, route, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (HTTPRouteTrafficBackend) Update(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error) {
+	route := obj.(*gatewayv1.HTTPRoute)
+	updated, err := client.GatewayV1().HTTPRoutes(route.Namespace).Update(ctx, route, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (HTTPRouteTrafficBackend) Delete(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) error {
+	return client.GatewayV1().HTTPRoutes(obj.GetNamespace()).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+}
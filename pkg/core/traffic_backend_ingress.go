@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressTrafficBackend is a TrafficBackend managing the Ingress of a
+// StackSet.
+type IngressTrafficBackend struct{}
+
+func (IngressTrafficBackend) Kind() string {
+	return "Ingress"
+}
+
+func (IngressTrafficBackend) Enabled(ssc *StackSetContainer) bool {
+	return ssc.StackSet.Spec.Ingress != nil
+}
+
+func (IngressTrafficBackend) Existing(ssc *StackSetContainer) TrafficBackendObject {
+	if ssc.Ingress == nil {
+		return nil
+	}
+	return ssc.Ingress
+}
+
+func (IngressTrafficBackend) Generate(ssc *StackSetContainer) (TrafficBackendObject, error) {
+	ingress, err := ssc.GenerateIngress()
+	if err != nil || ingress == nil {
+		return nil, err
+	}
+	return ingress, nil
+}
+
+func (IngressTrafficBackend) NeedsUpdate(existing, generated TrafficBackendObject) bool {
+	existingIngress := existing.(*networking.Ingress)
+	generatedIngress := generated.(*networking.Ingress)
+	return !equality.Semantic.DeepDerivative(generatedIngress.Spec, existingIngress.Spec) ||
+		!equality.Semantic.DeepEqual(generatedIngress.Annotations, existingIngress.Annotations)
+}
+
+func (IngressTrafficBackend) Updated(existing, generated TrafficBackendObject) TrafficBackendObject {
+	generatedIngress := generated.(*networking.Ingress)
+
+	updated := existing.(*networking.Ingress).DeepCopy()
+	updated.Spec = generatedIngress.Spec
+	if generatedIngress.Annotations != nil {
+		updated.Annotations = mapCopy(generatedIngress.Annotations)
+	} else {
+		updated.Annotations = make(map[string]string)
+	}
+	return updated
+}
+
+func (IngressTrafficBackend) Create(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error) {
+	ingress := obj.(*networking.Ingress)
+	created, err := client.NetworkingV1().Ingresses(ingress.Namespace).Create(ctx, ingress, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (IngressTrafficBackend) Update(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error) {
+	ingress := obj.(*networking.Ingress)
+	updated, err := client.NetworkingV1().Ingresses(ingress.Namespace).Update(ctx, ingress, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (IngressTrafficBackend) Delete(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) error {
+	return client.NetworkingV1().Ingresses(obj.GetNamespace()).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RouteGroupTrafficBackend is a TrafficBackend managing the RouteGroup of a
+// StackSet.
+type RouteGroupTrafficBackend struct{}
+
+func (RouteGroupTrafficBackend) Kind() string {
+	return "RouteGroup"
+}
+
+func (RouteGroupTrafficBackend) Enabled(ssc *StackSetContainer) bool {
+	return ssc.StackSet.Spec.RouteGroup != nil
+}
+
+func (RouteGroupTrafficBackend) Existing(ssc *StackSetContainer) TrafficBackendObject {
+	if ssc.RouteGroup == nil {
+		return nil
+	}
+	return ssc.RouteGroup
+}
+
+func (RouteGroupTrafficBackend) Generate(ssc *StackSetContainer) (TrafficBackendObject, error) {
+	rg, err := ssc.GenerateRouteGroup()
+	if err != nil || rg == nil {
+		return nil, err
+	}
+	return rg, nil
+}
+
+func (RouteGroupTrafficBackend) NeedsUpdate(existing, generated TrafficBackendObject) bool {
+	return !equality.Semantic.DeepDerivative(generated.(*rgv1.RouteGroup).Spec, existing.(*rgv1.RouteGroup).Spec)
+}
+
+func (RouteGroupTrafficBackend) Updated(existing, generated TrafficBackendObject) TrafficBackendObject {
+	updated := existing.(*rgv1.RouteGroup).DeepCopy()
+	updated.Spec = generated.(*rgv1.RouteGroup).Spec
+	if updated.Annotations == nil {
+		updated.Annotations = make(map[string]string)
+	}
+	return updated
+}
+
+func (RouteGroupTrafficBackend) Create(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error) {
+	rg := obj.(*rgv1.RouteGroup)
+	created, err := client.RouteGroupV1().RouteGroups(rg.Namespace).Create(ctx, rg, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (RouteGroupTrafficBackend) Update(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) (TrafficBackendObject, error) {
+	rg := obj.(*rgv1.RouteGroup)
+	updated, err := client.RouteGroupV1().RouteGroups(rg.Namespace).Update(ctx, rg, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (RouteGroupTrafficBackend) Delete(ctx context.Context, client clientset.Interface, obj TrafficBackendObject) error {
+	return client.RouteGroupV1().RouteGroups(obj.GetNamespace()).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestTrafficBackendGenerate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		backend TrafficBackend
+		spec    zv1.StackSetSpec
+	}{
+		{
+			name:    "ingress",
+			backend: IngressTrafficBackend{},
+			spec: zv1.StackSetSpec{
+				Ingress: &zv1.StackSetIngressSpec{Hosts: []string{"foo.example.org"}, Path: "/"},
+			},
+		},
+		{
+			name:    "routegroup",
+			backend: RouteGroupTrafficBackend{},
+			spec: zv1.StackSetSpec{
+				RouteGroup: &zv1.RouteGroupSpec{Hosts: []string{"foo.example.org"}},
+			},
+		},
+		{
+			name:    "httproute",
+			backend: HTTPRouteTrafficBackend{},
+			spec: zv1.StackSetSpec{
+				HTTPRoute: &zv1.HTTPRouteSpec{Hostnames: []string{"foo.example.org"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			disabled := NewContainer(&zv1.StackSet{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}, SimpleTrafficReconciler{}, "", nil, clock.RealClock{})
+			require.False(t, tc.backend.Enabled(disabled))
+			require.Nil(t, tc.backend.Existing(disabled))
+
+			generated, err := tc.backend.Generate(disabled)
+			require.NoError(t, err)
+			require.Nil(t, generated)
+
+			enabled := NewContainer(&zv1.StackSet{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: tc.spec}, SimpleTrafficReconciler{}, "", nil, clock.RealClock{})
+			enabled.StackContainers["v1"] = testStack("foo-v1").traffic(100, 100).stack()
+			require.True(t, tc.backend.Enabled(enabled))
+
+			generated, err = tc.backend.Generate(enabled)
+			require.NoError(t, err)
+			require.NotNil(t, generated)
+			require.Equal(t, "foo", generated.GetName())
+		})
+	}
+}
+
+func TestIngressTrafficBackendUpdate(t *testing.T) {
+	backend := IngressTrafficBackend{}
+
+	existing := &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{"a": "b"},
+		},
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{{Host: "foo.example.org"}},
+		},
+	}
+
+	require.False(t, backend.NeedsUpdate(existing, existing.DeepCopy()))
+
+	annotationsChanged := existing.DeepCopy()
+	annotationsChanged.Annotations = nil
+	require.True(t, backend.NeedsUpdate(existing, annotationsChanged))
+
+	specChanged := existing.DeepCopy()
+	specChanged.Spec.Rules[0].Host = "bar.example.org"
+	require.True(t, backend.NeedsUpdate(existing, specChanged))
+
+	updated := backend.Updated(existing, annotationsChanged).(*networking.Ingress)
+	require.Equal(t, "1", updated.ResourceVersion)
+	require.Equal(t, map[string]string{}, updated.Annotations)
+	require.Equal(t, map[string]string{"a": "b"}, existing.Annotations)
+
+	updated = backend.Updated(existing, specChanged).(*networking.Ingress)
+	require.Equal(t, specChanged.Spec, updated.Spec)
+}
+
+func TestRouteGroupTrafficBackendUpdate(t *testing.T) {
+	backend := RouteGroupTrafficBackend{}
+
+	existing := &rgv1.RouteGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{"a": "b"},
+		},
+		Spec: rgv1.RouteGroupSpec{
+			Hosts: []string{"foo.example.org"},
+		},
+	}
+
+	annotationsChanged := existing.DeepCopy()
+	annotationsChanged.Annotations = nil
+	require.False(t, backend.NeedsUpdate(existing, annotationsChanged))
+
+	specChanged := existing.DeepCopy()
+	specChanged.Spec.Hosts = []string{"bar.example.org"}
+	require.True(t, backend.NeedsUpdate(existing, specChanged))
+
+	updated := backend.Updated(existing, specChanged).(*rgv1.RouteGroup)
+	require.Equal(t, "1", updated.ResourceVersion)
+	require.Equal(t, map[string]string{"a": "b"}, updated.Annotations)
+	require.Equal(t, specChanged.Spec, updated.Spec)
+}
+
+func TestHTTPRouteTrafficBackendUpdate(t *testing.T) {
+	backend := HTTPRouteTrafficBackend{}
+
+	pathPrefix := "PathPrefix"
+	root := "/"
+	serviceKind := "Service"
+	existing := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{"a": "b"},
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			Hostnames: []string{"foo.example.org"},
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						httpBackendRef("foo-v1", 80, 100),
+					},
+				},
+			},
+		},
+	}
+
+	require.False(t, backend.NeedsUpdate(existing, existing.DeepCopy()))
+
+	// Fields defaulted by the API server are ignored
+	defaulted := existing.DeepCopy()
+	defaulted.Spec.Rules[0].Matches = []gatewayv1.HTTPRouteMatch{
+		{Path: &gatewayv1.HTTPPathMatch{Type: &pathPrefix, Value: &root}},
+	}
+	defaulted.Spec.Rules[0].BackendRefs[0].Kind = &serviceKind
+	require.False(t, backend.NeedsUpdate(defaulted, existing.DeepCopy()))
+
+	annotationsChanged := existing.DeepCopy()
+	annotationsChanged.Annotations = nil
+	require.True(t, backend.NeedsUpdate(existing, annotationsChanged))
+
+	weightsChanged := existing.DeepCopy()
+	weightsChanged.Spec.Rules[0].BackendRefs = []gatewayv1.HTTPBackendRef{
+		httpBackendRef("foo-v1", 80, 50),
+		httpBackendRef("foo-v2", 80, 50),
+	}
+	require.True(t, backend.NeedsUpdate(existing, weightsChanged))
+
+	updated := backend.Updated(existing, annotationsChanged).(*gatewayv1.HTTPRoute)
+	require.Equal(t, "1", updated.ResourceVersion)
+	require.Equal(t, map[string]string{}, updated.Annotations)
+	require.Equal(t, map[string]string{"a": "b"}, existing.Annotations)
+
+	updated = backend.Updated(existing, weightsChanged).(*gatewayv1.HTTPRoute)
+	require.Equal(t, weightsChanged.Spec, updated.Spec)
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"sort"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// trafficHistoryLimit is the number of traffic switches kept in the
+// stackset status.
+const trafficHistoryLimit = 10
+
+// generateTrafficHistory returns the traffic history to be stored in the
+// stackset status. A switch is appended if the actual traffic changed, or if
+// the traffic reconciler failed to apply a desired traffic which wasn't
+// recorded as blocked already. Only the most recent switches are kept.
+func (ssc *StackSetContainer) generateTrafficHistory() []zv1.TrafficSwitch {
+	history := ssc.StackSet.Status.TrafficHistory
+
+	stacks := make([]*StackContainer, 0, len(ssc.StackContainers))
+	for _, sc := range ssc.StackContainers {
+		stacks = append(stacks, sc)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		return stacks[i].Name() < stacks[j].Name()
+	})
+
+	entry := zv1.TrafficSwitch{
+		Timestamp: metav1.NewTime(ssc.now()),
+		Result:    zv1.TrafficSwitchApplied,
+	}
+	if ssc.TrafficReconciler != nil {
+		entry.Reconciler = ssc.TrafficReconciler.Name()
+	}
+
+	for _, sc := range stacks {
+		if sc.currentActualTrafficWeight == 0 && sc.actualTrafficWeight == 0 && sc.desiredTrafficWeight == 0 {
+			continue
+		}
+		entry.Stacks = append(entry.Stacks, zv1.StackTrafficSwitch{
+			StackName:     sc.Name(),
+			OldWeight:     sc.currentActualTrafficWeight,
+			NewWeight:     sc.actualTrafficWeight,
+			DesiredWeight: sc.desiredTrafficWeight,
+		})
+		if sc.actualTrafficWeight != sc.desiredTrafficWeight {
+			entry.Result = zv1.TrafficSwitchPartial
+		}
+	}
+
+	switch {
+	case ssc.trafficError != nil:
+		if len(ssc.TrafficChanges()) == 0 && len(history) > 0 && sameDesiredTraffic(history[len(history)-1], entry) {
+			return history
+		}
+		entry.Result = zv1.TrafficSwitchBlocked
+		entry.Message = ssc.trafficError.Error()
+	case len(ssc.TrafficChanges()) == 0:
+		return history
+	}
+
+	result := make([]zv1.TrafficSwitch, 0, trafficHistoryLimit)
+	if len(history) >= trafficHistoryLimit {
+		history = history[len(history)-trafficHistoryLimit+1:]
+	}
+	result = append(result, history...)
+	return append(result, entry)
+}
+
+// sameDesiredTraffic returns true if the desired traffic weights of both
+// switches are the same.
+func sameDesiredTraffic(a, b zv1.TrafficSwitch) bool {
+	desired := func(entry zv1.TrafficSwitch) map[string]float64 {
+		result := make(map[string]float64)
+		for _, stack := range entry.Stacks {
+			if stack.DesiredWeight > 0 {
+				result[stack.StackName] = stack.DesiredWeight
+			}
+		}
+		return result
+	}
+
+	desiredA, desiredB := desired(a), desired(b)
+	if len(desiredA) != len(desiredB) {
+		return false
+	}
+	for stackName, weight := range desiredA {
+		if desiredB[stackName] != weight {
+			return false
+		}
+	}
+	return true
+}
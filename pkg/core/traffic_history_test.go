@@ -0,0 +1,177 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestGenerateTrafficHistory(t *testing.T) {
+	now := time.Now()
+	earlier := metav1.NewTime(now.Add(-time.Hour))
+
+	blockedSwitch := zv1.TrafficSwitch{
+		Timestamp:  earlier,
+		Reconciler: "simple",
+		Result:     zv1.TrafficSwitchBlocked,
+		Message:    "stacks not ready: foo-v2",
+		Stacks: []zv1.StackTrafficSwitch{
+			{StackName: "foo-v1", OldWeight: 100, NewWeight: 100, DesiredWeight: 0},
+			{StackName: "foo-v2", OldWeight: 0, NewWeight: 0, DesiredWeight: 100},
+		},
+	}
+
+	var fullHistory []zv1.TrafficSwitch
+	for i := 0; i < trafficHistoryLimit; i++ {
+		fullHistory = append(fullHistory, zv1.TrafficSwitch{
+			Timestamp: earlier,
+			Result:    zv1.TrafficSwitchApplied,
+			Message:   fmt.Sprintf("switch %d", i),
+		})
+	}
+
+	for _, tc := range []struct {
+		name         string
+		history      []zv1.TrafficSwitch
+		stacks       []*StackContainer
+		trafficError error
+		expected     []zv1.TrafficSwitch
+	}{
+		{
+			name: "traffic didn't change",
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(100, 100).stack(),
+				testStack("foo-v2").stack(),
+			},
+		},
+		{
+			name: "traffic switched",
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(0, 0).currentActualTrafficWeight(100).stack(),
+				testStack("foo-v2").traffic(100, 100).currentActualTrafficWeight(0).stack(),
+				testStack("foo-v3").stack(),
+			},
+			expected: []zv1.TrafficSwitch{
+				{
+					Timestamp:  metav1.NewTime(now),
+					Reconciler: "simple",
+					Result:     zv1.TrafficSwitchApplied,
+					Stacks: []zv1.StackTrafficSwitch{
+						{StackName: "foo-v1", OldWeight: 100, NewWeight: 0, DesiredWeight: 0},
+						{StackName: "foo-v2", OldWeight: 0, NewWeight: 100, DesiredWeight: 100},
+					},
+				},
+			},
+		},
+		{
+			name: "traffic switched partially",
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(0, 90).currentActualTrafficWeight(100).stack(),
+				testStack("foo-v2").traffic(100, 10).currentActualTrafficWeight(0).stack(),
+			},
+			expected: []zv1.TrafficSwitch{
+				{
+					Timestamp:  metav1.NewTime(now),
+					Reconciler: "simple",
+					Result:     zv1.TrafficSwitchPartial,
+					Stacks: []zv1.StackTrafficSwitch{
+						{StackName: "foo-v1", OldWeight: 100, NewWeight: 90, DesiredWeight: 0},
+						{StackName: "foo-v2", OldWeight: 0, NewWeight: 10, DesiredWeight: 100},
+					},
+				},
+			},
+		},
+		{
+			name: "traffic switch blocked",
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(0, 100).stack(),
+				testStack("foo-v2").traffic(100, 0).stack(),
+			},
+			trafficError: errors.New("stacks not ready: foo-v2"),
+			expected: []zv1.TrafficSwitch{
+				{
+					Timestamp:  metav1.NewTime(now),
+					Reconciler: "simple",
+					Result:     zv1.TrafficSwitchBlocked,
+					Message:    "stacks not ready: foo-v2",
+					Stacks:     blockedSwitch.Stacks,
+				},
+			},
+		},
+		{
+			name:    "blocked traffic switch is only recorded once",
+			history: []zv1.TrafficSwitch{blockedSwitch},
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(0, 100).stack(),
+				testStack("foo-v2").traffic(100, 0).stack(),
+			},
+			trafficError: errors.New("stacks not ready: foo-v2"),
+			expected:     []zv1.TrafficSwitch{blockedSwitch},
+		},
+		{
+			name:    "blocked traffic switch is recorded when the desired traffic changes",
+			history: []zv1.TrafficSwitch{blockedSwitch},
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(50, 100).stack(),
+				testStack("foo-v2").traffic(50, 0).stack(),
+			},
+			trafficError: errors.New("stacks not ready: foo-v2"),
+			expected: []zv1.TrafficSwitch{
+				blockedSwitch,
+				{
+					Timestamp:  metav1.NewTime(now),
+					Reconciler: "simple",
+					Result:     zv1.TrafficSwitchBlocked,
+					Message:    "stacks not ready: foo-v2",
+					Stacks: []zv1.StackTrafficSwitch{
+						{StackName: "foo-v1", OldWeight: 100, NewWeight: 100, DesiredWeight: 50},
+						{StackName: "foo-v2", OldWeight: 0, NewWeight: 0, DesiredWeight: 50},
+					},
+				},
+			},
+		},
+		{
+			name:    "oldest switches are dropped",
+			history: fullHistory,
+			stacks: []*StackContainer{
+				testStack("foo-v1").traffic(100, 100).currentActualTrafficWeight(0).stack(),
+			},
+			expected: append(append([]zv1.TrafficSwitch{}, fullHistory[1:]...), zv1.TrafficSwitch{
+				Timestamp:  metav1.NewTime(now),
+				Reconciler: "simple",
+				Result:     zv1.TrafficSwitchApplied,
+				Stacks: []zv1.StackTrafficSwitch{
+					{StackName: "foo-v1", OldWeight: 0, NewWeight: 100, DesiredWeight: 100},
+				},
+			}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Status: zv1.StackSetStatus{
+						TrafficHistory: tc.history,
+					},
+				},
+				StackContainers:   make(map[types.UID]*StackContainer),
+				TrafficReconciler: SimpleTrafficReconciler{},
+				Clock:             clock.NewFakeClock(now),
+				trafficError:      tc.trafficError,
+			}
+			for _, sc := range tc.stacks {
+				ssc.StackContainers[types.UID(sc.Name())] = sc
+			}
+
+			history := ssc.GenerateStackSetStatus().TrafficHistory
+			require.Equal(t, tc.expected, history)
+			require.LessOrEqual(t, len(history), trafficHistoryLimit)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// TrafficHookLabelKey is the label set on the Jobs of the traffic
+	// hooks and their pods, its value is the name of the hook.
+	TrafficHookLabelKey = "stackset-controller.zalando.org/traffic-hook"
+
+	// PreTrafficSwitchHook is run before a stack first gets traffic.
+	PreTrafficSwitchHook = "pre-traffic-switch"
+	// PostTrafficSwitchHook is run once a stack gets all the traffic.
+	PostTrafficSwitchHook = "post-traffic-switch"
+
+	trafficHookJobNameHashLength = 8
+)
+
+// jobHasCondition returns true if the job has the condition with the status
+// true.
+func jobHasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	if job == nil {
+		return false
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// preTrafficSwitchHookPending returns true if the stack would get traffic
+// for the first time, but its pre traffic switch hook didn't succeed yet.
+func (sc *StackContainer) preTrafficSwitchHookPending() bool {
+	if sc.trafficHooks == nil || sc.trafficHooks.PreTrafficSwitch == nil {
+		return false
+	}
+	return sc.actualTrafficWeight == 0 && sc.desiredTrafficWeight > 0 && !jobHasCondition(sc.Resources.PreTrafficSwitchJob, batchv1.JobComplete)
+}
+
+// preTrafficSwitchHookFailed returns true if the Job of the pre traffic
+// switch hook failed.
+func (sc *StackContainer) preTrafficSwitchHookFailed() bool {
+	return jobHasCondition(sc.Resources.PreTrafficSwitchJob, batchv1.JobFailed)
+}
+
+// checkPreTrafficSwitchHooks returns an error if one of the stacks would get
+// traffic for the first time before its pre traffic switch hook succeeded.
+func checkPreTrafficSwitchHooks(stacks map[string]*StackContainer) error {
+	var failed, pending []string
+	for stackName, stack := range stacks {
+		if !stack.preTrafficSwitchHookPending() {
+			continue
+		}
+		if stack.preTrafficSwitchHookFailed() {
+			failed = append(failed, stackName)
+		} else {
+			pending = append(pending, stackName)
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("pre traffic switch hook failed: %s", strings.Join(failed, ", "))
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		return fmt.Errorf("waiting for pre traffic switch hook: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// stackHostnames returns the per-stack hostnames of the stack, sorted.
+func (sc *StackContainer) stackHostnames() []string {
+	if !sc.HasBackendPort() {
+		return nil
+	}
+
+	var hosts []string
+	if sc.ingressSpec != nil {
+		hosts = append(hosts, sc.ingressSpec.Hosts...)
+	}
+	if sc.routeGroupSpec != nil {
+		hosts = append(hosts, sc.routeGroupSpec.Hosts...)
+	}
+	if sc.httpRouteSpec != nil {
+		hosts = append(hosts, sc.httpRouteSpec.Hostnames...)
+	}
+
+	hostnames := make(map[string]struct{})
+	for _, host := range hosts {
+		for _, domain := range sc.clusterDomains {
+			if strings.HasSuffix(host, domain) {
+				hostnames[fmt.Sprintf("%s.%s", sc.Name(), domain)] = struct{}{}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(hostnames))
+	for hostname := range hostnames {
+		result = append(result, hostname)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GeneratePreTrafficSwitchJob returns the Job of the pre traffic switch hook
+// once the stack is ready, or nil if there is none or the stack already gets
+// traffic.
+func (sc *StackContainer) GeneratePreTrafficSwitchJob() *batchv1.Job {
+	if sc.trafficHooks == nil || sc.trafficHooks.PreTrafficSwitch == nil {
+		return nil
+	}
+	if sc.PendingRemoval || !sc.IsReady() || sc.actualTrafficWeight > 0 {
+		return nil
+	}
+	return sc.generateTrafficHookJob(PreTrafficSwitchHook, sc.trafficHooks.PreTrafficSwitch)
+}
+
+// GeneratePostTrafficSwitchJob returns the Job of the post traffic switch
+// hook once the stack gets all the traffic, or nil if there is none.
+func (sc *StackContainer) GeneratePostTrafficSwitchJob() *batchv1.Job {
+	if sc.trafficHooks == nil || sc.trafficHooks.PostTrafficSwitch == nil {
+		return nil
+	}
+	if sc.PendingRemoval || sc.actualTrafficWeight < 100 {
+		return nil
+	}
+	return sc.generateTrafficHookJob(PostTrafficSwitchHook, sc.trafficHooks.PostTrafficSwitch)
+}
+
+func (sc *StackContainer) generateTrafficHookJob(hook string, spec *zv1.TrafficHookJobSpec) *batchv1.Job {
+	objectMeta := sc.resourceMeta()
+	objectMeta.Name = trafficHookJobName(sc.Name(), hook)
+	objectMeta.Labels[TrafficHookLabelKey] = hook
+	objectMeta.Annotations = mergeLabels(objectMeta.Annotations, spec.Annotations)
+
+	// the pods don't get the labels of the stack, they would be selected
+	// by its service otherwise
+	templateObjectMeta := embeddedToObjectMeta(spec.PodTemplate.EmbeddedObjectMeta)
+	templateObjectMeta = objectMetaInjectLabels(templateObjectMeta, map[string]string{TrafficHookLabelKey: hook})
+
+	podSpec := spec.PodTemplate.Spec.DeepCopy()
+	if podSpec.RestartPolicy == "" {
+		podSpec.RestartPolicy = v1.RestartPolicyNever
+	}
+
+	env := []v1.EnvVar{
+		{Name: "STACK_NAME", Value: sc.Name()},
+		{Name: "STACK_NAMESPACE", Value: sc.Namespace()},
+		{Name: "STACK_HOSTNAMES", Value: strings.Join(sc.stackHostnames(), ",")},
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Env = injectEnv(podSpec.Containers[i].Env, env)
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: objectMeta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          spec.BackoffLimit,
+			ActiveDeadlineSeconds: spec.ActiveDeadlineSeconds,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: templateObjectMeta,
+				Spec:       *podSpec,
+			},
+		},
+	}
+}
+
+// trafficHookJobName returns the name of the Job of a hook. The name is used
+// for the job-name label of its pods, long stack names are truncated and
+// suffixed with a hash of the full name to stay within the limit of label
+// values.
+func trafficHookJobName(stackName, hook string) string {
+	name := fmt.Sprintf("%s-%s", stackName, hook)
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := fmt.Sprintf("-%s-%s", hex.EncodeToString(hash[:])[:trafficHookJobNameHashLength], hook)
+	return stackName[:validation.LabelValueMaxLength-len(suffix)] + suffix
+}
+
+// injectEnv adds the environment variables which aren't defined already.
+func injectEnv(env []v1.EnvVar, inject []v1.EnvVar) []v1.EnvVar {
+	defined := make(map[string]struct{}, len(env))
+	for _, envVar := range env {
+		defined[envVar.Name] = struct{}{}
+	}
+	for _, envVar := range inject {
+		if _, ok := defined[envVar.Name]; !ok {
+			env = append(env, envVar)
+		}
+	}
+	return env
+}
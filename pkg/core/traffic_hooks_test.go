@@ -0,0 +1,260 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestPreTrafficSwitchHook(t *testing.T) {
+	running := testStack("foo-v2").ready(3).traffic(100, 0).preTrafficSwitchHook("").stack()
+	running.Resources.PreTrafficSwitchJob = &batchv1.Job{}
+
+	for _, tc := range []struct {
+		name            string
+		stack           *StackContainer
+		expectedErr     string
+		expectedTraffic map[string]float64
+		expectedReason  string
+	}{
+		{
+			name:            "no hook",
+			stack:           testStack("foo-v2").ready(3).traffic(100, 0).stack(),
+			expectedTraffic: map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedReason:  "TrafficSwitched",
+		},
+		{
+			name:            "hook job not created yet",
+			stack:           testStack("foo-v2").ready(3).traffic(100, 0).preTrafficSwitchHook("").stack(),
+			expectedErr:     "waiting for pre traffic switch hook: foo-v2",
+			expectedTraffic: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedReason:  "WaitingForPreTrafficSwitchHook",
+		},
+		{
+			name:            "hook job running",
+			stack:           running,
+			expectedErr:     "waiting for pre traffic switch hook: foo-v2",
+			expectedTraffic: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedReason:  "WaitingForPreTrafficSwitchHook",
+		},
+		{
+			name:            "hook job failed",
+			stack:           testStack("foo-v2").ready(3).traffic(100, 0).preTrafficSwitchHook(batchv1.JobFailed).stack(),
+			expectedErr:     "pre traffic switch hook failed: foo-v2",
+			expectedTraffic: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedReason:  "PreTrafficSwitchHookFailed",
+		},
+		{
+			name:            "hook job succeeded",
+			stack:           testStack("foo-v2").ready(3).traffic(100, 0).preTrafficSwitchHook(batchv1.JobComplete).stack(),
+			expectedTraffic: map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedReason:  "TrafficSwitched",
+		},
+		{
+			name:            "stack getting traffic already",
+			stack:           testStack("foo-v2").ready(3).traffic(100, 50).preTrafficSwitchHook("").stack(),
+			expectedTraffic: map[string]float64{"foo-v1": 0, "foo-v2": 100},
+			expectedReason:  "TrafficSwitched",
+		},
+		{
+			name:            "stack not ready",
+			stack:           testStack("foo-v2").deployment(true, 3, 3, 1).traffic(100, 0).preTrafficSwitchHook("").stack(),
+			expectedErr:     "stacks not ready: foo-v2",
+			expectedTraffic: map[string]float64{"foo-v1": 100, "foo-v2": 0},
+			expectedReason:  "WaitingForReadiness",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			old := testStack("foo-v1").ready(3).traffic(0, 100).stack()
+			ssc := &StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers: map[types.UID]*StackContainer{
+					"v1": old,
+					"v2": tc.stack,
+				},
+				TrafficReconciler: SimpleTrafficReconciler{},
+				Clock:             clock.RealClock{},
+			}
+
+			err := ssc.ManageTraffic(ssc.now())
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actual := map[string]float64{
+				"foo-v1": old.actualTrafficWeight,
+				"foo-v2": tc.stack.actualTrafficWeight,
+			}
+			require.Equal(t, tc.expectedTraffic, actual)
+
+			conditions := tc.stack.GenerateStackStatus().Conditions
+			require.Equal(t, tc.expectedReason, meta.FindStatusCondition(conditions, zv1.StackConditionTrafficSwitching).Reason)
+		})
+	}
+}
+
+func TestGenerateTrafficHookJobs(t *testing.T) {
+	hooks := &zv1.TrafficHooks{
+		PreTrafficSwitch: &zv1.TrafficHookJobSpec{
+			EmbeddedObjectMetaWithAnnotations: zv1.EmbeddedObjectMetaWithAnnotations{
+				Annotations: map[string]string{"job-annotation": "foo"},
+			},
+			BackoffLimit: wrapReplicas(2),
+			PodTemplate: zv1.TrafficHookPodTemplate{PodTemplateSpec: zv1.PodTemplateSpec{
+				EmbeddedObjectMeta: zv1.EmbeddedObjectMeta{
+					Labels: map[string]string{"pod-label": "foo"},
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:  "smoke-test",
+							Image: "smoke-test",
+							Env: []v1.EnvVar{
+								{Name: "STACK_NAME", Value: "custom"},
+							},
+						},
+					},
+				},
+			}},
+		},
+		PostTrafficSwitch: &zv1.TrafficHookJobSpec{
+			PodTemplate: zv1.TrafficHookPodTemplate{PodTemplateSpec: zv1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					RestartPolicy: v1.RestartPolicyOnFailure,
+					Containers: []v1.Container{
+						{Name: "notify", Image: "notify"},
+					},
+				},
+			}},
+		},
+	}
+
+	newStack := func(actualTraffic float64, ready bool) *StackContainer {
+		sc := testStack("foo-v1").traffic(actualTraffic, actualTraffic).stack()
+		if ready {
+			sc.resourcesUpdated = true
+			sc.deploymentReplicas, sc.updatedReplicas, sc.readyReplicas = 1, 1, 1
+		}
+		sc.Stack.Namespace = "bar"
+		sc.Stack.UID = "stack-uid"
+		sc.Stack.Generation = 2
+		sc.Stack.Labels = map[string]string{StacksetHeritageLabelKey: "foo", StackVersionLabelKey: "v1"}
+		sc.trafficHooks = hooks
+		sc.ingressSpec = &zv1.StackSetIngressSpec{
+			Hosts:       []string{"foo.example.org", "foo.example.com"},
+			BackendPort: intstr.FromInt(80),
+		}
+		sc.clusterDomains = []string{"example.org", "example.com"}
+		return sc
+	}
+
+	t.Run("pre traffic switch job of a ready stack", func(t *testing.T) {
+		job := newStack(0, true).GeneratePreTrafficSwitchJob()
+		require.NotNil(t, job)
+		require.Equal(t, "foo-v1-pre-traffic-switch", job.Name)
+		require.Equal(t, "bar", job.Namespace)
+		require.Equal(t, map[string]string{
+			StacksetHeritageLabelKey: "foo",
+			StackVersionLabelKey:     "v1",
+			TrafficHookLabelKey:      PreTrafficSwitchHook,
+		}, job.Labels)
+		require.Equal(t, map[string]string{
+			stackGenerationAnnotationKey: "2",
+			"job-annotation":             "foo",
+		}, job.Annotations)
+		require.Equal(t, []metav1.OwnerReference{
+			{APIVersion: APIVersion, Kind: KindStack, Name: "foo-v1", UID: "stack-uid"},
+		}, job.OwnerReferences)
+		require.Equal(t, wrapReplicas(2), job.Spec.BackoffLimit)
+
+		template := job.Spec.Template
+		require.Equal(t, map[string]string{
+			"pod-label":         "foo",
+			TrafficHookLabelKey: PreTrafficSwitchHook,
+		}, template.Labels)
+		require.Equal(t, v1.RestartPolicyNever, template.Spec.RestartPolicy)
+		require.Equal(t, []v1.EnvVar{
+			{Name: "STACK_NAME", Value: "custom"},
+			{Name: "STACK_NAMESPACE", Value: "bar"},
+			{Name: "STACK_HOSTNAMES", Value: "foo-v1.example.com,foo-v1.example.org"},
+		}, template.Spec.Containers[0].Env)
+
+		// the template of the stackset isn't modified
+		require.Len(t, hooks.PreTrafficSwitch.PodTemplate.Spec.Containers[0].Env, 1)
+	})
+
+	t.Run("no pre traffic switch job for a stack which isn't ready", func(t *testing.T) {
+		require.Nil(t, newStack(0, false).GeneratePreTrafficSwitchJob())
+	})
+
+	t.Run("no pre traffic switch job for a stack getting traffic", func(t *testing.T) {
+		require.Nil(t, newStack(20, true).GeneratePreTrafficSwitchJob())
+	})
+
+	t.Run("post traffic switch job once the stack gets all the traffic", func(t *testing.T) {
+		require.Nil(t, newStack(80, true).GeneratePostTrafficSwitchJob())
+
+		job := newStack(100, true).GeneratePostTrafficSwitchJob()
+		require.NotNil(t, job)
+		require.Equal(t, "foo-v1-post-traffic-switch", job.Name)
+		require.Equal(t, PostTrafficSwitchHook, job.Labels[TrafficHookLabelKey])
+		require.Equal(t, v1.RestartPolicyOnFailure, job.Spec.Template.Spec.RestartPolicy)
+	})
+
+	t.Run("no jobs without hooks", func(t *testing.T) {
+		sc := newStack(100, true)
+		sc.trafficHooks = nil
+		require.Nil(t, sc.GeneratePreTrafficSwitchJob())
+		require.Nil(t, sc.GeneratePostTrafficSwitchJob())
+	})
+}
+
+func TestTrafficHookPodTemplateJSON(t *testing.T) {
+	data := []byte(`{"podTemplate":{"metadata":{"labels":{"pod-label":"foo"}},"spec":{"containers":[{"name":"smoke-test","image":"smoke-test"}]}}}`)
+
+	var hook zv1.TrafficHookJobSpec
+	require.NoError(t, json.Unmarshal(data, &hook))
+	require.Equal(t, map[string]string{"pod-label": "foo"}, hook.PodTemplate.Labels)
+	require.Equal(t, []v1.Container{{Name: "smoke-test", Image: "smoke-test"}}, hook.PodTemplate.Spec.Containers)
+
+	// the pod template is encoded like a PodTemplateSpec
+	encoded, err := json.Marshal(hook.PodTemplate)
+	require.NoError(t, err)
+	expected, err := json.Marshal(hook.PodTemplate.PodTemplateSpec)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), string(encoded))
+}
+
+func TestTrafficHookJobName(t *testing.T) {
+	require.Equal(t, "foo-v1-pre-traffic-switch", trafficHookJobName("foo-v1", PreTrafficSwitchHook))
+
+	longStackName := strings.Repeat("a", 50) + "-v1"
+	for _, hook := range []string{PreTrafficSwitchHook, PostTrafficSwitchHook} {
+		name := trafficHookJobName(longStackName, hook)
+		require.Len(t, name, validation.LabelValueMaxLength)
+		require.True(t, strings.HasPrefix(name, strings.Repeat("a", 20)))
+		require.True(t, strings.HasSuffix(name, "-"+hook))
+		require.Empty(t, validation.IsDNS1123Subdomain(name))
+
+		// stacks differing only in the truncated part get different Jobs
+		require.NotEqual(t, name, trafficHookJobName(strings.Repeat("a", 50)+"-v2", hook))
+		require.Equal(t, name, trafficHookJobName(longStackName, hook))
+	}
+}
@@ -14,6 +14,10 @@ type PrescalingTrafficReconciler struct {
 	ResetHPAMinReplicasTimeout time.Duration
 }
 
+func (PrescalingTrafficReconciler) Name() string {
+	return "prescaling"
+}
+
 func (r PrescalingTrafficReconciler) Reconcile(stacks map[string]*StackContainer, currentTimestamp time.Time) error {
 	// Calculate how many replicas we need per unit of traffic
 	totalReplicas := 0.0
@@ -69,7 +73,7 @@ func (r PrescalingTrafficReconciler) Reconcile(stacks map[string]*StackContainer
 		}
 
 		// If prescaling is active and the prescaling timeout has expired then deactivate the prescaling
-		if stack.prescalingActive && !stack.prescalingLastTrafficIncrease.IsZero() && time.Since(stack.prescalingLastTrafficIncrease) > r.ResetHPAMinReplicasTimeout {
+		if stack.prescalingActive && !stack.prescalingLastTrafficIncrease.IsZero() && currentTimestamp.Sub(stack.prescalingLastTrafficIncrease) > r.ResetHPAMinReplicasTimeout {
 			stack.prescalingActive = false
 			stack.prescalingReplicas = 0
 			stack.prescalingDesiredTrafficWeight = 0
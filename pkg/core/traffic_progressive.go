@@ -0,0 +1,106 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProgressiveTrafficReconciler is a traffic reconciler that moves the actual
+// traffic weight of stacks gaining traffic towards the desired weight in
+// configured steps, staying on every step for at least StepDuration.
+type ProgressiveTrafficReconciler struct {
+	// Steps are the traffic weights in percent a stack goes through
+	// before reaching its desired weight. They must be sorted in
+	// ascending order.
+	Steps        []float64
+	StepDuration time.Duration
+}
+
+// nextStep returns the index and the weight of the first step above the
+// actual weight, capped at the desired weight. If no step is left the desired
+// weight is returned together with the number of steps.
+func (r ProgressiveTrafficReconciler) nextStep(actualWeight, desiredWeight float64) (int32, float64) {
+	for i, step := range r.Steps {
+		if step > actualWeight {
+			if step >= desiredWeight {
+				break
+			}
+			return int32(i), step
+		}
+	}
+	return int32(len(r.Steps)), desiredWeight
+}
+
+func (ProgressiveTrafficReconciler) Name() string {
+	return "progressive"
+}
+
+func (r ProgressiveTrafficReconciler) Reconcile(stacks map[string]*StackContainer, currentTimestamp time.Time) error {
+	var nonReadyStacks []string
+	for stackName, stack := range stacks {
+		if stack.desiredTrafficWeight > stack.actualTrafficWeight && !stack.IsReady() {
+			nonReadyStacks = append(nonReadyStacks, stackName)
+		}
+	}
+	if len(nonReadyStacks) > 0 {
+		sort.Strings(nonReadyStacks)
+		return fmt.Errorf("stacks not ready: %s", strings.Join(nonReadyStacks, ", "))
+	}
+
+	// Move the stacks gaining traffic to their next step
+	actualWeights := make(map[string]float64, len(stacks))
+	var gainedTraffic, releasableTraffic float64
+	for stackName, stack := range stacks {
+		if stack.desiredTrafficWeight <= stack.actualTrafficWeight {
+			releasableTraffic += stack.actualTrafficWeight - stack.desiredTrafficWeight
+			stack.progressiveActive = false
+			stack.progressiveStep = 0
+			stack.progressiveLastStepIncrease = time.Time{}
+			continue
+		}
+
+		actualWeights[stackName] = stack.actualTrafficWeight
+
+		// Stay on the current step until the step duration has passed
+		if stack.progressiveActive && !stack.progressiveLastStepIncrease.IsZero() && currentTimestamp.Sub(stack.progressiveLastStepIncrease) < r.StepDuration {
+			continue
+		}
+
+		step, weight := r.nextStep(stack.actualTrafficWeight, stack.desiredTrafficWeight)
+		actualWeights[stackName] = weight
+		gainedTraffic += weight - stack.actualTrafficWeight
+
+		if weight < stack.desiredTrafficWeight {
+			stack.progressiveActive = true
+			stack.progressiveStep = step
+			stack.progressiveLastStepIncrease = currentTimestamp
+		} else {
+			stack.progressiveActive = false
+			stack.progressiveStep = 0
+			stack.progressiveLastStepIncrease = time.Time{}
+		}
+	}
+
+	// Take the gained traffic away from the stacks losing traffic,
+	// proportionally to the amount of traffic each of them is going to lose.
+	for stackName, stack := range stacks {
+		if stack.desiredTrafficWeight > stack.actualTrafficWeight {
+			continue
+		}
+		actualWeights[stackName] = stack.desiredTrafficWeight
+		if gainedTraffic < releasableTraffic {
+			excess := stack.actualTrafficWeight - stack.desiredTrafficWeight
+			actualWeights[stackName] = stack.actualTrafficWeight - excess*gainedTraffic/releasableTraffic
+		}
+	}
+
+	normalizeWeights(actualWeights)
+
+	for stackName, stack := range stacks {
+		stack.actualTrafficWeight = actualWeights[stackName]
+	}
+
+	return nil
+}
@@ -12,6 +12,10 @@ import (
 // stackset-controller.
 type SimpleTrafficReconciler struct{}
 
+func (SimpleTrafficReconciler) Name() string {
+	return "simple"
+}
+
 func (SimpleTrafficReconciler) Reconcile(stacks map[string]*StackContainer, currentTimestamp time.Time) error {
 	actualWeights := make(map[string]float64, len(stacks))
 
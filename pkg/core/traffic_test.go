@@ -20,6 +20,10 @@ func TestTrafficSwitchNoIngress(t *testing.T) {
 		"prescale": PrescalingTrafficReconciler{
 			ResetHPAMinReplicasTimeout: time.Minute,
 		},
+		"progressive": ProgressiveTrafficReconciler{
+			Steps:        []float64{5, 20, 50},
+			StepDuration: time.Minute,
+		},
 	} {
 		t.Run(reconcilerName, func(t *testing.T) {
 			c := StackSetContainer{
@@ -710,12 +714,172 @@ func TestTrafficSwitchPrescaling(t *testing.T) {
 	}
 }
 
+func TestTrafficSwitchProgressive(t *testing.T) {
+	now := time.Now()
+	halfMinuteAgo := now.Add(-30 * time.Second)
+	twoMinutesAgo := now.Add(-2 * time.Minute)
+
+	type expectedProgress struct {
+		active           bool
+		step             int32
+		lastStepIncrease time.Time
+	}
+
+	for _, tc := range []struct {
+		name                  string
+		stacks                map[types.UID]*StackContainer
+		expectedProgress      map[string]expectedProgress
+		expectedActualWeights map[string]float64
+		expectedError         string
+	}{
+		{
+			name: "stack gaining traffic is moved to the first step",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 100).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 0).ready(3).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v1": {},
+				"foo-v2": {true, 0, now},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 95,
+				"foo-v2": 5,
+			},
+		},
+		{
+			name: "stack stays on the current step until the step duration has passed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 95).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 5).ready(3).progressive(0, halfMinuteAgo).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v2": {true, 0, halfMinuteAgo},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 95,
+				"foo-v2": 5,
+			},
+		},
+		{
+			name: "stack is moved to the next step after the step duration has passed",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 95).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 5).ready(3).progressive(0, twoMinutesAgo).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v2": {true, 1, now},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 80,
+				"foo-v2": 20,
+			},
+		},
+		{
+			name: "stack gets the desired traffic after the last step",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 50).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 50).ready(3).progressive(2, twoMinutesAgo).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v2": {},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 0,
+				"foo-v2": 100,
+			},
+		},
+		{
+			name: "steps above the desired traffic are skipped",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(70, 80).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(30, 20).ready(3).progressive(1, twoMinutesAgo).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v2": {},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 70,
+				"foo-v2": 30,
+			},
+		},
+		{
+			name: "traffic is taken from the stacks losing traffic proportionally",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 60).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(0, 40).ready(3).stack(),
+				"foo-v3": testStack("foo-v3").traffic(100, 0).ready(3).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v3": {true, 0, now},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 57,
+				"foo-v2": 38,
+				"foo-v3": 5,
+			},
+		},
+		{
+			name: "traffic is not switched if the stack gaining traffic is not ready",
+			stacks: map[types.UID]*StackContainer{
+				"foo-v1": testStack("foo-v1").traffic(0, 95).ready(3).stack(),
+				"foo-v2": testStack("foo-v2").traffic(100, 5).deployment(true, 3, 3, 2).progressive(0, twoMinutesAgo).stack(),
+			},
+			expectedProgress: map[string]expectedProgress{
+				"foo-v2": {true, 0, twoMinutesAgo},
+			},
+			expectedActualWeights: map[string]float64{
+				"foo-v1": 95,
+				"foo-v2": 5,
+			},
+			expectedError: "stacks not ready: foo-v2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := StackSetContainer{
+				StackSet: &zv1.StackSet{
+					Spec: zv1.StackSetSpec{
+						Ingress: &zv1.StackSetIngressSpec{},
+					},
+				},
+				StackContainers: tc.stacks,
+				TrafficReconciler: ProgressiveTrafficReconciler{
+					Steps:        []float64{5, 20, 50},
+					StepDuration: time.Minute,
+				},
+			}
+
+			err := c.ManageTraffic(now)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			for name, expected := range tc.expectedProgress {
+				stack := c.StackContainers[types.UID(name)]
+				require.Equal(t, expected.active, stack.progressiveActive, "progressive active: %s", name)
+				require.Equal(t, expected.step, stack.progressiveStep, "progressive step: %s", name)
+				require.Equal(t, expected.lastStepIncrease, stack.progressiveLastStepIncrease, "progressive last step increase: %s", name)
+			}
+
+			for name, weight := range tc.expectedActualWeights {
+				require.InDelta(t, weight, c.StackContainers[types.UID(name)].actualTrafficWeight, 0.001, "actual traffic weight: %s", name)
+			}
+		})
+	}
+}
+
 func TestTrafficSwitchNoTrafficSince(t *testing.T) {
 	for reconcilerName, reconciler := range map[string]TrafficReconciler{
 		"simple": SimpleTrafficReconciler{},
 		"prescale": PrescalingTrafficReconciler{
 			ResetHPAMinReplicasTimeout: time.Minute,
 		},
+		"progressive": ProgressiveTrafficReconciler{
+			Steps:        []float64{5, 20, 50},
+			StepDuration: time.Minute,
+		},
 	} {
 		t.Run(reconcilerName, func(t *testing.T) {
 			c := StackSetContainer{
@@ -7,12 +7,15 @@ import (
 	"time"
 
 	rgv1 "github.com/szuecs/routegroup-client/apis/zalando.org/v1"
+	gatewayv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/gateway.networking.k8s.io/v1"
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscaling "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -47,11 +50,21 @@ type StackSetContainer struct {
 	// specified by the user on the StackSet.
 	RouteGroup *rgv1.RouteGroup
 
+	// HTTPRoute defines the current Gateway API HTTPRoute resource
+	// belonging to the StackSet. This is a reference to the actual
+	// resource while `StackSet.Spec.HTTPRoute` defines the HTTPRoute
+	// configuration specified by the user on the StackSet.
+	HTTPRoute *gatewayv1.HTTPRoute
+
 	// TrafficReconciler is the reconciler implementation used for
 	// switching traffic between stacks. E.g. for prescaling stacks before
 	// switching traffic.
 	TrafficReconciler TrafficReconciler
 
+	// Clock is the source of the current time for the time based
+	// decisions, e.g. scaling down stacks without traffic.
+	Clock clock.PassiveClock
+
 	// ExternalIngressBackendPort defines the backendPort mapping
 	// if an external entity creates ingress objects for us. The
 	// Ingress of stackset should be nil in this case.
@@ -65,6 +78,17 @@ type StackSetContainer struct {
 	// clusterDomains stores the main domain names of the cluster;
 	// per-stack ingress hostnames are not generated for names outside of them
 	clusterDomains []string
+
+	// Traffic analysis state, from the stackset status
+	lastKnownGoodTraffic        map[string]float64
+	analysisLastTrafficIncrease time.Time
+
+	// Automatic promotion state, from the stackset status
+	autoPromoteStackName         string
+	autoPromoteIntermediateSince time.Time
+
+	// trafficError is the error of the last traffic reconciliation
+	trafficError error
 }
 
 // StackContainer is a container for storing the full state of a Stack
@@ -84,9 +108,12 @@ type StackContainer struct {
 	stacksetName   string
 	ingressSpec    *zv1.StackSetIngressSpec
 	routeGroupSpec *zv1.RouteGroupSpec
+	httpRouteSpec  *zv1.HTTPRouteSpec
+	trafficHooks   *zv1.TrafficHooks
 	scaledownTTL   time.Duration
 	backendPort    *intstr.IntOrString
 	clusterDomains []string
+	clock          clock.PassiveClock
 
 	// Fields from the stack itself, with some defaults applied
 	stackReplicas int32
@@ -96,6 +123,12 @@ type StackContainer struct {
 	// Set to true only if all related resources have been updated according to the latest stack version
 	resourcesUpdated bool
 
+	// Resources which weren't updated according to the latest stack version yet
+	outdatedResources []string
+
+	// Readiness gates of the stack which aren't met
+	unmetReadinessGates []string
+
 	// Current number of replicas that the deployment is expected to have, from Deployment.spec
 	deploymentReplicas int32
 
@@ -112,11 +145,16 @@ type StackContainer struct {
 	currentActualTrafficWeight     float64
 	actualTrafficWeight            float64
 	desiredTrafficWeight           float64
+	shadowTrafficWeight            float64
+	stackRouted                    bool
 	noTrafficSince                 time.Time
 	prescalingActive               bool
 	prescalingReplicas             int32
 	prescalingDesiredTrafficWeight float64
 	prescalingLastTrafficIncrease  time.Time
+	progressiveActive              bool
+	progressiveStep                int32
+	progressiveLastStepIncrease    time.Time
 }
 
 // TrafficChange contains information about a traffic change event
@@ -138,9 +176,27 @@ func (sc *StackContainer) HasTraffic() bool {
 	return sc.actualTrafficWeight > 0 || sc.desiredTrafficWeight > 0
 }
 
+// HasShadowTraffic returns true if the stack receives a mirrored copy of
+// some of the requests.
+func (sc *StackContainer) HasShadowTraffic() bool {
+	return sc.shadowTrafficWeight > 0
+}
+
+// HasStackRoute returns true if the stack is the target of a stack route,
+// i.e. the requests matching its headers or cookies are routed to it.
+func (sc *StackContainer) HasStackRoute() bool {
+	return sc.stackRouted
+}
+
 func (sc *StackContainer) IsReady() bool {
-	// Stacks are considered ready when all subresources have been updated, and we have enough replicas
-	return sc.resourcesUpdated && sc.deploymentReplicas > 0 && sc.deploymentReplicas == sc.updatedReplicas && sc.deploymentReplicas == sc.readyReplicas
+	// Stacks are considered ready when all subresources have been updated, we have enough replicas and all the
+	// readiness gates are met
+	return sc.resourcesUpdated && sc.replicasReady() && len(sc.unmetReadinessGates) == 0
+}
+
+// replicasReady returns true if all the replicas of the deployment are updated and ready.
+func (sc *StackContainer) replicasReady() bool {
+	return sc.deploymentReplicas > 0 && sc.deploymentReplicas == sc.updatedReplicas && sc.deploymentReplicas == sc.readyReplicas
 }
 
 func (sc *StackContainer) MaxReplicas() int32 {
@@ -158,10 +214,47 @@ func (sc *StackContainer) IsAutoscaled() bool {
 }
 
 func (sc *StackContainer) ScaledDown() bool {
-	if sc.HasTraffic() {
+	if sc.HasTraffic() || sc.HasShadowTraffic() || sc.HasStackRoute() || sc.Pinned() {
+		return false
+	}
+	return !sc.noTrafficSince.IsZero() && sc.now().Sub(sc.noTrafficSince) > sc.scaledownTTL
+}
+
+// Pinned returns true if the stack has a pin which hasn't expired yet.
+func (sc *StackContainer) Pinned() bool {
+	pin := sc.Stack.Spec.Pin
+	if pin == nil {
 		return false
 	}
-	return !sc.noTrafficSince.IsZero() && time.Since(sc.noTrafficSince) > sc.scaledownTTL
+	return pin.Until == nil || sc.now().Before(pin.Until.Time)
+}
+
+// lastTrafficTime returns the time the stack last got traffic. Stacks
+// without noTrafficSince are either getting traffic or their traffic isn't
+// managed, in which case now is returned.
+func (sc *StackContainer) lastTrafficTime(now time.Time) time.Time {
+	if sc.noTrafficSince.IsZero() {
+		return now
+	}
+	return sc.noTrafficSince
+}
+
+// now returns the current time from the clock of the stackset, or the wall
+// clock if the stack isn't part of one.
+func (sc *StackContainer) now() time.Time {
+	if sc.clock == nil {
+		return time.Now()
+	}
+	return sc.clock.Now()
+}
+
+// now returns the current time from the clock of the stackset, or the wall
+// clock if it doesn't have one.
+func (ssc *StackSetContainer) now() time.Time {
+	if ssc.Clock == nil {
+		return time.Now()
+	}
+	return ssc.Clock.Now()
 }
 
 func (sc *StackContainer) Name() string {
@@ -179,15 +272,21 @@ type StackResources struct {
 	Service    *v1.Service
 	Ingress    *networking.Ingress
 	RouteGroup *rgv1.RouteGroup
+	HTTPRoute  *gatewayv1.HTTPRoute
+
+	// Jobs of the traffic hooks, they're never updated once created
+	PreTrafficSwitchJob  *batchv1.Job
+	PostTrafficSwitchJob *batchv1.Job
 }
 
-func NewContainer(stackset *zv1.StackSet, reconciler TrafficReconciler, backendWeightsAnnotationKey string, clusterDomains []string) *StackSetContainer {
+func NewContainer(stackset *zv1.StackSet, reconciler TrafficReconciler, backendWeightsAnnotationKey string, clusterDomains []string, clock clock.PassiveClock) *StackSetContainer {
 	return &StackSetContainer{
 		StackSet:                    stackset,
 		StackContainers:             map[types.UID]*StackContainer{},
 		TrafficReconciler:           reconciler,
 		backendWeightsAnnotationKey: backendWeightsAnnotationKey,
 		clusterDomains:              clusterDomains,
+		Clock:                       clock,
 	}
 }
 
@@ -271,6 +370,7 @@ func (ssc *StackSetContainer) UpdateFromResources() error {
 
 	var ingressSpec *zv1.StackSetIngressSpec
 	var routeGroupSpec *zv1.RouteGroupSpec
+	var httpRouteSpec *zv1.HTTPRouteSpec
 	var externalIngress *zv1.StackSetExternalIngressSpec
 	var backendPort *intstr.IntOrString
 
@@ -288,7 +388,16 @@ func (ssc *StackSetContainer) UpdateFromResources() error {
 		backendPort = &rgBackendPort
 	}
 
-	// if backendPort is not defined from Ingress or Routegroup fall back
+	if ssc.StackSet.Spec.HTTPRoute != nil {
+		httpRouteSpec = ssc.StackSet.Spec.HTTPRoute
+		if backendPort != nil && backendPort.IntValue() != int(httpRouteSpec.BackendPort) {
+			return fmt.Errorf("backendPort for HTTPRoute does not match the one of Ingress or RouteGroup %s!=%d", backendPort.String(), httpRouteSpec.BackendPort)
+		}
+		httpRouteBackendPort := intstr.FromInt(int(httpRouteSpec.BackendPort))
+		backendPort = &httpRouteBackendPort
+	}
+
+	// if backendPort is not defined from Ingress, Routegroup or HTTPRoute fall back
 	// to externalIngress if defined
 	if backendPort == nil && ssc.StackSet.Spec.ExternalIngress != nil {
 		externalIngress = ssc.StackSet.Spec.ExternalIngress
@@ -308,13 +417,37 @@ func (ssc *StackSetContainer) UpdateFromResources() error {
 		sc.ingressSpec = ingressSpec
 		sc.backendPort = backendPort
 		sc.routeGroupSpec = routeGroupSpec
+		sc.httpRouteSpec = httpRouteSpec
+		sc.trafficHooks = ssc.StackSet.Spec.TrafficHooks
 		sc.scaledownTTL = scaledownTTL
 		sc.clusterDomains = ssc.clusterDomains
+		sc.clock = ssc.Clock
+		sc.shadowTrafficWeight = 0
+		sc.stackRouted = false
 		sc.updateFromResources()
 	}
 
+	// Requests are only mirrored or routed by headers and cookies by the
+	// RouteGroup managed by the controller, i.e. if RouteGroup support is
+	// enabled and the RouteGroup of the stackset exists.
+	if routeGroupSpec != nil && ssc.RouteGroup != nil {
+		for _, shadow := range routeGroupSpec.ShadowTraffic {
+			if sc := ssc.stackByName(shadow.StackName); sc != nil {
+				sc.shadowTrafficWeight = float64(shadow.Weight)
+			}
+		}
+		for _, stackRoute := range routeGroupSpec.StackRoutes {
+			if sc := ssc.stackByName(stackRoute.StackName); sc != nil {
+				sc.stackRouted = true
+			}
+		}
+	}
+
+	ssc.updateTrafficAnalysis()
+	ssc.updateAutoPromote()
+
 	// only populate traffic if traffic management is enabled
-	if ingressSpec != nil || routeGroupSpec != nil || externalIngress != nil {
+	if ingressSpec != nil || routeGroupSpec != nil || httpRouteSpec != nil || externalIngress != nil {
 		err := ssc.updateDesiredTraffic()
 		if err != nil {
 			return err
@@ -351,7 +484,7 @@ func (ssc *StackSetContainer) TrafficChanges() []TrafficChange {
 func (sc *StackContainer) updateFromResources() {
 	sc.stackReplicas = effectiveReplicas(sc.Stack.Spec.Replicas)
 
-	var deploymentUpdated, serviceUpdated, ingressUpdated, routeGroupUpdated, hpaUpdated bool
+	var deploymentUpdated, serviceUpdated, ingressUpdated, routeGroupUpdated, httpRouteUpdated, hpaUpdated bool
 
 	// deployment
 	if sc.Resources.Deployment != nil {
@@ -382,6 +515,13 @@ func (sc *StackContainer) updateFromResources() {
 		routeGroupUpdated = sc.Resources.RouteGroup == nil
 	}
 
+	// httproute: ignore if httproute is not set or check if we are up to date
+	if sc.httpRouteSpec != nil {
+		httpRouteUpdated = sc.Resources.HTTPRoute != nil && IsResourceUpToDate(sc.Stack, sc.Resources.HTTPRoute.ObjectMeta)
+	} else {
+		httpRouteUpdated = sc.Resources.HTTPRoute == nil
+	}
+
 	// hpa
 	if sc.IsAutoscaled() {
 		hpaUpdated = sc.Resources.HPA != nil && IsResourceUpToDate(sc.Stack, sc.Resources.HPA.ObjectMeta)
@@ -390,7 +530,26 @@ func (sc *StackContainer) updateFromResources() {
 	}
 
 	// aggregated 'resources updated' for the readiness
-	sc.resourcesUpdated = deploymentUpdated && serviceUpdated && ingressUpdated && routeGroupUpdated && hpaUpdated
+	sc.resourcesUpdated = deploymentUpdated && serviceUpdated && ingressUpdated && routeGroupUpdated && httpRouteUpdated && hpaUpdated
+
+	sc.outdatedResources = nil
+	for _, resource := range []struct {
+		name    string
+		updated bool
+	}{
+		{"Deployment", deploymentUpdated},
+		{"Service", serviceUpdated},
+		{"Ingress", ingressUpdated},
+		{"RouteGroup", routeGroupUpdated},
+		{"HTTPRoute", httpRouteUpdated},
+		{"HorizontalPodAutoscaler", hpaUpdated},
+	} {
+		if !resource.updated {
+			sc.outdatedResources = append(sc.outdatedResources, resource.name)
+		}
+	}
+
+	sc.unmetReadinessGates = sc.checkReadinessGates()
 
 	status := sc.Stack.Status
 	sc.noTrafficSince = unwrapTime(status.NoTrafficSince)
@@ -400,4 +559,9 @@ func (sc *StackContainer) updateFromResources() {
 		sc.prescalingDesiredTrafficWeight = status.Prescaling.DesiredTrafficWeight
 		sc.prescalingLastTrafficIncrease = unwrapTime(status.Prescaling.LastTrafficIncrease)
 	}
+	if status.ProgressiveTraffic.Active {
+		sc.progressiveActive = true
+		sc.progressiveStep = status.ProgressiveTraffic.Step
+		sc.progressiveLastStepIncrease = unwrapTime(status.ProgressiveTraffic.LastStepIncrease)
+	}
 }
@@ -0,0 +1,146 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	stackVersionLabelKey = "stack-version"
+
+	rollbackPollInterval = 5 * time.Second
+)
+
+// StackRevision is a stored revision of a stack of a stackset.
+type StackRevision struct {
+	Name     string
+	Version  string
+	Revision int64
+	Created  time.Time
+	// Exists is true if the stack of the revision wasn't deleted.
+	Exists bool
+}
+
+// Revisions returns the stored stack revisions of a stackset, the newest
+// revision first.
+func (t *Switcher) Revisions(ctx context.Context, stackset, namespace string) ([]StackRevision, error) {
+	revisions, err := t.listRevisions(ctx, stackset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	stacks, err := t.client.ZalandoV1().Stacks(namespace).List(ctx, heritageListOptions(stackset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stacks of stackset %s/%s: %v", namespace, stackset, err)
+	}
+	existing := make(map[string]bool, len(stacks.Items))
+	for _, stack := range stacks.Items {
+		existing[stack.Name] = true
+	}
+
+	result := make([]StackRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		result = append(result, StackRevision{
+			Name:     revision.Name,
+			Version:  revision.Labels[stackVersionLabelKey],
+			Revision: revision.Revision,
+			Created:  revision.CreationTimestamp.Time,
+			Exists:   existing[revision.Name],
+		})
+	}
+	return result, nil
+}
+
+// Rollback switches all the traffic of a stackset back to a stack. If the
+// stack was deleted it's recreated from its stored revision first, and the
+// traffic is only switched once it's ready. The context limits the time
+// spent waiting for the stack.
+func (t *Switcher) Rollback(ctx context.Context, stackset, stack, namespace string) ([]StackTrafficWeight, error) {
+	_, err := t.client.ZalandoV1().Stacks(namespace).Get(ctx, stack, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		// The controller takes care of scaling up an existing stack
+		// before switching the traffic to it.
+		return t.Switch(ctx, stackset, stack, namespace, 100)
+	case !errors.IsNotFound(err):
+		return nil, fmt.Errorf("failed to get stack %s/%s: %v", namespace, stack, err)
+	}
+
+	stacksetResource, err := t.client.ZalandoV1().StackSets(namespace).Get(ctx, stackset, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stackset %s/%s: %v", namespace, stackset, err)
+	}
+
+	revision, err := t.client.AppsV1().ControllerRevisions(namespace).Get(ctx, stack, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the revision of stack %s/%s: %v", namespace, stack, err)
+	}
+	if revision.Labels[stacksetHeritageLabelKey] != stackset {
+		return nil, fmt.Errorf("revision %s/%s doesn't belong to stackset %s", namespace, stack, stackset)
+	}
+
+	recreated := &zv1.Stack{}
+	err = json.Unmarshal(revision.Data.Raw, recreated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the revision of stack %s/%s: %v", namespace, stack, err)
+	}
+	recreated.Namespace = namespace
+	recreated.OwnerReferences = []metav1.OwnerReference{
+		{
+			APIVersion: zv1.SchemeGroupVersion.String(),
+			Kind:       "StackSet",
+			Name:       stacksetResource.Name,
+			UID:        stacksetResource.UID,
+		},
+	}
+
+	_, err = t.client.ZalandoV1().Stacks(namespace).Create(ctx, recreated, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recreate stack %s/%s: %v", namespace, stack, err)
+	}
+
+	err = wait.PollImmediateUntil(rollbackPollInterval, func() (bool, error) {
+		current, err := t.client.ZalandoV1().Stacks(namespace).Get(ctx, stack, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return meta.IsStatusConditionTrue(current.Status.Conditions, zv1.StackConditionReady), nil
+	}, ctx.Done())
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for stack %s/%s to become ready: %v", namespace, stack, err)
+	}
+
+	return t.Switch(ctx, stackset, stack, namespace, 100)
+}
+
+// listRevisions returns the revisions of the stacks of a stackset, the
+// newest revision first.
+func (t *Switcher) listRevisions(ctx context.Context, stackset, namespace string) ([]apps.ControllerRevision, error) {
+	revisions, err := t.client.AppsV1().ControllerRevisions(namespace).List(ctx, heritageListOptions(stackset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions of stackset %s/%s: %v", namespace, stackset, err)
+	}
+
+	result := revisions.Items
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Revision > result[j].Revision
+	})
+	return result, nil
+}
+
+func heritageListOptions(stackset string) metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: labels.Set{stacksetHeritageLabelKey: stackset}.String(),
+	}
+}
@@ -0,0 +1,125 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rgfake "github.com/szuecs/routegroup-client/client/clientset/versioned/fake"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+func testRevision(t *testing.T, stack *zv1.Stack, revision int64) *apps.ControllerRevision {
+	data, err := json.Marshal(stack)
+	require.NoError(t, err)
+	return &apps.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      stack.Name,
+			Namespace: "default",
+			Labels:    stack.Labels,
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	v1Stack := testStack("foo-v1")
+	v1Stack.Labels[stackVersionLabelKey] = "v1"
+	v2Stack := testStack("foo-v2")
+	v2Stack.Labels[stackVersionLabelKey] = "v2"
+
+	client := clientset.NewClientset(
+		fake.NewSimpleClientset(testRevision(t, v1Stack, 1), testRevision(t, v2Stack, 2)),
+		ssfake.NewSimpleClientset(testStack("foo-v2")),
+		rgfake.NewSimpleClientset(),
+	)
+
+	revisions, err := NewSwitcher(client).Revisions(context.Background(), "foo", "default")
+	require.NoError(t, err)
+	require.Equal(t, []StackRevision{
+		{Name: "foo-v2", Version: "v2", Revision: 2, Exists: true},
+		{Name: "foo-v1", Version: "v1", Revision: 1, Exists: false},
+	}, revisions)
+}
+
+func TestRollback(t *testing.T) {
+	deleted := testStack("foo-v1")
+	deleted.Annotations = map[string]string{"example.org/team": "foo"}
+	deleted.Spec.PodTemplate.Spec.Containers = []v1.Container{{Name: "foo", Image: "foo:v1"}}
+
+	for _, tc := range []struct {
+		name        string
+		stacks      []runtime.Object
+		revisions   []runtime.Object
+		expectError bool
+	}{
+		{
+			name:      "a deleted stack is recreated from its revision",
+			stacks:    []runtime.Object{testStack("foo-v2")},
+			revisions: []runtime.Object{testRevision(t, deleted, 1)},
+		},
+		{
+			name:   "traffic is switched to an existing stack",
+			stacks: []runtime.Object{testStack("foo-v1"), testStack("foo-v2")},
+		},
+		{
+			name:        "a deleted stack without revision",
+			stacks:      []runtime.Object{testStack("foo-v2")},
+			expectError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stackset := testStackSet(
+				zv1.StackSetSpec{Ingress: &zv1.StackSetIngressSpec{}, Traffic: []*zv1.DesiredTraffic{{StackName: "foo-v2", Weight: 100}}},
+				zv1.StackSetStatus{},
+			)
+			stackset.UID = "stackset-uid"
+			ssClient := ssfake.NewSimpleClientset(append(tc.stacks, stackset)...)
+
+			// the controller marks a recreated stack as ready
+			ssClient.PrependReactor("create", "stacks", func(action kubetesting.Action) (bool, runtime.Object, error) {
+				stack := action.(kubetesting.CreateAction).GetObject().(*zv1.Stack)
+				stack.Status.Conditions = []metav1.Condition{
+					{Type: zv1.StackConditionReady, Status: metav1.ConditionTrue},
+				}
+				return false, nil, nil
+			})
+
+			client := clientset.NewClientset(fake.NewSimpleClientset(tc.revisions...), ssClient, rgfake.NewSimpleClientset())
+			weights, err := NewSwitcher(client).Rollback(context.Background(), "foo", "foo-v1", "default")
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 100},
+				{Name: "foo-v2", Weight: 0},
+			}, weights)
+
+			stack, err := ssClient.ZalandoV1().Stacks("default").Get(context.Background(), "foo-v1", metav1.GetOptions{})
+			require.NoError(t, err)
+			if len(tc.revisions) > 0 {
+				require.Equal(t, deleted.Annotations, stack.Annotations)
+				require.Equal(t, deleted.Spec, stack.Spec)
+				require.Equal(t, []metav1.OwnerReference{
+					{APIVersion: "zalando.org/v1", Kind: "StackSet", Name: "foo", UID: "stackset-uid"},
+				}, stack.OwnerReferences)
+			}
+
+			updated, err := ssClient.ZalandoV1().StackSets("default").Get(context.Background(), "foo", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, []*zv1.DesiredTraffic{{StackName: "foo-v1", Weight: 100}}, updated.Spec.Traffic)
+		})
+	}
+}
@@ -2,81 +2,76 @@ package traffic
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sort"
 
 	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
 	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
 	stacksetHeritageLabelKey           = "stackset"
-	StackTrafficWeightsAnnotationKey   = "zalando.org/stack-traffic-weights"
 	DefaultBackendWeightsAnnotationKey = "zalando.org/backend-weights"
 )
 
 // Switcher is able to switch traffic between stacks.
 type Switcher struct {
-	client                      clientset.Interface
-	backendWeightsAnnotationKey string
+	client clientset.Interface
 }
 
 // NewSwitcher initializes a new traffic switcher.
-func NewSwitcher(client clientset.Interface, backendWeightsAnnotationKey string) *Switcher {
+func NewSwitcher(client clientset.Interface) *Switcher {
 	return &Switcher{
-		client:                      client,
-		backendWeightsAnnotationKey: backendWeightsAnnotationKey,
+		client: client,
 	}
 }
 
-// Switch changes traffic weight for a stack.
+// Switch changes traffic weight for a stack by updating the desired traffic
+// of the stackset. The update is retried if the stackset was modified
+// concurrently.
 func (t *Switcher) Switch(ctx context.Context, stackset, stack, namespace string, weight float64) ([]StackTrafficWeight, error) {
-	stacks, err := t.getStacks(ctx, stackset, namespace)
-	if err != nil {
-		return nil, err
-	}
-
-	normalized := normalizeWeights(stacks)
-	newWeights, err := setWeightForStacks(normalized, stack, weight)
-	if err != nil {
-		return nil, err
-	}
-
-	changeNeeded := false
-	stackWeights := make(map[string]float64, len(newWeights))
-	for i, stack := range newWeights {
-		if stack.Weight != stacks[i].Weight {
-			changeNeeded = true
+	var newWeights []StackTrafficWeight
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		stacksetResource, stacks, err := t.getStacks(ctx, stackset, namespace)
+		if err != nil {
+			return err
 		}
-		stackWeights[stack.Name] = stack.Weight
-	}
 
-	if changeNeeded {
-		stackWeightsData, err := json.Marshal(&stackWeights)
+		normalized := normalizeWeights(stacks)
+		newWeights, err = setWeightForStacks(normalized, stack, weight)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		annotation := map[string]map[string]map[string]string{
-			"metadata": map[string]map[string]string{
-				"annotations": map[string]string{
-					StackTrafficWeightsAnnotationKey: string(stackWeightsData),
-				},
-			},
+		changeNeeded := false
+		for i, stack := range newWeights {
+			if stack.Weight != stacks[i].Weight {
+				changeNeeded = true
+			}
 		}
-
-		annotationData, err := json.Marshal(&annotation)
-		if err != nil {
-			return nil, err
+		if !changeNeeded {
+			return nil
 		}
 
-		_, err = t.client.NetworkingV1().Ingresses(namespace).Patch(ctx, stackset, types.StrategicMergePatchType, annotationData, metav1.PatchOptions{})
-		if err != nil {
-			return nil, err
+		var desiredTraffic []*zv1.DesiredTraffic
+		for _, stack := range newWeights {
+			if stack.Weight > 0 {
+				desiredTraffic = append(desiredTraffic, &zv1.DesiredTraffic{
+					StackName: stack.Name,
+					Weight:    stack.Weight,
+				})
+			}
 		}
+
+		updated := stacksetResource.DeepCopy()
+		updated.Spec.Traffic = desiredTraffic
+		_, err = t.client.ZalandoV1().StackSets(namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return newWeights, nil
@@ -90,30 +85,38 @@ type StackTrafficWeight struct {
 
 // TrafficWeights returns a list of stacks with their current traffic weight.
 func (t *Switcher) TrafficWeights(ctx context.Context, stackset, namespace string) ([]StackTrafficWeight, error) {
-	stacks, err := t.getStacks(ctx, stackset, namespace)
+	_, stacks, err := t.getStacks(ctx, stackset, namespace)
 	if err != nil {
 		return nil, err
 	}
 	return normalizeWeights(stacks), nil
 }
 
-// getStacks returns the stacks of the stackset.
-func (t *Switcher) getStacks(ctx context.Context, stackset, namespace string) ([]StackTrafficWeight, error) {
-	heritageLabels := map[string]string{
-		stacksetHeritageLabelKey: stackset,
+// getStacks returns the stackset and its stacks with the desired traffic
+// from the stackset spec and the actual traffic from the stackset status.
+func (t *Switcher) getStacks(ctx context.Context, stackset, namespace string) (*zv1.StackSet, []StackTrafficWeight, error) {
+	stacksetResource, err := t.client.ZalandoV1().StackSets(namespace).Get(ctx, stackset, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get stackset %s/%s: %v", namespace, stackset, err)
 	}
-	opts := metav1.ListOptions{
-		LabelSelector: labels.Set(heritageLabels).String(),
+
+	if stacksetResource.Spec.Ingress == nil && stacksetResource.Spec.RouteGroup == nil && stacksetResource.Spec.HTTPRoute == nil && stacksetResource.Spec.ExternalIngress == nil {
+		return nil, nil, fmt.Errorf("stackset %s/%s has no ingress, routegroup, httpRoute or externalIngress, traffic is not managed", namespace, stackset)
 	}
 
-	stacks, err := t.client.ZalandoV1().Stacks(namespace).List(ctx, opts)
+	stacks, err := t.client.ZalandoV1().Stacks(namespace).List(ctx, heritageListOptions(stackset))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list stacks of stackset %s/%s: %v", namespace, stackset, err)
+		return nil, nil, fmt.Errorf("failed to list stacks of stackset %s/%s: %v", namespace, stackset, err)
 	}
 
-	desired, actual, err := t.getIngressTraffic(ctx, stackset, namespace, stacks.Items)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get Ingress traffic for StackSet %s/%s: %v", namespace, stackset, err)
+	desired := make(map[string]float64, len(stacksetResource.Spec.Traffic))
+	for _, traffic := range stacksetResource.Spec.Traffic {
+		desired[traffic.StackName] = traffic.Weight
+	}
+
+	actual := make(map[string]float64, len(stacksetResource.Status.Traffic))
+	for _, traffic := range stacksetResource.Status.Traffic {
+		actual[traffic.ServiceName] = traffic.Weight
 	}
 
 	stackWeights := make([]StackTrafficWeight, 0, len(stacks.Items))
@@ -126,36 +129,10 @@ func (t *Switcher) getStacks(ctx context.Context, stackset, namespace string) ([
 
 		stackWeights = append(stackWeights, stackWeight)
 	}
-	return stackWeights, nil
-}
-
-func (t *Switcher) getIngressTraffic(ctx context.Context, name, namespace string, stacks []zv1.Stack) (map[string]float64, map[string]float64, error) {
-	if len(stacks) == 0 {
-		return map[string]float64{}, map[string]float64{}, nil
-	}
-
-	ingress, err := t.client.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
-	if err != nil {
-		return nil, nil, err
-	}
-
-	desiredTraffic := make(map[string]float64, len(stacks))
-	if weights, ok := ingress.Annotations[StackTrafficWeightsAnnotationKey]; ok {
-		err := json.Unmarshal([]byte(weights), &desiredTraffic)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get current desired Stack traffic weights: %v", err)
-		}
-	}
-
-	actualTraffic := make(map[string]float64, len(stacks))
-	if weights, ok := ingress.Annotations[t.backendWeightsAnnotationKey]; ok {
-		err := json.Unmarshal([]byte(weights), &actualTraffic)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get current actual Stack traffic weights: %v", err)
-		}
-	}
-
-	return desiredTraffic, actualTraffic, nil
+	sort.Slice(stackWeights, func(i, j int) bool {
+		return stackWeights[i].Name < stackWeights[j].Name
+	})
+	return stacksetResource, stackWeights, nil
 }
 
 // setWeightForStacks sets new traffic weight for the specified stack and adjusts
@@ -163,9 +140,11 @@ func (t *Switcher) getIngressTraffic(ctx context.Context, name, namespace string
 // It's assumed that the sum of weights over all stacks are 100.
 func setWeightForStacks(stacks []StackTrafficWeight, stackName string, weight float64) ([]StackTrafficWeight, error) {
 	newWeights := make([]StackTrafficWeight, len(stacks))
+	found := false
 	currentWeight := float64(0)
 	for i, stack := range stacks {
 		if stack.Name == stackName {
+			found = true
 			currentWeight = stack.Weight
 			stack.Weight = weight
 			newWeights[i] = stack
@@ -173,6 +152,10 @@ func setWeightForStacks(stacks []StackTrafficWeight, stackName string, weight fl
 		}
 	}
 
+	if !found {
+		return nil, fmt.Errorf("stack '%s' not found", stackName)
+	}
+
 	change := float64(0)
 
 	if currentWeight < 100 {
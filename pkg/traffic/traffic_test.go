@@ -0,0 +1,222 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rgfake "github.com/szuecs/routegroup-client/client/clientset/versioned/fake"
+	zv1 "github.com/zalando-incubator/stackset-controller/pkg/apis/zalando.org/v1"
+	ssfake "github.com/zalando-incubator/stackset-controller/pkg/client/clientset/versioned/fake"
+	"github.com/zalando-incubator/stackset-controller/pkg/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+func testStack(name string) *zv1.Stack {
+	return &zv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				stacksetHeritageLabelKey: "foo",
+			},
+		},
+	}
+}
+
+func testStackSet(spec zv1.StackSetSpec, status zv1.StackSetStatus) *zv1.StackSet {
+	return &zv1.StackSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec:   spec,
+		Status: status,
+	}
+}
+
+func TestTrafficWeights(t *testing.T) {
+	actualTraffic := []*zv1.ActualTraffic{
+		{StackName: "foo-v1", ServiceName: "foo-v1", Weight: 100},
+	}
+	desiredTraffic := []*zv1.DesiredTraffic{
+		{StackName: "foo-v2", Weight: 100},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		spec        zv1.StackSetSpec
+		expected    []StackTrafficWeight
+		expectError bool
+	}{
+		{
+			name: "ingress",
+			spec: zv1.StackSetSpec{Ingress: &zv1.StackSetIngressSpec{}, Traffic: desiredTraffic},
+			expected: []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 0, ActualWeight: 100},
+				{Name: "foo-v2", Weight: 100, ActualWeight: 0},
+			},
+		},
+		{
+			name: "routegroup",
+			spec: zv1.StackSetSpec{RouteGroup: &zv1.RouteGroupSpec{}, Traffic: desiredTraffic},
+			expected: []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 0, ActualWeight: 100},
+				{Name: "foo-v2", Weight: 100, ActualWeight: 0},
+			},
+		},
+		{
+			name: "external ingress",
+			spec: zv1.StackSetSpec{ExternalIngress: &zv1.StackSetExternalIngressSpec{}, Traffic: desiredTraffic},
+			expected: []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 0, ActualWeight: 100},
+				{Name: "foo-v2", Weight: 100, ActualWeight: 0},
+			},
+		},
+		{
+			name:        "no traffic management",
+			spec:        zv1.StackSetSpec{},
+			expectError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := clientset.NewClientset(
+				fake.NewSimpleClientset(),
+				ssfake.NewSimpleClientset(
+					testStackSet(tc.spec, zv1.StackSetStatus{Traffic: actualTraffic}),
+					testStack("foo-v2"),
+					testStack("foo-v1"),
+				),
+				rgfake.NewSimpleClientset(),
+			)
+
+			weights, err := NewSwitcher(client).TrafficWeights(context.Background(), "foo", "default")
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, weights)
+		})
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		traffic         []*zv1.DesiredTraffic
+		stack           string
+		weight          float64
+		conflicts       int
+		expected        []StackTrafficWeight
+		expectedTraffic []*zv1.DesiredTraffic
+		expectError     bool
+	}{
+		{
+			name: "traffic is switched to a stack",
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+			stack:  "foo-v2",
+			weight: 100,
+			expected: []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 0, ActualWeight: 100},
+				{Name: "foo-v2", Weight: 100},
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v2", Weight: 100},
+			},
+		},
+		{
+			name: "other stacks are adjusted relatively",
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+			stack:  "foo-v2",
+			weight: 25,
+			expected: []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 75, ActualWeight: 100},
+				{Name: "foo-v2", Weight: 25},
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 75},
+				{StackName: "foo-v2", Weight: 25},
+			},
+		},
+		{
+			name: "update is retried on conflicts",
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+			stack:     "foo-v2",
+			weight:    100,
+			conflicts: 2,
+			expected: []StackTrafficWeight{
+				{Name: "foo-v1", Weight: 0, ActualWeight: 100},
+				{Name: "foo-v2", Weight: 100},
+			},
+			expectedTraffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v2", Weight: 100},
+			},
+		},
+		{
+			name: "only stack getting traffic can't be reduced",
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+			stack:       "foo-v1",
+			weight:      50,
+			expectError: true,
+		},
+		{
+			name: "unknown stack",
+			traffic: []*zv1.DesiredTraffic{
+				{StackName: "foo-v1", Weight: 100},
+			},
+			stack:       "foo-v3",
+			weight:      50,
+			expectError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ssClient := ssfake.NewSimpleClientset(
+				testStackSet(
+					zv1.StackSetSpec{Ingress: &zv1.StackSetIngressSpec{}, Traffic: tc.traffic},
+					zv1.StackSetStatus{Traffic: []*zv1.ActualTraffic{
+						{StackName: "foo-v1", ServiceName: "foo-v1", Weight: 100},
+					}},
+				),
+				testStack("foo-v1"),
+				testStack("foo-v2"),
+			)
+
+			conflicts := tc.conflicts
+			ssClient.PrependReactor("update", "stacksets", func(action kubetesting.Action) (bool, runtime.Object, error) {
+				if conflicts > 0 {
+					conflicts--
+					return true, nil, errors.NewConflict(schema.GroupResource{Resource: "stacksets"}, "foo", nil)
+				}
+				return false, nil, nil
+			})
+
+			client := clientset.NewClientset(fake.NewSimpleClientset(), ssClient, rgfake.NewSimpleClientset())
+			weights, err := NewSwitcher(client).Switch(context.Background(), "foo", tc.stack, "default", tc.weight)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, weights)
+			require.Equal(t, 0, conflicts)
+
+			stackset, err := ssClient.ZalandoV1().StackSets("default").Get(context.Background(), "foo", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedTraffic, stackset.Spec.Traffic)
+		})
+	}
+}